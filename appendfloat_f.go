@@ -37,13 +37,42 @@ func appendFloatF(dst []byte, val float64) []byte {
 	// Use Ryu algorithm.
 	var buf [32]byte
 	digs.d = buf[:]
-	ryuFtoaShortest(&digs, mant, exp-mantbits)
+	ryuFtoaShortest(&digs, mant, exp-mantbits, &float64info)
 	// Precision for shortest representation mode.
 
 	prec = max(digs.nd-digs.dp, 0)
 	return fmtF(dst, neg, digs, prec)
 }
 
+// appendFloat32F is appendFloatF with the shortest representation of a float32.
+func appendFloat32F(dst []byte, val float32) []byte {
+	bits := math.Float32bits(val)
+	const mantbits = 23
+	const expbits = 8
+	const bias = -127
+
+	neg := bits>>(expbits+mantbits) != 0
+	exp := int(bits>>mantbits) & (1<<expbits - 1)
+	mant := uint64(bits & (uint32(1)<<mantbits - 1))
+
+	switch exp {
+	case 0:
+		// denormalized
+		exp++
+
+	default:
+		// add implicit top bit
+		mant |= uint64(1) << mantbits
+	}
+	exp += bias
+
+	var digs decimalSlice
+	var buf [32]byte
+	digs.d = buf[:]
+	ryuFtoaShortest(&digs, mant, exp-mantbits, &float32info)
+	return fmtF(dst, neg, digs, max(digs.nd-digs.dp, 0))
+}
+
 type decimalSlice struct {
 	d      []byte
 	nd, dp int
@@ -0,0 +1,300 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/minio/simdjson-go"
+)
+
+const testSchema = `{
+  "type": "record", "name": "Event", "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "name", "type": "string"},
+    {"name": "ok", "type": "boolean"},
+    {"name": "score", "type": "double"},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attrs", "type": {"type": "map", "values": "int"}},
+    {"name": "color", "type": {"type": "enum", "name": "Color", "symbols": ["RED", "GREEN", "BLUE"]}},
+    {"name": "maybe", "type": ["null", "string"]},
+    {"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "day", "type": {"type": "int", "logicalType": "date"}},
+    {"name": "fx", "type": {"type": "fixed", "name": "Two", "size": 2}},
+    {"name": "opt", "type": ["null", "long"]},
+    {"name": "def", "type": "int", "default": 7},
+    {"name": "udef", "type": ["string", "null"], "default": "x"},
+    {"name": "u", "type": ["null", "long"]},
+    {"name": "next", "type": ["null", "Event"], "default": null}
+  ]
+}`
+
+const testRecord = `{"id":1,"name":"ab","ok":true,"score":1.5,"tags":["x"],"attrs":{"k":2},"color":"GREEN",
+"maybe":null,"ts":"1970-01-01T00:00:01Z","day":"1970-01-02","fx":"\u0001\u0002","u":5,"ignored":[1,2]}`
+
+var testRecordAvro = []byte{
+	0x02,           // id
+	0x04, 'a', 'b', // name
+	0x01,                                           // ok
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f, // score
+	0x02, 0x02, 'x', 0x00, // tags
+	0x02, 0x02, 'k', 0x04, 0x00, // attrs
+	0x02,       // color
+	0x00,       // maybe
+	0xd0, 0x0f, // ts
+	0x02,       // day
+	0x01, 0x02, // fx
+	0x00,            // opt
+	0x0e,            // def
+	0x00, 0x02, 'x', // udef
+	0x02, 0x0a, // u
+	0x00, // next
+}
+
+func encodeRecord(t *testing.T, s *Schema, record string) ([]byte, error) {
+	t.Helper()
+	pj, err := simdjson.Parse([]byte(record), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEncoder(s).AppendBinary(nil, pj.Iter())
+}
+
+func TestEncoder_AppendBinary(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != "com.example.Event" {
+		t.Errorf("unexpected name %q", s.Name())
+	}
+	got, err := encodeRecord(t, s, testRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, testRecordAvro) {
+		t.Errorf("got  %x\nwant %x", got, testRecordAvro)
+	}
+
+	// Primitive schema, encoding a value inside a record.
+	ls, err := ParseSchema([]byte(` "long" `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ls.Type() != TypeLong || ls.String() != ` "long" ` {
+		t.Errorf("unexpected schema %v: %s", ls.Type(), ls)
+	}
+	pj, err := simdjson.Parse([]byte(`{"v":-3}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e simdjson.Element
+	root := pj.Iter()
+	if _, err := root.FindElement(&e, "v"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = NewEncoder(ls).AppendBinary(nil, e.Iter)
+	if err != nil || !bytes.Equal(got, []byte{0x05}) {
+		t.Errorf("got %x, %v", got, err)
+	}
+
+	// Recursive record
+	nested := strings.Replace(testRecord, `"u":5`, `"u":5,"next":`+testRecord, 1)
+	got, err = encodeRecord(t, s, nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{}, testRecordAvro[:len(testRecordAvro)-1]...)
+	want = append(want, 0x02)
+	want = append(want, testRecordAvro...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got  %x\nwant %x", got, want)
+	}
+}
+
+func TestEncoder_Errors(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from, to, want string
+	}{
+		{from: `"id":1,`, to: ``, want: "id: missing required field"},
+		{from: `"id":1`, to: `"id":1.5`, want: "id: 1.5 is not a valid long"},
+		{from: `"color":"GREEN"`, to: `"color":"PINK"`, want: "color: \"PINK\" is not a symbol"},
+		{from: `"attrs":{"k":2}`, to: `"attrs":{"k":3000000000}`, want: "attrs: k: 3000000000 overflows int"},
+		{from: `"tags":["x"]`, to: `"tags":["x",1]`, want: "tags: [1]: expected string, got int"},
+		{from: `"maybe":null`, to: `"maybe":true`, want: "maybe: bool value does not match any union branch"},
+		{from: `"fx":"\u0001\u0002"`, to: `"fx":"abc"`, want: "must be 2 bytes"},
+		{from: `"ts":"1970-01-01T00:00:01Z"`, to: `"ts":"yesterday"`, want: "ts: parsing time"},
+	}
+	for _, test := range tests {
+		record := strings.Replace(testRecord, test.from, test.to, 1)
+		_, err := encodeRecord(t, s, record)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.to, err, test.want)
+		}
+	}
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	tests := map[string]string{
+		`"Unknown"`:                     "unknown type",
+		`[]`:                            "empty union",
+		`{"type":"record","fields":[]}`: "without name",
+		`{"type":"record","name":"a","fields":[{"name":"x"}]}`:   "without type",
+		`{"type":"record","name":"a","fields":[{"type":"int"}]}`: "field without name",
+		`{"type":"enum","name":"e","symbols":["A","A"]}`:         "duplicate symbol",
+		`["int",["null"]]`: "unions cannot contain unions",
+		`{"type":"array"}`: "without item type",
+		`[{"type":"fixed","name":"f","size":1},{"type":"enum","name":"f","symbols":[]}]`: "defined twice",
+	}
+	for schema, want := range tests {
+		_, err := ParseSchema([]byte(schema))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", schema, err, want)
+		}
+	}
+}
+
+// readLong reads a zig-zag varint.
+func readLong(t *testing.T, r *bytes.Reader) int64 {
+	t.Helper()
+	v, err := binary.ReadVarint(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func readBytes(t *testing.T, r *bytes.Reader) []byte {
+	t.Helper()
+	b := make([]byte, readLong(t, r))
+	if _, err := r.Read(b); err != nil && len(b) > 0 {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriter(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	s, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 100
+	input := strings.Repeat(strings.Replace(testRecord, "\n", "", -1)+"\n", n)
+	pj, err := simdjson.ParseND([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	for _, codec := range []Codec{CodecNull, CodecDeflate, CodecSnappy} {
+		t.Run(codec.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, s, WithCodec(codec), WithBlockSize(1000), WithSyncMarker(marker))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteParsed(pj); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r := bytes.NewReader(buf.Bytes())
+			hdr := make([]byte, 4)
+			r.Read(hdr)
+			if !bytes.Equal(hdr, magic) {
+				t.Fatalf("bad magic %x", hdr)
+			}
+			meta := map[string]string{}
+			for cnt := readLong(t, r); cnt != 0; cnt = readLong(t, r) {
+				for i := int64(0); i < cnt; i++ {
+					k := readBytes(t, r)
+					meta[string(k)] = string(readBytes(t, r))
+				}
+			}
+			if meta["avro.schema"] != testSchema || meta["avro.codec"] != codec.String() {
+				t.Fatalf("unexpected metadata: %v", meta)
+			}
+			sync := make([]byte, 16)
+			r.Read(sync)
+			if !bytes.Equal(sync, marker[:]) {
+				t.Fatalf("bad sync marker %x", sync)
+			}
+
+			records, blocks := 0, 0
+			var data []byte
+			for r.Len() > 0 {
+				cnt := readLong(t, r)
+				block := readBytes(t, r)
+				switch codec {
+				case CodecDeflate:
+					block, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(block)))
+				case CodecSnappy:
+					crc := binary.BigEndian.Uint32(block[len(block)-4:])
+					block, err = s2.Decode(nil, block[:len(block)-4])
+					if err == nil && crc != crc32.ChecksumIEEE(block) {
+						t.Fatal("crc mismatch")
+					}
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				data = append(data, block...)
+				r.Read(sync)
+				if !bytes.Equal(sync, marker[:]) {
+					t.Fatalf("bad block sync marker %x", sync)
+				}
+				records += int(cnt)
+				blocks++
+			}
+			if records != n {
+				t.Errorf("got %d records, want %d", records, n)
+			}
+			if blocks < 2 {
+				t.Errorf("expected several blocks, got %d", blocks)
+			}
+			if want := bytes.Repeat(testRecordAvro, n); !bytes.Equal(data, want) {
+				t.Errorf("record data mismatch")
+			}
+		})
+	}
+}
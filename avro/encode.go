@@ -0,0 +1,486 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Encoder encodes records as Avro binary.
+// An Encoder can be reused, but not used concurrently.
+type Encoder struct {
+	schema *Schema
+
+	// fields contains the record field values, per nesting level.
+	fields [][]simdjson.Iter
+	depth  int
+}
+
+// NewEncoder returns an encoder for the schema.
+func NewEncoder(s *Schema) *Encoder {
+	return &Encoder{schema: s}
+}
+
+// Schema returns the schema of the encoder.
+func (e *Encoder) Schema() *Schema {
+	return e.schema
+}
+
+// AppendBinary appends the Avro binary encoding of the value to dst.
+// The Iter can be a record as returned by ParsedJson.ForEach or a value inside a record.
+// On errors dst is returned unchanged.
+func (e *Encoder) AppendBinary(dst []byte, i simdjson.Iter) ([]byte, error) {
+	if i.Type() == simdjson.TypeNone {
+		// New iterator from ParsedJson.Iter.
+		i.AdvanceInto()
+	}
+	if i.Type() == simdjson.TypeRoot {
+		_, r, err := i.Root(nil)
+		if err != nil {
+			return dst, err
+		}
+		i = *r
+	}
+	e.depth = 0
+	out, err := e.encode(dst, e.schema, &i)
+	if err != nil {
+		return dst, fmt.Errorf("avro: %w", err)
+	}
+	return out, nil
+}
+
+// encode appends the value of it encoded with schema s.
+func (e *Encoder) encode(dst []byte, s *Schema, it *simdjson.Iter) ([]byte, error) {
+	t := it.Type()
+	switch s.typ {
+	case TypeNull:
+		if t != simdjson.TypeNull {
+			return dst, typeError(s, t)
+		}
+		return dst, nil
+	case TypeBoolean:
+		if t != simdjson.TypeBool {
+			return dst, typeError(s, t)
+		}
+		b, err := it.Bool()
+		if b {
+			return append(dst, 1), err
+		}
+		return append(dst, 0), err
+	case TypeInt, TypeLong:
+		v, err := integerValue(s, it)
+		if err != nil {
+			return dst, err
+		}
+		return appendLong(dst, v), nil
+	case TypeFloat, TypeDouble:
+		if !isNumber(t) {
+			return dst, typeError(s, t)
+		}
+		f, err := it.Float()
+		if err != nil {
+			return dst, err
+		}
+		if s.typ == TypeFloat {
+			return appendUint32(dst, math.Float32bits(float32(f))), nil
+		}
+		return appendUint64(dst, math.Float64bits(f)), nil
+	case TypeString:
+		if t != simdjson.TypeString {
+			return dst, typeError(s, t)
+		}
+		b, err := it.StringBytes()
+		if err != nil {
+			return dst, err
+		}
+		dst = appendLong(dst, int64(len(b)))
+		return append(dst, b...), nil
+	case TypeBytes, TypeFixed:
+		if t != simdjson.TypeString {
+			return dst, typeError(s, t)
+		}
+		b, err := it.StringBytes()
+		if err != nil {
+			return dst, err
+		}
+		n, ok := byteLen(b)
+		if !ok {
+			return dst, fmt.Errorf("%v contains characters above 255", s.typ)
+		}
+		if s.typ == TypeFixed {
+			if n != s.size {
+				return dst, fmt.Errorf("fixed %q must be %d bytes, got %d", s.name, s.size, n)
+			}
+		} else {
+			dst = appendLong(dst, int64(n))
+		}
+		return appendBytes(dst, b), nil
+	case TypeEnum:
+		if t != simdjson.TypeString {
+			return dst, typeError(s, t)
+		}
+		b, err := it.StringBytes()
+		if err != nil {
+			return dst, err
+		}
+		idx, ok := s.symbols[string(b)]
+		if !ok {
+			return dst, fmt.Errorf("%q is not a symbol of enum %q", b, s.name)
+		}
+		return appendLong(dst, int64(idx)), nil
+	case TypeArray:
+		if t != simdjson.TypeArray {
+			return dst, typeError(s, t)
+		}
+		arr, err := it.Array(nil)
+		if err != nil {
+			return dst, err
+		}
+		// Write a single block.
+		n := 0
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			n++
+		}
+		if n > 0 {
+			dst = appendLong(dst, int64(n))
+			elems = arr.Iter()
+			for i := 0; elems.Advance() != simdjson.TypeNone; i++ {
+				if dst, err = e.encode(dst, s.items, &elems); err != nil {
+					return dst, fmt.Errorf("[%d]: %w", i, err)
+				}
+			}
+		}
+		return append(dst, 0), nil
+	case TypeMap:
+		if t != simdjson.TypeObject {
+			return dst, typeError(s, t)
+		}
+		obj, err := it.Object(nil)
+		if err != nil {
+			return dst, err
+		}
+		start := *obj
+		n := 0
+		var elem simdjson.Iter
+		for {
+			_, t, err := obj.NextElementBytes(&elem)
+			if err != nil {
+				return dst, err
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			n++
+		}
+		if n > 0 {
+			dst = appendLong(dst, int64(n))
+			obj = &start
+			for {
+				key, t, err := obj.NextElementBytes(&elem)
+				if err != nil {
+					return dst, err
+				}
+				if t == simdjson.TypeNone {
+					break
+				}
+				dst = appendLong(dst, int64(len(key)))
+				dst = append(dst, key...)
+				if dst, err = e.encode(dst, s.items, &elem); err != nil {
+					return dst, fmt.Errorf("%s: %w", key, err)
+				}
+			}
+		}
+		return append(dst, 0), nil
+	case TypeUnion:
+		for i, b := range s.branches {
+			if matches(b, it) {
+				dst = appendLong(dst, int64(i))
+				return e.encode(dst, b, it)
+			}
+		}
+		return dst, fmt.Errorf("%v value does not match any union branch", t)
+	case TypeRecord:
+		return e.encodeRecord(dst, s, it)
+	}
+	return dst, fmt.Errorf("unknown schema type %v", s.typ)
+}
+
+// encodeRecord encodes a record.
+// Fields missing from the object use the default value, or null if the field type allows it.
+// Object keys that are not fields are ignored.
+func (e *Encoder) encodeRecord(dst []byte, s *Schema, it *simdjson.Iter) ([]byte, error) {
+	t := it.Type()
+	if t != simdjson.TypeObject {
+		return dst, typeError(s, t)
+	}
+	obj, err := it.Object(nil)
+	if err != nil {
+		return dst, err
+	}
+
+	// Get field values for this nesting level.
+	if e.depth == len(e.fields) {
+		e.fields = append(e.fields, nil)
+	}
+	vals := e.fields[e.depth]
+	if cap(vals) < len(s.fields) {
+		vals = make([]simdjson.Iter, len(s.fields))
+	}
+	vals = vals[:len(s.fields)]
+	for i := range vals {
+		vals[i] = simdjson.Iter{}
+	}
+	e.fields[e.depth] = vals
+	e.depth++
+	defer func() { e.depth-- }()
+
+	var elem simdjson.Iter
+	for {
+		key, t, err := obj.NextElementBytes(&elem)
+		if err != nil {
+			return dst, err
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		if idx, ok := s.fieldIdx[string(key)]; ok {
+			vals[idx] = elem
+		}
+	}
+
+	for i := range s.fields {
+		f := &s.fields[i]
+		v := &vals[i]
+		if v.Type() == simdjson.TypeNone {
+			switch {
+			case f.hasDefault:
+				v = &f.def
+				if f.schema.typ == TypeUnion {
+					// Defaults of unions use the first branch.
+					dst = append(dst, 0)
+					if dst, err = e.encode(dst, f.schema.branches[0], v); err != nil {
+						return dst, fmt.Errorf("%s: default: %w", f.name, err)
+					}
+					continue
+				}
+			case acceptsNull(f.schema):
+				dst, err = e.encode(dst, f.schema, &nullIter)
+				if err != nil {
+					return dst, fmt.Errorf("%s: %w", f.name, err)
+				}
+				continue
+			default:
+				return dst, fmt.Errorf("%s: missing required field", f.name)
+			}
+		}
+		if dst, err = e.encode(dst, f.schema, v); err != nil {
+			return dst, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return dst, nil
+}
+
+// nullIter is an iterator containing a null value.
+var nullIter = func() simdjson.Iter {
+	var b simdjson.Builder
+	b.Null()
+	pj, err := b.Finish()
+	if err != nil {
+		panic(err)
+	}
+	it := pj.Iter()
+	it.AdvanceInto()
+	it.AdvanceInto()
+	return it
+}()
+
+// acceptsNull returns whether null is a valid value for s.
+func acceptsNull(s *Schema) bool {
+	if s.typ == TypeNull {
+		return true
+	}
+	if s.typ == TypeUnion {
+		for _, b := range s.branches {
+			if b.typ == TypeNull {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches returns whether the JSON value can be encoded as s.
+// Used for selecting union branches.
+func matches(s *Schema, it *simdjson.Iter) bool {
+	t := it.Type()
+	switch s.typ {
+	case TypeNull:
+		return t == simdjson.TypeNull
+	case TypeBoolean:
+		return t == simdjson.TypeBool
+	case TypeInt, TypeLong:
+		if !isNumber(t) && t != simdjson.TypeString {
+			return false
+		}
+		_, err := integerValue(s, it)
+		return err == nil
+	case TypeFloat, TypeDouble:
+		return isNumber(t)
+	case TypeString:
+		return t == simdjson.TypeString
+	case TypeBytes:
+		return t == simdjson.TypeString
+	case TypeFixed:
+		if t != simdjson.TypeString {
+			return false
+		}
+		b, err := it.StringBytes()
+		n, ok := byteLen(b)
+		return err == nil && ok && n == s.size
+	case TypeEnum:
+		if t != simdjson.TypeString {
+			return false
+		}
+		b, err := it.StringBytes()
+		_, ok := s.symbols[string(b)]
+		return err == nil && ok
+	case TypeArray:
+		return t == simdjson.TypeArray
+	case TypeMap, TypeRecord:
+		return t == simdjson.TypeObject
+	}
+	return false
+}
+
+func isNumber(t simdjson.Type) bool {
+	return t == simdjson.TypeInt || t == simdjson.TypeUint || t == simdjson.TypeFloat
+}
+
+func typeError(s *Schema, t simdjson.Type) error {
+	return fmt.Errorf("expected %v, got %v", s.typ, t)
+}
+
+// integerValue returns the value for an int or long schema.
+// Floats must be integers, and strings are accepted for date and timestamp logical types.
+func integerValue(s *Schema, it *simdjson.Iter) (int64, error) {
+	var v int64
+	switch it.Type() {
+	case simdjson.TypeInt:
+		v, _ = it.Int()
+	case simdjson.TypeUint:
+		u, err := it.Uint()
+		if err != nil {
+			return 0, err
+		}
+		if u > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows %v", u, s.typ)
+		}
+		v = int64(u)
+	case simdjson.TypeFloat:
+		f, err := it.Float()
+		if err != nil {
+			return 0, err
+		}
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= -math.MinInt64 {
+			return 0, fmt.Errorf("%v is not a valid %v", f, s.typ)
+		}
+		v = int64(f)
+	case simdjson.TypeString:
+		str, err := it.String()
+		if err != nil {
+			return 0, err
+		}
+		if v, err = parseLogical(s, str); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, typeError(s, it.Type())
+	}
+	if s.typ == TypeInt && (v < math.MinInt32 || v > math.MaxInt32) {
+		return 0, fmt.Errorf("%d overflows int", v)
+	}
+	return v, nil
+}
+
+// parseLogical parses a string for a date or timestamp logical type.
+func parseLogical(s *Schema, str string) (int64, error) {
+	switch s.logical {
+	case "date":
+		t, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return 0, err
+		}
+		return t.Unix() / 86400, nil
+	case "timestamp-millis", "timestamp-micros", "local-timestamp-millis", "local-timestamp-micros":
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return 0, err
+		}
+		if s.logical == "timestamp-millis" || s.logical == "local-timestamp-millis" {
+			return t.Unix()*1e3 + int64(t.Nanosecond())/1e6, nil
+		}
+		return t.Unix()*1e6 + int64(t.Nanosecond())/1e3, nil
+	}
+	return 0, fmt.Errorf("expected %v, got string", s.typ)
+}
+
+// byteLen returns the number of bytes of a string in Avro JSON encoding,
+// where each character is a byte.
+func byteLen(b []byte) (int, bool) {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r > 255 {
+			return 0, false
+		}
+		b = b[size:]
+		n++
+	}
+	return n, true
+}
+
+// appendBytes appends the characters of b as bytes. See byteLen.
+func appendBytes(dst, b []byte) []byte {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		dst = append(dst, byte(r))
+		b = b[size:]
+	}
+	return dst
+}
+
+// appendLong appends v as a zig-zag encoded varint.
+func appendLong(dst []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(dst, tmp[:n]...)
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(dst []byte, v uint64) []byte {
+	return appendUint32(appendUint32(dst, uint32(v)), uint32(v>>32))
+}
@@ -0,0 +1,226 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/minio/simdjson-go"
+)
+
+// Codec is the compression codec of an Object Container File.
+type Codec uint8
+
+const (
+	// CodecNull writes uncompressed blocks.
+	CodecNull Codec = iota
+
+	// CodecDeflate compresses blocks with deflate.
+	CodecDeflate
+
+	// CodecSnappy compresses blocks with Snappy.
+	CodecSnappy
+)
+
+// String returns the codec name used in the file metadata.
+func (c Codec) String() string {
+	switch c {
+	case CodecNull:
+		return "null"
+	case CodecDeflate:
+		return "deflate"
+	case CodecSnappy:
+		return "snappy"
+	}
+	return "(invalid)"
+}
+
+// magic is the Object Container File header magic.
+var magic = []byte{'O', 'b', 'j', 1}
+
+// Writer writes records to an Avro Object Container File.
+// A Writer cannot be used concurrently.
+type Writer struct {
+	w     io.Writer
+	enc   *Encoder
+	codec Codec
+	sync  [16]byte
+
+	blockSize int
+	block     []byte
+	count     int64
+
+	buf  []byte
+	comp bytes.Buffer
+	snap []byte
+	fw   *flate.Writer
+	err  error
+}
+
+// WriterOption is an option for NewWriter.
+type WriterOption func(w *Writer) error
+
+// WithCodec sets the compression codec. The default is CodecNull.
+func WithCodec(c Codec) WriterOption {
+	return func(w *Writer) error {
+		if c > CodecSnappy {
+			return fmt.Errorf("avro: unknown codec %d", c)
+		}
+		w.codec = c
+		return nil
+	}
+}
+
+// WithBlockSize sets the approximate uncompressed size of each block.
+// The default is 64KB.
+func WithBlockSize(n int) WriterOption {
+	return func(w *Writer) error {
+		if n <= 0 {
+			return errors.New("avro: block size must be positive")
+		}
+		w.blockSize = n
+		return nil
+	}
+}
+
+// WithSyncMarker sets the sync marker. By default a random marker is used.
+func WithSyncMarker(marker [16]byte) WriterOption {
+	return func(w *Writer) error {
+		w.sync = marker
+		return nil
+	}
+}
+
+// NewWriter writes the file header to w and returns a Writer
+// that writes records encoded with the schema.
+func NewWriter(w io.Writer, s *Schema, opts ...WriterOption) (*Writer, error) {
+	ow := &Writer{w: w, enc: NewEncoder(s), blockSize: 64 << 10}
+	if _, err := io.ReadFull(rand.Reader, ow.sync[:]); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(ow); err != nil {
+			return nil, err
+		}
+	}
+
+	// Header: magic, metadata map, sync marker.
+	hdr := append([]byte(nil), magic...)
+	hdr = appendLong(hdr, 2)
+	hdr = appendString(hdr, "avro.schema")
+	hdr = appendLong(hdr, int64(len(s.json)))
+	hdr = append(hdr, s.json...)
+	hdr = appendString(hdr, "avro.codec")
+	hdr = appendString(hdr, ow.codec.String())
+	hdr = append(hdr, 0)
+	hdr = append(hdr, ow.sync[:]...)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return ow, nil
+}
+
+// Write encodes a record and adds it to the current block.
+// The block is written when it exceeds the block size.
+// If the record cannot be encoded an error is returned and
+// the record is skipped, so writing can continue.
+func (w *Writer) Write(i simdjson.Iter) error {
+	if w.err != nil {
+		return w.err
+	}
+	var err error
+	w.block, err = w.enc.AppendBinary(w.block, i)
+	if err != nil {
+		return err
+	}
+	w.count++
+	if len(w.block) >= w.blockSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// WriteParsed writes all records in pj.
+func (w *Writer) WriteParsed(pj *simdjson.ParsedJson) error {
+	return pj.ForEach(w.Write)
+}
+
+// Flush writes the current block, if any.
+func (w *Writer) Flush() error {
+	if w.err != nil || w.count == 0 {
+		return w.err
+	}
+	data := w.block
+	switch w.codec {
+	case CodecDeflate:
+		w.comp.Reset()
+		if w.fw == nil {
+			w.fw, w.err = flate.NewWriter(&w.comp, flate.DefaultCompression)
+			if w.err != nil {
+				return w.err
+			}
+		} else {
+			w.fw.Reset(&w.comp)
+		}
+		if _, err := w.fw.Write(data); err != nil {
+			w.err = err
+			return err
+		}
+		if err := w.fw.Close(); err != nil {
+			w.err = err
+			return err
+		}
+		data = w.comp.Bytes()
+	case CodecSnappy:
+		// Snappy blocks are followed by the CRC32 of the uncompressed data.
+		w.snap = s2.EncodeSnappy(w.snap[:cap(w.snap)], data)
+		var crc [4]byte
+		binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(w.block))
+		w.snap = append(w.snap, crc[:]...)
+		data = w.snap
+	}
+	w.buf = appendLong(w.buf[:0], w.count)
+	w.buf = appendLong(w.buf, int64(len(data)))
+	w.buf = append(w.buf, data...)
+	w.buf = append(w.buf, w.sync[:]...)
+	if _, err := w.w.Write(w.buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.block = w.block[:0]
+	w.count = 0
+	return nil
+}
+
+// Close writes the current block.
+// The underlying writer is not closed.
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = appendLong(dst, int64(len(s)))
+	return append(dst, s...)
+}
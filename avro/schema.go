@@ -0,0 +1,451 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package avro encodes JSON records parsed by simdjson as Apache Avro binary
+// and writes Avro Object Container Files, without converting records to Go values.
+//
+// Records are matched against the schema as plain JSON:
+// union values are not wrapped in an object naming the branch,
+// instead the first branch matching the JSON value is used.
+// Strings are accepted for bytes and fixed values, where each character
+// must be in the range 0-255, following the Avro JSON encoding.
+//
+// The logical types timestamp-millis, timestamp-micros, local-timestamp-millis
+// and local-timestamp-micros accept numbers or RFC 3339 strings,
+// and date accepts numbers or strings like "2006-01-02".
+// Other logical types are encoded as their underlying type.
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Type is an Avro schema type.
+type Type uint8
+
+// Avro schema types.
+const (
+	TypeNull Type = iota
+	TypeBoolean
+	TypeInt
+	TypeLong
+	TypeFloat
+	TypeDouble
+	TypeBytes
+	TypeString
+	TypeRecord
+	TypeEnum
+	TypeArray
+	TypeMap
+	TypeUnion
+	TypeFixed
+)
+
+var typeNames = [...]string{
+	TypeNull:    "null",
+	TypeBoolean: "boolean",
+	TypeInt:     "int",
+	TypeLong:    "long",
+	TypeFloat:   "float",
+	TypeDouble:  "double",
+	TypeBytes:   "bytes",
+	TypeString:  "string",
+	TypeRecord:  "record",
+	TypeEnum:    "enum",
+	TypeArray:   "array",
+	TypeMap:     "map",
+	TypeUnion:   "union",
+	TypeFixed:   "fixed",
+}
+
+// String returns the Avro name of the type.
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return "(invalid)"
+}
+
+// primitives contains the primitive type names.
+var primitives = map[string]Type{
+	"null":    TypeNull,
+	"boolean": TypeBoolean,
+	"int":     TypeInt,
+	"long":    TypeLong,
+	"float":   TypeFloat,
+	"double":  TypeDouble,
+	"bytes":   TypeBytes,
+	"string":  TypeString,
+}
+
+// Schema is a parsed Avro schema.
+// A Schema is immutable and can be used concurrently.
+type Schema struct {
+	typ     Type
+	logical string
+
+	// name is the full name of records, enums and fixed types.
+	name string
+
+	// fields of a record.
+	fields   []field
+	fieldIdx map[string]int
+
+	// symbols of an enum.
+	symbols map[string]int
+
+	// items of arrays and values of maps.
+	items *Schema
+
+	// branches of a union.
+	branches []*Schema
+
+	// size of a fixed type.
+	size int
+
+	// json is the schema as JSON. Only set on the top level schema.
+	json []byte
+}
+
+type field struct {
+	name   string
+	schema *Schema
+
+	hasDefault bool
+	def        simdjson.Iter
+}
+
+// Type returns the type of the schema.
+func (s *Schema) Type() Type {
+	return s.typ
+}
+
+// Name returns the full name of named types.
+func (s *Schema) Name() string {
+	return s.name
+}
+
+// LogicalType returns the logical type, if any.
+func (s *Schema) LogicalType() string {
+	return s.logical
+}
+
+// String returns the schema as JSON.
+func (s *Schema) String() string {
+	return string(s.json)
+}
+
+// ParseSchema parses an Avro schema in JSON form.
+func ParseSchema(schema []byte) (*Schema, error) {
+	// Wrap the schema in an array, since the parser doesn't accept a string as root.
+	// This also keeps a copy, since defaults reference the parsed schema.
+	wrapped := make([]byte, 0, len(schema)+2)
+	wrapped = append(wrapped, '[')
+	wrapped = append(wrapped, schema...)
+	wrapped = append(wrapped, ']')
+	pj, err := simdjson.Parse(wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("avro: parsing schema: %w", err)
+	}
+	iter := pj.Iter()
+	iter.AdvanceInto()
+	if iter.AdvanceInto() != simdjson.TagArrayStart || iter.Advance() == simdjson.TypeNone {
+		return nil, errors.New("avro: empty schema")
+	}
+	p := schemaParser{names: make(map[string]*Schema)}
+	s, err := p.parse(&iter, "")
+	if err != nil {
+		return nil, err
+	}
+	if iter.Advance() != simdjson.TypeNone {
+		return nil, errors.New("avro: schema contains more than one value")
+	}
+	s.json = wrapped[1 : len(wrapped)-1]
+	return s, nil
+}
+
+// schemaParser keeps track of named types while parsing a schema.
+type schemaParser struct {
+	names map[string]*Schema
+}
+
+// parse parses a schema within the enclosing namespace.
+func (p *schemaParser) parse(it *simdjson.Iter, namespace string) (*Schema, error) {
+	switch it.Type() {
+	case simdjson.TypeString:
+		name, err := it.String()
+		if err != nil {
+			return nil, err
+		}
+		return p.lookup(name, namespace)
+	case simdjson.TypeArray:
+		return p.parseUnion(it, namespace)
+	case simdjson.TypeObject:
+		return p.parseObject(it, namespace)
+	}
+	return nil, fmt.Errorf("avro: invalid schema type %v", it.Type())
+}
+
+// lookup returns a primitive or previously defined named type.
+func (p *schemaParser) lookup(name, namespace string) (*Schema, error) {
+	if t, ok := primitives[name]; ok {
+		return &Schema{typ: t}, nil
+	}
+	if s, ok := p.names[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.names[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("avro: unknown type %q", name)
+}
+
+func (p *schemaParser) parseUnion(it *simdjson.Iter, namespace string) (*Schema, error) {
+	arr, err := it.Array(nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{typ: TypeUnion}
+	elems := arr.Iter()
+	for elems.Advance() != simdjson.TypeNone {
+		b, err := p.parse(&elems, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if b.typ == TypeUnion {
+			return nil, errors.New("avro: unions cannot contain unions")
+		}
+		s.branches = append(s.branches, b)
+	}
+	if len(s.branches) == 0 {
+		return nil, errors.New("avro: empty union")
+	}
+	return s, nil
+}
+
+// schemaObject contains the properties of a schema object.
+type schemaObject struct {
+	typ, name, namespace, logical string
+
+	typIter, fields, symbols, items, values simdjson.Iter
+	size                                    int64
+}
+
+func (p *schemaParser) parseObject(it *simdjson.Iter, namespace string) (*Schema, error) {
+	obj, err := it.Object(nil)
+	if err != nil {
+		return nil, err
+	}
+	var o schemaObject
+	var elem simdjson.Iter
+	for {
+		key, t, err := obj.NextElement(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		switch key {
+		case "type":
+			o.typIter = elem
+			if t == simdjson.TypeString {
+				o.typ, err = elem.String()
+			}
+		case "name":
+			o.name, err = elem.String()
+		case "namespace":
+			o.namespace, err = elem.String()
+		case "logicalType":
+			o.logical, err = elem.String()
+		case "fields":
+			o.fields = elem
+		case "symbols":
+			o.symbols = elem
+		case "items":
+			o.items = elem
+		case "values":
+			o.values = elem
+		case "size":
+			o.size, err = elem.Int()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("avro: schema property %q: %w", key, err)
+		}
+	}
+	if o.typ == "" {
+		if o.typIter.Type() == simdjson.TypeNone {
+			return nil, errors.New("avro: schema object without type")
+		}
+		// Nested schema, like {"type": {"type": "array", ...}}
+		return p.parse(&o.typIter, namespace)
+	}
+
+	var s *Schema
+	switch o.typ {
+	case "record", "error":
+		s, err = p.parseRecord(&o, namespace)
+	case "enum":
+		s, err = p.parseEnum(&o, namespace)
+	case "fixed":
+		s = &Schema{typ: TypeFixed, size: int(o.size)}
+		if o.size < 0 {
+			return nil, errors.New("avro: fixed size must be non-negative")
+		}
+		err = p.define(s, &o, namespace)
+	case "array", "map":
+		items := o.items
+		s = &Schema{typ: TypeArray}
+		if o.typ == "map" {
+			items = o.values
+			s.typ = TypeMap
+		}
+		if items.Type() == simdjson.TypeNone {
+			return nil, fmt.Errorf("avro: %s without item type", o.typ)
+		}
+		s.items, err = p.parse(&items, namespace)
+	default:
+		s, err = p.lookup(o.typ, namespace)
+		if err == nil && o.logical != "" {
+			// Don't modify the shared named type.
+			cp := *s
+			s = &cp
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.logical = o.logical
+	return s, nil
+}
+
+// define registers a named type.
+func (p *schemaParser) define(s *Schema, o *schemaObject, namespace string) error {
+	if o.name == "" {
+		return fmt.Errorf("avro: %s without name", o.typ)
+	}
+	if o.namespace != "" {
+		namespace = o.namespace
+	}
+	s.name = fullName(o.name, namespace)
+	if _, ok := p.names[s.name]; ok {
+		return fmt.Errorf("avro: type %q defined twice", s.name)
+	}
+	p.names[s.name] = s
+	return nil
+}
+
+func (p *schemaParser) parseRecord(o *schemaObject, namespace string) (*Schema, error) {
+	s := &Schema{typ: TypeRecord, fieldIdx: make(map[string]int)}
+	// Define before parsing fields to allow recursive types.
+	if err := p.define(s, o, namespace); err != nil {
+		return nil, err
+	}
+	if i := strings.LastIndexByte(s.name, '.'); i >= 0 {
+		namespace = s.name[:i]
+	}
+	if o.fields.Type() != simdjson.TypeArray {
+		return nil, fmt.Errorf("avro: record %q fields must be an array", s.name)
+	}
+	arr, err := o.fields.Array(nil)
+	if err != nil {
+		return nil, err
+	}
+	elems := arr.Iter()
+	for elems.Advance() != simdjson.TypeNone {
+		obj, err := elems.Object(nil)
+		if err != nil {
+			return nil, fmt.Errorf("avro: record %q: field must be an object", s.name)
+		}
+		var f field
+		var typ simdjson.Iter
+		var elem simdjson.Iter
+		for {
+			key, t, err := obj.NextElement(&elem)
+			if err != nil {
+				return nil, err
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			switch key {
+			case "name":
+				f.name, err = elem.String()
+			case "type":
+				typ = elem
+			case "default":
+				f.hasDefault = true
+				f.def = elem
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if f.name == "" {
+			return nil, fmt.Errorf("avro: record %q: field without name", s.name)
+		}
+		if _, ok := s.fieldIdx[f.name]; ok {
+			return nil, fmt.Errorf("avro: record %q: duplicate field %q", s.name, f.name)
+		}
+		if typ.Type() == simdjson.TypeNone {
+			return nil, fmt.Errorf("avro: record %q: field %q without type", s.name, f.name)
+		}
+		f.schema, err = p.parse(&typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.fieldIdx[f.name] = len(s.fields)
+		s.fields = append(s.fields, f)
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseEnum(o *schemaObject, namespace string) (*Schema, error) {
+	s := &Schema{typ: TypeEnum, symbols: make(map[string]int)}
+	if err := p.define(s, o, namespace); err != nil {
+		return nil, err
+	}
+	if o.symbols.Type() != simdjson.TypeArray {
+		return nil, fmt.Errorf("avro: enum %q symbols must be an array", s.name)
+	}
+	arr, err := o.symbols.Array(nil)
+	if err != nil {
+		return nil, err
+	}
+	syms, err := arr.AsString()
+	if err != nil {
+		return nil, fmt.Errorf("avro: enum %q: %w", s.name, err)
+	}
+	for i, sym := range syms {
+		if _, ok := s.symbols[sym]; ok {
+			return nil, fmt.Errorf("avro: enum %q: duplicate symbol %q", s.name, sym)
+		}
+		s.symbols[sym] = i
+	}
+	return s, nil
+}
+
+// fullName returns the full name of name in namespace.
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.ContainsRune(name, '.') {
+		return name
+	}
+	return namespace + "." + name
+}
@@ -18,8 +18,17 @@ import (
 // algorithm, where a single multiplication by 10^k is required,
 // sharing the same rounding guarantees.
 
+type floatInfo struct {
+	mantbits uint
+	expbits  uint
+	bias     int
+}
+
+var float32info = floatInfo{23, 8, -127}
+var float64info = floatInfo{52, 11, -1023}
+
 // ryuFtoaShortest formats mant*2^exp with prec decimal digits.
-func ryuFtoaShortest(d *decimalSlice, mant uint64, exp int) {
+func ryuFtoaShortest(d *decimalSlice, mant uint64, exp int, flt *floatInfo) {
 	if mant == 0 {
 		d.nd, d.dp = 0, 0
 		return
@@ -31,7 +40,7 @@ func ryuFtoaShortest(d *decimalSlice, mant uint64, exp int) {
 		ryuDigits(d, mant, mant, mant, true, false)
 		return
 	}
-	ml, mc, mu, e2 := computeBounds(mant, exp)
+	ml, mc, mu, e2 := computeBounds(mant, exp, flt)
 	if e2 == 0 {
 		ryuDigits(d, ml, mc, mu, true, false)
 		return
@@ -43,9 +52,17 @@ func ryuFtoaShortest(d *decimalSlice, mant uint64, exp int) {
 	// The exponent is the same for all 3 numbers.
 	var dl, dc, du uint64
 	var dl0, dc0, du0 bool
-	dl, _, dl0 = mult128bitPow10(ml, e2, q)
-	dc, _, dc0 = mult128bitPow10(mc, e2, q)
-	du, e2, du0 = mult128bitPow10(mu, e2, q)
+	if flt == &float32info {
+		var dl32, dc32, du32 uint32
+		dl32, _, dl0 = mult64bitPow10(uint32(ml), e2, q)
+		dc32, _, dc0 = mult64bitPow10(uint32(mc), e2, q)
+		du32, e2, du0 = mult64bitPow10(uint32(mu), e2, q)
+		dl, dc, du = uint64(dl32), uint64(dc32), uint64(du32)
+	} else {
+		dl, _, dl0 = mult128bitPow10(ml, e2, q)
+		dc, _, dc0 = mult128bitPow10(mc, e2, q)
+		du, e2, du0 = mult128bitPow10(mu, e2, q)
+	}
 	if e2 >= 0 {
 		panic("not enough significant bits after mult128bitPow10")
 	}
@@ -136,11 +153,8 @@ func mulByLog10Log2(x int) int {
 // computeBounds returns a floating-point vector (l, c, u)×2^e2
 // where the mantissas are 55-bit (or 26-bit) integers, describing the interval
 // represented by the input float64 or float32.
-func computeBounds(mant uint64, exp int) (lower, central, upper uint64, e2 int) {
-	const mantbits = 52
-	const expbits = 11
-	const bias = -1023
-	if mant != 1<<mantbits || exp == bias+1-int(mantbits) {
+func computeBounds(mant uint64, exp int, flt *floatInfo) (lower, central, upper uint64, e2 int) {
+	if mant != 1<<flt.mantbits || exp == flt.bias+1-int(flt.mantbits) {
 		// regular case (or denormals)
 		lower, central, upper = 2*mant-1, 2*mant, 2*mant+1
 		e2 = exp - 1
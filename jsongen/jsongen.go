@@ -0,0 +1,462 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jsongen generates random valid JSON documents and near-valid
+// mutations of them for property-based and load testing.
+package jsongen
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Strings is a set of character classes used in generated strings.
+type Strings uint8
+
+const (
+	// StringsASCII uses printable ASCII characters.
+	StringsASCII Strings = 1 << iota
+
+	// StringsEscapes uses quotes, backslashes and control characters written as escapes.
+	StringsEscapes
+
+	// StringsUnicode uses characters in the Basic Multilingual Plane,
+	// written as UTF-8 or \u escapes.
+	StringsUnicode
+
+	// StringsNonBMP uses characters outside the Basic Multilingual Plane,
+	// written as UTF-8 or escaped surrogate pairs.
+	StringsNonBMP
+
+	// StringsAll uses all character classes.
+	StringsAll = StringsASCII | StringsEscapes | StringsUnicode | StringsNonBMP
+)
+
+// Numbers is a set of number classes.
+type Numbers uint8
+
+const (
+	// NumbersSmall generates small integers.
+	NumbersSmall Numbers = 1 << iota
+
+	// NumbersInt64 generates integers in the int64 range, including values near the limits.
+	NumbersInt64
+
+	// NumbersUint64 generates integers above the int64 range,
+	// including values near and beyond the uint64 limit.
+	NumbersUint64
+
+	// NumbersFloat generates floats with varying precision and exponents,
+	// including subnormals and values near the float64 limits.
+	NumbersFloat
+
+	// NumbersAll generates all number classes.
+	NumbersAll = NumbersSmall | NumbersInt64 | NumbersUint64 | NumbersFloat
+)
+
+// Config controls the generated documents.
+// Zero values are replaced by defaults.
+type Config struct {
+	// MaxDepth is the maximum nesting of objects and arrays. Default 4.
+	MaxDepth int
+
+	// MaxFanout is the maximum number of values in objects and arrays. Default 8.
+	MaxFanout int
+
+	// MaxStringLen is the maximum number of characters in strings and keys. Default 16.
+	MaxStringLen int
+
+	// Strings are the character classes used. Default StringsAll.
+	Strings Strings
+
+	// Numbers are the number classes used. Default NumbersAll.
+	Numbers Numbers
+
+	// Whitespace adds random whitespace between tokens.
+	Whitespace bool
+}
+
+// Generator generates random JSON.
+// A Generator cannot be used concurrently.
+type Generator struct {
+	cfg   Config
+	rng   *rand.Rand
+	b     simdjson.Builder
+	build bool
+	nd    bool
+	str   []byte
+}
+
+// New returns a Generator with the given seed.
+// Generators with the same seed and config produce the same output.
+func New(seed int64, cfg Config) *Generator {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 4
+	}
+	if cfg.MaxFanout <= 0 {
+		cfg.MaxFanout = 8
+	}
+	if cfg.MaxStringLen <= 0 {
+		cfg.MaxStringLen = 16
+	}
+	if cfg.Strings&StringsAll == 0 {
+		cfg.Strings = StringsAll
+	}
+	if cfg.Numbers&NumbersAll == 0 {
+		cfg.Numbers = NumbersAll
+	}
+	return &Generator{cfg: cfg, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Document returns a random JSON object or array and the ParsedJson
+// expected from parsing it.
+// The ParsedJson is only valid until the next call.
+func (g *Generator) Document() ([]byte, *simdjson.ParsedJson, error) {
+	return g.documents(1, false)
+}
+
+// NDJSON returns n random documents separated by newlines and the ParsedJson
+// expected from parsing them with ParseND.
+// The ParsedJson is only valid until the next call.
+func (g *Generator) NDJSON(n int) ([]byte, *simdjson.ParsedJson, error) {
+	return g.documents(n, true)
+}
+
+func (g *Generator) documents(n int, nd bool) ([]byte, *simdjson.ParsedJson, error) {
+	g.b.Reset()
+	g.build, g.nd = true, nd
+	var dst []byte
+	for i := 0; i < n; i++ {
+		dst = g.root(dst)
+		if nd {
+			dst = append(dst, '\n')
+		}
+	}
+	g.build = false
+	pj, err := g.b.Finish()
+	return dst, pj, err
+}
+
+// AppendDocument appends a random JSON object or array to dst
+// without building the expected ParsedJson.
+func (g *Generator) AppendDocument(dst []byte) []byte {
+	g.build, g.nd = false, false
+	return g.root(dst)
+}
+
+// root appends an object or array.
+func (g *Generator) root(dst []byte) []byte {
+	dst = g.space(dst)
+	if g.rng.Intn(2) == 0 {
+		dst = g.object(dst, 1)
+	} else {
+		dst = g.array(dst, 1)
+	}
+	return g.space(dst)
+}
+
+func (g *Generator) space(dst []byte) []byte {
+	if !g.cfg.Whitespace || g.rng.Intn(3) != 0 {
+		return dst
+	}
+	ws := " \t\r\n"
+	if g.nd {
+		ws = " \t\r"
+	}
+	for n := g.rng.Intn(3) + 1; n > 0; n-- {
+		dst = append(dst, ws[g.rng.Intn(len(ws))])
+	}
+	return dst
+}
+
+func (g *Generator) object(dst []byte, depth int) []byte {
+	if g.build {
+		g.b.BeginObject()
+	}
+	dst = append(dst, '{')
+	n := g.rng.Intn(g.cfg.MaxFanout + 1)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = g.space(dst)
+		var k []byte
+		dst, k = g.string(dst)
+		if g.build {
+			g.b.Key(string(k))
+		}
+		dst = g.space(dst)
+		dst = append(dst, ':')
+		dst = g.space(dst)
+		dst = g.value(dst, depth)
+		dst = g.space(dst)
+	}
+	if n == 0 {
+		dst = g.space(dst)
+	}
+	if g.build {
+		g.b.EndObject()
+	}
+	return append(dst, '}')
+}
+
+func (g *Generator) array(dst []byte, depth int) []byte {
+	if g.build {
+		g.b.BeginArray()
+	}
+	dst = append(dst, '[')
+	n := g.rng.Intn(g.cfg.MaxFanout + 1)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = g.space(dst)
+		dst = g.value(dst, depth)
+		dst = g.space(dst)
+	}
+	if n == 0 {
+		dst = g.space(dst)
+	}
+	if g.build {
+		g.b.EndArray()
+	}
+	return append(dst, ']')
+}
+
+func (g *Generator) value(dst []byte, depth int) []byte {
+	kinds := 5
+	if depth < g.cfg.MaxDepth {
+		kinds = 7
+	}
+	switch g.rng.Intn(kinds) {
+	case 0:
+		var s []byte
+		dst, s = g.string(dst)
+		if g.build {
+			g.b.StringBytes(s)
+		}
+		return dst
+	case 1, 2:
+		return g.number(dst)
+	case 3:
+		v := g.rng.Intn(2) == 0
+		if g.build {
+			g.b.Bool(v)
+		}
+		return strconv.AppendBool(dst, v)
+	case 4:
+		if g.build {
+			g.b.Null()
+		}
+		return append(dst, "null"...)
+	case 5:
+		return g.object(dst, depth+1)
+	}
+	return g.array(dst, depth+1)
+}
+
+var shortEscapes = map[byte]byte{'"': '"', '\\': '\\', '/': '/', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t'}
+
+const shortEscapeChars = `"\/bfnrt`
+
+// string appends a JSON string and returns its decoded value.
+// The value is only valid until the next call.
+func (g *Generator) string(dst []byte) ([]byte, []byte) {
+	g.str = g.str[:0]
+	dst = append(dst, '"')
+	var classes []Strings
+	for c := StringsASCII; c <= StringsNonBMP; c <<= 1 {
+		if g.cfg.Strings&c != 0 {
+			classes = append(classes, c)
+		}
+	}
+	for n := g.rng.Intn(g.cfg.MaxStringLen + 1); n > 0; n-- {
+		switch classes[g.rng.Intn(len(classes))] {
+		case StringsASCII:
+			c := byte(0x20 + g.rng.Intn(0x7f-0x20))
+			if c == '"' || c == '\\' {
+				c = ' '
+			}
+			dst = append(dst, c)
+			g.str = append(g.str, c)
+		case StringsEscapes:
+			if g.rng.Intn(2) == 0 {
+				c := shortEscapeChars[g.rng.Intn(len(shortEscapeChars))]
+				dst = append(dst, '\\', c)
+				g.str = append(g.str, shortEscapes[c])
+			} else {
+				c := rune(g.rng.Intn(0x20))
+				dst = g.escape(dst, c)
+				g.str = append(g.str, byte(c))
+			}
+		case StringsUnicode:
+			r := rune(0x80 + g.rng.Intn(0x10000-0x80-0x800))
+			if r >= 0xd800 {
+				// Skip surrogates.
+				r += 0x800
+			}
+			dst = g.rune(dst, r)
+		case StringsNonBMP:
+			r := rune(0x10000 + g.rng.Intn(utf8.MaxRune-0x10000+1))
+			dst = g.rune(dst, r)
+		}
+	}
+	return append(dst, '"'), g.str
+}
+
+// rune appends r as UTF-8 or escaped.
+func (g *Generator) rune(dst []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	enc := tmp[:utf8.EncodeRune(tmp[:], r)]
+	g.str = append(g.str, enc...)
+	if g.rng.Intn(2) == 0 {
+		return append(dst, enc...)
+	}
+	if r < 0x10000 {
+		return g.escape(dst, r)
+	}
+	r -= 0x10000
+	dst = g.escape(dst, 0xd800+(r>>10))
+	return g.escape(dst, 0xdc00+(r&0x3ff))
+}
+
+// escape appends a \u escape of r with random hex case.
+func (g *Generator) escape(dst []byte, r rune) []byte {
+	hex := "0123456789abcdef"
+	if g.rng.Intn(2) == 0 {
+		hex = "0123456789ABCDEF"
+	}
+	return append(dst, '\\', 'u', hex[r>>12&0xf], hex[r>>8&0xf], hex[r>>4&0xf], hex[r&0xf])
+}
+
+var (
+	int64Edges = []int64{
+		math.MinInt64, math.MinInt64 + 1, math.MaxInt64, math.MaxInt64 - 1,
+		1 << 53, 1<<53 + 1, -(1 << 53), -(1<<53 + 1),
+		math.MaxInt32, math.MinInt32, math.MaxUint32, 0,
+	}
+	uint64Edges = []uint64{
+		math.MaxInt64 + 1, math.MaxUint64, math.MaxUint64 - 1,
+	}
+	floatEdges = []string{
+		"1.7976931348623157e308", "-1.7976931348623157e308", "2.2250738585072014e-308",
+		"2.225073858507201e-308", "4.9406564584124654e-324", "5e-324", "1e-400", "-0.0", "0.0",
+		"0.1", "1E+2", "1e-2", "9007199254740993.0", "18446744073709551616", "-9223372036854775809",
+		"123456789012345678901234567890",
+	}
+)
+
+// number appends a random number.
+func (g *Generator) number(dst []byte) []byte {
+	var classes []Numbers
+	for c := NumbersSmall; c <= NumbersFloat; c <<= 1 {
+		if g.cfg.Numbers&c != 0 {
+			classes = append(classes, c)
+		}
+	}
+	switch classes[g.rng.Intn(len(classes))] {
+	case NumbersSmall:
+		return g.int(dst, int64(g.rng.Intn(201)-100))
+	case NumbersInt64:
+		if g.rng.Intn(2) == 0 {
+			return g.int(dst, int64Edges[g.rng.Intn(len(int64Edges))])
+		}
+		v := g.rng.Int63() >> uint(g.rng.Intn(63))
+		if g.rng.Intn(2) == 0 {
+			v = -v
+		}
+		return g.int(dst, v)
+	case NumbersUint64:
+		switch g.rng.Intn(3) {
+		case 0:
+			return g.uint(dst, uint64Edges[g.rng.Intn(len(uint64Edges))])
+		case 1:
+			return g.uint(dst, 1<<63|g.rng.Uint64())
+		}
+		// Beyond uint64, parsed as float.
+		s := strconv.AppendUint(nil, g.rng.Uint64()|1<<63, 10)
+		for n := g.rng.Intn(5) + 1; n > 0; n-- {
+			s = append(s, byte('0'+g.rng.Intn(10)))
+		}
+		return g.float(dst, s)
+	}
+
+	var s []byte
+	switch g.rng.Intn(4) {
+	case 0:
+		s = append(s, floatEdges[g.rng.Intn(len(floatEdges))]...)
+	case 1:
+		// Random bits.
+		f := math.Float64frombits(g.rng.Uint64())
+		for math.IsNaN(f) || math.IsInf(f, 0) {
+			f = math.Float64frombits(g.rng.Uint64())
+		}
+		s = strconv.AppendFloat(s, f, "eEg"[g.rng.Intn(3)], -1, 64)
+		if !bytes.ContainsAny(s, ".eE") {
+			s = append(s, ".0"...)
+		}
+	default:
+		// Decimal with random digits and exponent.
+		if g.rng.Intn(2) == 0 {
+			s = append(s, '-')
+		}
+		s = strconv.AppendInt(s, int64(g.rng.Intn(1000)), 10)
+		s = append(s, '.')
+		for n := g.rng.Intn(17) + 1; n > 0; n-- {
+			s = append(s, byte('0'+g.rng.Intn(10)))
+		}
+		if g.rng.Intn(2) == 0 {
+			s = append(s, "eE"[g.rng.Intn(2)])
+			if g.rng.Intn(2) == 0 {
+				s = append(s, "+-"[g.rng.Intn(2)])
+			}
+			s = strconv.AppendInt(s, int64(g.rng.Intn(300)), 10)
+		}
+	}
+	return g.float(dst, s)
+}
+
+func (g *Generator) int(dst []byte, v int64) []byte {
+	if g.build {
+		g.b.Int(v)
+	}
+	return strconv.AppendInt(dst, v, 10)
+}
+
+func (g *Generator) uint(dst []byte, v uint64) []byte {
+	if g.build {
+		g.b.Uint(v)
+	}
+	return strconv.AppendUint(dst, v, 10)
+}
+
+// float appends a number literal that is stored as a float.
+func (g *Generator) float(dst, s []byte) []byte {
+	f, err := strconv.ParseFloat(string(s), 64)
+	if err != nil {
+		// Out of range, use a value that is not.
+		s, f = []byte("1.5"), 1.5
+	}
+	if g.build {
+		g.b.Float(f)
+	}
+	return append(dst, s...)
+}
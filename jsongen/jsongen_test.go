@@ -0,0 +1,114 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsongen
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+// sameTape checks that got and want contain the same values.
+func sameTape(t *testing.T, input []byte, got, want *simdjson.ParsedJson) {
+	t.Helper()
+	mg, err := simdjson.ComputeMerkle(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw, err := simdjson.ComputeMerkle(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := mg.Diff(mw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) > 0 {
+		t.Fatalf("%s\ndiffers from expected tape: %v", input, changes)
+	}
+}
+
+func TestGenerator_Document(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	g := New(1, Config{Whitespace: true})
+	for i := 0; i < 500; i++ {
+		input, want, err := g.Document()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(input) {
+			t.Fatalf("invalid json: %s", input)
+		}
+		got, err := simdjson.Parse(input, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		sameTape(t, input, got, want)
+	}
+
+	// Same seed, same output.
+	a := New(2, Config{}).AppendDocument(nil)
+	b := New(2, Config{}).AppendDocument(nil)
+	if !bytes.Equal(a, b) {
+		t.Error("output not deterministic")
+	}
+}
+
+func TestGenerator_NDJSON(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	g := New(3, Config{Whitespace: true, MaxDepth: 2, Strings: StringsEscapes | StringsNonBMP, Numbers: NumbersUint64 | NumbersFloat})
+	for i := 0; i < 50; i++ {
+		input, want, err := g.NDJSON(20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := simdjson.ParseND(input, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		sameTape(t, input, got, want)
+	}
+}
+
+func TestGenerator_Mutate(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	g := New(4, Config{Whitespace: true})
+	seen := make(map[Mutation]int)
+	var input, mutated []byte
+	for i := 0; i < 2000; i++ {
+		input = g.AppendDocument(input[:0])
+		var m Mutation
+		mutated, m = g.Mutate(mutated[:0], input)
+		seen[m]++
+		if _, err := simdjson.Parse(mutated, nil); err == nil {
+			t.Fatalf("%v mutation parsed without error:\n%s\n%s", m, input, mutated)
+		}
+	}
+	for m := Mutation(0); m < numMutations; m++ {
+		if seen[m] == 0 {
+			t.Errorf("mutation %v not used", m)
+		}
+	}
+}
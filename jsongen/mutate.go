@@ -0,0 +1,169 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsongen
+
+// Mutation is a change made by Mutate.
+// Every mutation makes a valid document invalid.
+type Mutation uint8
+
+const (
+	// MutateTruncate cuts the document before its end.
+	MutateTruncate Mutation = iota
+
+	// MutateSeparator replaces a comma or colon with a space.
+	MutateSeparator
+
+	// MutateBracket replaces a closing bracket with the other kind.
+	MutateBracket
+
+	// MutateTrailingComma inserts a comma before a closing bracket.
+	MutateTrailingComma
+
+	// MutateControlChar inserts an unescaped control character in a string.
+	MutateControlChar
+
+	// MutateEscape inserts an invalid escape sequence in a string.
+	MutateEscape
+
+	// MutateLiteral misspells true, false or null.
+	MutateLiteral
+
+	// MutateNumber appends a dangling '.' or exponent to a number.
+	MutateNumber
+
+	numMutations
+)
+
+// String returns the name of the mutation.
+func (m Mutation) String() string {
+	switch m {
+	case MutateTruncate:
+		return "truncate"
+	case MutateSeparator:
+		return "separator"
+	case MutateBracket:
+		return "bracket"
+	case MutateTrailingComma:
+		return "trailing comma"
+	case MutateControlChar:
+		return "control character"
+	case MutateEscape:
+		return "escape"
+	case MutateLiteral:
+		return "literal"
+	case MutateNumber:
+		return "number"
+	}
+	return "(invalid)"
+}
+
+// Mutate appends a near-valid copy of src to dst, where a single random
+// mutation makes the document invalid, and returns the mutation used.
+// src must be a valid JSON object or array, for example from Document.
+func (g *Generator) Mutate(dst, src []byte) ([]byte, Mutation) {
+	// Collect the positions each mutation can be applied at.
+	var pos [numMutations][]int
+	last := 0
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if inString {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+			// Insert after the opening quote.
+			pos[MutateControlChar] = append(pos[MutateControlChar], i+1)
+		case ',', ':':
+			pos[MutateSeparator] = append(pos[MutateSeparator], i)
+		case ']', '}':
+			pos[MutateBracket] = append(pos[MutateBracket], i)
+			pos[MutateTrailingComma] = append(pos[MutateTrailingComma], i)
+		case 't', 'f', 'n':
+			pos[MutateLiteral] = append(pos[MutateLiteral], i)
+		case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			if i+1 == len(src) || !isNumberChar(src[i+1]) {
+				// Append after the last character.
+				pos[MutateNumber] = append(pos[MutateNumber], i+1)
+			}
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			last = i
+		}
+	}
+	if last > 0 {
+		pos[MutateTruncate] = []int{1 + g.rng.Intn(last)}
+	}
+	pos[MutateEscape] = pos[MutateControlChar]
+
+	var avail []Mutation
+	for m := range pos {
+		if len(pos[m]) > 0 {
+			avail = append(avail, Mutation(m))
+		}
+	}
+	if len(avail) == 0 {
+		// Not a valid object or array, so no valid mutation.
+		return append(dst, src...), MutateTruncate
+	}
+	m := avail[g.rng.Intn(len(avail))]
+	at := pos[m][g.rng.Intn(len(pos[m]))]
+	switch m {
+	case MutateTruncate:
+		return append(dst, src[:at]...), m
+	case MutateSeparator:
+		return replaceAt(dst, src, at, ' '), m
+	case MutateBracket:
+		if src[at] == ']' {
+			return replaceAt(dst, src, at, '}'), m
+		}
+		return replaceAt(dst, src, at, ']'), m
+	case MutateTrailingComma:
+		return insertAt(dst, src, at, ","), m
+	case MutateControlChar:
+		return insertAt(dst, src, at, string(rune(g.rng.Intn(0x20)))), m
+	case MutateEscape:
+		return insertAt(dst, src, at, `\x`), m
+	case MutateLiteral:
+		// Upper case first letter.
+		return replaceAt(dst, src, at, src[at]-'a'+'A'), m
+	}
+	return insertAt(dst, src, at, []string{".", "e", "e+"}[g.rng.Intn(3)]), m
+}
+
+func isNumberChar(c byte) bool {
+	return c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-'
+}
+
+func replaceAt(dst, src []byte, at int, c byte) []byte {
+	dst = append(dst, src[:at]...)
+	dst = append(dst, c)
+	return append(dst, src[at+1:]...)
+}
+
+func insertAt(dst, src []byte, at int, s string) []byte {
+	dst = append(dst, src[:at]...)
+	dst = append(dst, s...)
+	return append(dst, src[at:]...)
+}
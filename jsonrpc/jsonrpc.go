@@ -0,0 +1,479 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jsonrpc provides JSON-RPC 2.0 request parsing and
+// response building on top of the simdjson tape.
+//
+// Requests are parsed with Parse, which handles single and batch requests
+// and validates the envelope of each request.
+// Params are available as a simdjson.Iter for typed decoding.
+//
+// Responses are built with a ResponseWriter, which will not emit responses
+// for notifications, as required by the specification.
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Version is the only supported protocol version.
+const Version = "2.0"
+
+// Error codes defined by the specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int
+	Message string
+
+	// Data is optional additional information.
+	// Any type supported by simdjson.Builder.Interface can be used.
+	// If nil, no data is sent.
+	Data interface{}
+}
+
+// Error returns the error as a string.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+// NewError returns an error with the specified code and message.
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// ErrParse returns a parse error with the supplied detail as data.
+func ErrParse(detail string) *Error {
+	return &Error{Code: CodeParseError, Message: "Parse error", Data: detail}
+}
+
+// ErrInvalidRequest returns an invalid request error with the supplied detail as data.
+func ErrInvalidRequest(detail string) *Error {
+	return &Error{Code: CodeInvalidRequest, Message: "Invalid Request", Data: detail}
+}
+
+// ErrMethodNotFound returns a method not found error for the method.
+func ErrMethodNotFound(method string) *Error {
+	return &Error{Code: CodeMethodNotFound, Message: "Method not found", Data: method}
+}
+
+// ErrInvalidParams returns an invalid params error with the supplied detail as data.
+func ErrInvalidParams(detail string) *Error {
+	return &Error{Code: CodeInvalidParams, Message: "Invalid params", Data: detail}
+}
+
+// ErrInternal returns an internal error with the supplied detail as data.
+func ErrInternal(detail string) *Error {
+	return &Error{Code: CodeInternalError, Message: "Internal error", Data: detail}
+}
+
+// ID is a request id.
+// It can be a string, a number or null.
+// The zero value is an absent id, used for notifications.
+type ID struct {
+	typ simdjson.Type
+	s   string
+	i   int64
+	u   uint64
+	f   float64
+}
+
+// NullID returns a null id.
+func NullID() ID {
+	return ID{typ: simdjson.TypeNull}
+}
+
+// StringID returns a string id.
+func StringID(s string) ID {
+	return ID{typ: simdjson.TypeString, s: s}
+}
+
+// IntID returns a numeric id.
+func IntID(v int64) ID {
+	return ID{typ: simdjson.TypeInt, i: v}
+}
+
+// Type returns the type of the id.
+// TypeNone is returned if the id is absent.
+func (id ID) Type() simdjson.Type {
+	return id.typ
+}
+
+// Value returns the id as string, int64, uint64, float64 or nil.
+func (id ID) Value() interface{} {
+	switch id.typ {
+	case simdjson.TypeString:
+		return id.s
+	case simdjson.TypeInt:
+		return id.i
+	case simdjson.TypeUint:
+		return id.u
+	case simdjson.TypeFloat:
+		return id.f
+	}
+	return nil
+}
+
+// String returns the id as it would be encoded in JSON.
+// An absent id returns an empty string.
+func (id ID) String() string {
+	switch id.typ {
+	case simdjson.TypeString:
+		return strconv.Quote(id.s)
+	case simdjson.TypeInt:
+		return strconv.FormatInt(id.i, 10)
+	case simdjson.TypeUint:
+		return strconv.FormatUint(id.u, 10)
+	case simdjson.TypeFloat:
+		return strconv.FormatFloat(id.f, 'g', -1, 64)
+	case simdjson.TypeNull:
+		return "null"
+	}
+	return ""
+}
+
+// write the id to b. Absent ids are written as null.
+func (id ID) write(b *simdjson.Builder) {
+	switch id.typ {
+	case simdjson.TypeString:
+		b.String(id.s)
+	case simdjson.TypeInt:
+		b.Int(id.i)
+	case simdjson.TypeUint:
+		b.Uint(id.u)
+	case simdjson.TypeFloat:
+		b.Float(id.f)
+	default:
+		b.Null()
+	}
+}
+
+// Request is a single parsed request.
+type Request struct {
+	// ID of the request.
+	ID ID
+
+	// Method to invoke.
+	Method string
+
+	// Params contains the parameters.
+	// If params were omitted Params.Type() returns TypeNone,
+	// otherwise it is TypeObject or TypeArray.
+	// The Iter is only valid as long as the tape is not reused.
+	Params simdjson.Iter
+
+	// Err is set if the request is invalid.
+	// It should be sent as the response to the request.
+	Err *Error
+}
+
+// IsNotification returns whether the request is a notification.
+// Notifications have no id and must not be answered.
+func (r *Request) IsNotification() bool {
+	return r.ID.typ == simdjson.TypeNone
+}
+
+// Requests contains parsed requests.
+type Requests struct {
+	// Batch is set if the requests were sent as a batch.
+	Batch bool
+
+	// List contains all requests.
+	// Invalid requests in a batch have Err set.
+	List []Request
+
+	pj *simdjson.ParsedJson
+}
+
+// ParsedJson returns the tape backing the requests.
+// It can be reused for the next call to Parse when the requests are no longer used.
+func (r *Requests) ParsedJson() *simdjson.ParsedJson {
+	return r.pj
+}
+
+// Parse parses a single or batch request.
+// An optional tape can be supplied for reuse.
+// If the input cannot be parsed, or the envelope is invalid at the top level,
+// an *Error is returned which should be sent as the only response.
+// Invalid requests within a batch are returned with Err set.
+func Parse(b []byte, reuse *simdjson.ParsedJson) (*Requests, error) {
+	pj, err := simdjson.Parse(b, reuse)
+	if err != nil {
+		return nil, ErrParse(err.Error())
+	}
+	res := Requests{pj: pj}
+	iter := pj.Iter()
+	iter.AdvanceInto()
+	var tmp simdjson.Iter
+	typ, root, err := iter.Root(&tmp)
+	if err != nil {
+		return nil, ErrParse(err.Error())
+	}
+	switch typ {
+	case simdjson.TypeObject:
+		res.List = append(res.List, parseRequest(root))
+	case simdjson.TypeArray:
+		res.Batch = true
+		arr, err := root.Array(nil)
+		if err != nil {
+			return nil, ErrParse(err.Error())
+		}
+		ai := arr.Iter()
+		for {
+			var elem simdjson.Iter
+			t, err := ai.AdvanceIter(&elem)
+			if err != nil {
+				return nil, ErrParse(err.Error())
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			if t != simdjson.TypeObject {
+				res.List = append(res.List, Request{ID: NullID(), Err: ErrInvalidRequest("request must be an object")})
+				continue
+			}
+			res.List = append(res.List, parseRequest(&elem))
+		}
+		if len(res.List) == 0 {
+			return nil, ErrInvalidRequest("empty batch")
+		}
+	default:
+		return nil, ErrInvalidRequest("request must be an object or array")
+	}
+	return &res, nil
+}
+
+// parseRequest will parse a single request object.
+func parseRequest(i *simdjson.Iter) Request {
+	var req Request
+	obj, err := i.Object(nil)
+	if err != nil {
+		return Request{ID: NullID(), Err: ErrInvalidRequest(err.Error())}
+	}
+	var version, method bool
+	var elem simdjson.Iter
+	// Report the first problem found.
+	invalid := func(detail string) {
+		if req.Err == nil {
+			req.Err = ErrInvalidRequest(detail)
+		}
+	}
+	for {
+		name, t, err := obj.NextElementBytes(&elem)
+		if err != nil {
+			return Request{ID: NullID(), Err: ErrInvalidRequest(err.Error())}
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		switch string(name) {
+		case "jsonrpc":
+			v, err := elem.StringBytes()
+			if err != nil || string(v) != Version {
+				invalid(`"jsonrpc" must be "2.0"`)
+			}
+			version = true
+		case "id":
+			req.ID, err = parseID(&elem)
+			if err != nil {
+				invalid(err.Error())
+			}
+		case "method":
+			req.Method, err = elem.String()
+			if err != nil {
+				invalid(`"method" must be a string`)
+			}
+			method = true
+		case "params":
+			if t != simdjson.TypeObject && t != simdjson.TypeArray {
+				invalid(`"params" must be an object or array`)
+				continue
+			}
+			req.Params = elem
+		}
+	}
+	if !version {
+		invalid(`"jsonrpc" member missing`)
+	}
+	if !method {
+		invalid(`"method" member missing`)
+	}
+	if req.Err != nil && req.ID.typ == simdjson.TypeNone {
+		// Invalid requests are always answered.
+		req.ID = NullID()
+	}
+	return req
+}
+
+func parseID(i *simdjson.Iter) (ID, error) {
+	var err error
+	id := ID{typ: i.Type()}
+	switch id.typ {
+	case simdjson.TypeString:
+		id.s, err = i.String()
+	case simdjson.TypeInt:
+		id.i, err = i.Int()
+	case simdjson.TypeUint:
+		id.u, err = i.Uint()
+	case simdjson.TypeFloat:
+		id.f, err = i.Float()
+	case simdjson.TypeNull:
+	default:
+		return NullID(), errors.New(`"id" must be a string, number or null`)
+	}
+	if err != nil {
+		return NullID(), err
+	}
+	return id, nil
+}
+
+// ResponseWriter builds responses.
+// For batches all responses are collected into an array.
+type ResponseWriter struct {
+	b     simdjson.Builder
+	batch bool
+	done  bool
+	n     int
+	err   error
+}
+
+// NewResponseWriter creates a ResponseWriter.
+// If batch is set responses are written as an array.
+func NewResponseWriter(batch bool) *ResponseWriter {
+	w := &ResponseWriter{}
+	w.Reset(batch)
+	return w
+}
+
+// Reset the writer so it can be reused.
+func (w *ResponseWriter) Reset(batch bool) {
+	w.b.Reset()
+	w.batch = batch
+	w.n = 0
+	w.done = false
+	w.err = nil
+	if batch {
+		w.b.BeginArray()
+	}
+}
+
+// Result adds a successful response to req.
+// fn should write exactly one value to b, which will be the result.
+// If req is a notification nothing is written and fn is not called.
+func (w *ResponseWriter) Result(req *Request, fn func(b *simdjson.Builder)) {
+	if req.IsNotification() || !w.begin() {
+		return
+	}
+	b := &w.b
+	b.BeginObject()
+	b.Key("jsonrpc")
+	b.String(Version)
+	b.Key("result")
+	fn(b)
+	b.Key("id")
+	req.ID.write(b)
+	b.EndObject()
+}
+
+// Error adds an error response.
+// If req is nil, the response will have a null id, as required for
+// errors returned by Parse.
+// If req is a notification nothing is written.
+func (w *ResponseWriter) Error(req *Request, e *Error) {
+	id := NullID()
+	if req != nil {
+		if req.IsNotification() {
+			return
+		}
+		id = req.ID
+	}
+	if !w.begin() {
+		return
+	}
+	b := &w.b
+	b.BeginObject()
+	b.Key("jsonrpc")
+	b.String(Version)
+	b.Key("error")
+	b.BeginObject()
+	b.Key("code")
+	b.Int(int64(e.Code))
+	b.Key("message")
+	b.String(e.Message)
+	if e.Data != nil {
+		b.Key("data")
+		b.Interface(e.Data)
+	}
+	b.EndObject()
+	b.Key("id")
+	id.write(b)
+	b.EndObject()
+}
+
+func (w *ResponseWriter) begin() bool {
+	if w.err != nil {
+		return false
+	}
+	if w.done {
+		w.err = errors.New("jsonrpc: response added after AppendJSON")
+		return false
+	}
+	if !w.batch && w.n > 0 {
+		w.err = errors.New("jsonrpc: multiple responses to single request")
+		return false
+	}
+	w.n++
+	return true
+}
+
+// Len returns the number of responses written.
+func (w *ResponseWriter) Len() int {
+	return w.n
+}
+
+// AppendJSON appends the responses as JSON to dst.
+// If there are no responses, for example when only notifications
+// were received, nothing is appended and nothing should be sent.
+// No more responses can be added until the writer is reset.
+func (w *ResponseWriter) AppendJSON(dst []byte) ([]byte, error) {
+	if w.err != nil {
+		return dst, w.err
+	}
+	if w.n == 0 {
+		return dst, nil
+	}
+	if w.batch && !w.done {
+		w.b.EndArray()
+	}
+	w.done = true
+	pj, err := w.b.Finish()
+	if err != nil {
+		return dst, err
+	}
+	iter := pj.Iter()
+	return iter.MarshalJSONBuffer(dst)
+}
@@ -0,0 +1,286 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsonrpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+// serve is a minimal server with "subtract", "sum" and "notify" methods.
+func serve(t *testing.T, in string) string {
+	t.Helper()
+	reqs, err := Parse([]byte(in), nil)
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Fatalf("unexpected error type %T", err)
+		}
+		w := NewResponseWriter(false)
+		w.Error(nil, e)
+		out, err := w.AppendJSON(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	w := NewResponseWriter(reqs.Batch)
+	for i := range reqs.List {
+		req := &reqs.List[i]
+		if req.Err != nil {
+			w.Error(req, req.Err)
+			continue
+		}
+		switch req.Method {
+		case "subtract":
+			var a, b int64
+			switch req.Params.Type() {
+			case simdjson.TypeArray:
+				arr, err := req.Params.Array(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				v, err := arr.AsInteger()
+				if err != nil || len(v) != 2 {
+					w.Error(req, ErrInvalidParams("want 2 integers"))
+					continue
+				}
+				a, b = v[0], v[1]
+			case simdjson.TypeObject:
+				obj, err := req.Params.Object(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ea := obj.FindKey("minuend", nil)
+				eb := obj.FindKey("subtrahend", nil)
+				if ea == nil || eb == nil {
+					w.Error(req, ErrInvalidParams("missing members"))
+					continue
+				}
+				a, _ = ea.Iter.Int()
+				b, _ = eb.Iter.Int()
+			default:
+				w.Error(req, ErrInvalidParams("params required"))
+				continue
+			}
+			w.Result(req, func(b2 *simdjson.Builder) { b2.Int(a - b) })
+		case "sum":
+			arr, err := req.Params.Array(nil)
+			if err != nil {
+				w.Error(req, ErrInvalidParams(err.Error()))
+				continue
+			}
+			v, _ := arr.AsInteger()
+			var sum int64
+			for _, x := range v {
+				sum += x
+			}
+			w.Result(req, func(b *simdjson.Builder) { b.Int(sum) })
+		case "notify":
+			w.Result(req, func(b *simdjson.Builder) { b.Null() })
+		default:
+			w.Error(req, &Error{Code: CodeMethodNotFound, Message: "Method not found"})
+		}
+	}
+	out, err := w.AppendJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSpecExamples(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "positional",
+			in:   `{"jsonrpc": "2.0", "method": "subtract", "params": [42, 23], "id": 1}`,
+			want: `{"jsonrpc":"2.0","result":19,"id":1}`,
+		},
+		{
+			name: "named",
+			in:   `{"jsonrpc": "2.0", "method": "subtract", "params": {"subtrahend": 23, "minuend": 42}, "id": "abc"}`,
+			want: `{"jsonrpc":"2.0","result":19,"id":"abc"}`,
+		},
+		{
+			name: "notification",
+			in:   `{"jsonrpc": "2.0", "method": "notify", "params": [1,2,3,4,5]}`,
+			want: ``,
+		},
+		{
+			name: "method-not-found",
+			in:   `{"jsonrpc": "2.0", "method": "foobar", "id": "1"}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":"1"}`,
+		},
+		{
+			name: "invalid-json",
+			in:   `{"jsonrpc": "2.0", "method": "foobar, "params": "bar", "baz]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":`,
+		},
+		{
+			name: "invalid-request",
+			in:   `{"jsonrpc": "2.0", "method": 1, "params": "bar"}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"\"method\" must be a string"},"id":null}`,
+		},
+		{
+			name: "invalid-params-type",
+			in:   `{"jsonrpc": "2.0", "method": "sum", "params": "bar", "id": 7}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"\"params\" must be an object or array"},"id":7}`,
+		},
+		{
+			name: "wrong-version",
+			in:   `{"jsonrpc": "1.0", "method": "sum", "id": 7}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"\"jsonrpc\" must be \"2.0\""},"id":7}`,
+		},
+		{
+			name: "invalid-id",
+			in:   `{"jsonrpc": "2.0", "method": "sum", "id": [1]}`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"\"id\" must be a string, number or null"},"id":null}`,
+		},
+		{
+			name: "empty-batch",
+			in:   `[]`,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"empty batch"},"id":null}`,
+		},
+		{
+			name: "invalid-batch",
+			in:   `[1,2]`,
+			want: `[{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"request must be an object"},"id":null},{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"request must be an object"},"id":null}]`,
+		},
+		{
+			name: "batch",
+			in: `[
+        {"jsonrpc": "2.0", "method": "sum", "params": [1,2,4], "id": "1"},
+        {"jsonrpc": "2.0", "method": "notify", "params": [7]},
+        {"jsonrpc": "2.0", "method": "subtract", "params": [42,23], "id": 2},
+        {"foo": "boo"},
+        {"jsonrpc": "2.0", "method": "foo.get", "params": {"name": "myself"}, "id": 5.5}
+    ]`,
+			want: `[{"jsonrpc":"2.0","result":7,"id":"1"},{"jsonrpc":"2.0","result":19,"id":2},{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"\"jsonrpc\" member missing"},"id":null},{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":5.5}]`,
+		},
+		{
+			name: "batch-notifications",
+			in:   `[{"jsonrpc": "2.0", "method": "notify", "params": [1,2,4]},{"jsonrpc": "2.0", "method": "notify"}]`,
+			want: ``,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serve(t, tt.in)
+			if tt.name == "invalid-json" {
+				// Data contains parser error
+				if len(got) < len(tt.want) || got[:len(tt.want)] != tt.want {
+					t.Fatalf("got  %s\nwant %s...", got, tt.want)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestParams(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	reqs, err := Parse([]byte(`{"jsonrpc":"2.0","method":"x","id":18446744073709551615}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := reqs.List[0]
+	if req.Err != nil {
+		t.Fatal(req.Err)
+	}
+	if req.Params.Type() != simdjson.TypeNone {
+		t.Errorf("want no params, got %v", req.Params.Type())
+	}
+	if req.IsNotification() {
+		t.Error("should not be notification")
+	}
+	if req.ID.Value() != uint64(18446744073709551615) || req.ID.String() != "18446744073709551615" {
+		t.Errorf("unexpected id %v", req.ID)
+	}
+
+	// Reuse tape
+	reqs, err = Parse([]byte(`{"jsonrpc":"2.0","method":"y","params":{"a":[1,2]},"id":null}`), reqs.ParsedJson())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = reqs.List[0]
+	if req.Method != "y" || req.ID.Type() != simdjson.TypeNull || req.IsNotification() {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	got, err := req.Params.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"a":[1,2]}` {
+		t.Errorf("unexpected params: %s", got)
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	w := NewResponseWriter(false)
+	req := Request{ID: StringID("a")}
+	w.Result(&req, func(b *simdjson.Builder) {
+		b.BeginObject()
+		b.Key("ok")
+		b.Bool(true)
+		b.EndObject()
+	})
+	out, err := w.AppendJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"jsonrpc":"2.0","result":{"ok":true},"id":"a"}` {
+		t.Errorf("got %s", out)
+	}
+
+	// Only one response for single requests.
+	w.Reset(false)
+	w.Result(&req, func(b *simdjson.Builder) { b.Null() })
+	w.Error(&req, ErrInternal("x"))
+	if _, err = w.AppendJSON(nil); err == nil {
+		t.Error("expected error")
+	}
+
+	// Result must write a value.
+	w.Reset(false)
+	w.Result(&req, func(b *simdjson.Builder) {})
+	if _, err = w.AppendJSON(nil); err == nil {
+		t.Error("expected error")
+	}
+
+	// Structured error data.
+	w.Reset(true)
+	w.Error(&Request{ID: IntID(3)}, &Error{Code: 1, Message: "m", Data: map[string]interface{}{"a": []interface{}{1, "b"}}})
+	out, err = w.AppendJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `[{"jsonrpc":"2.0","error":{"code":1,"message":"m","data":{"a":[1,"b"]}},"id":3}]` {
+		t.Errorf("got %s", out)
+	}
+}
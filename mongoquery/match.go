@@ -0,0 +1,477 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mongoquery
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/minio/simdjson-go"
+)
+
+// docMatcher matches a document.
+type docMatcher interface {
+	matchDoc(doc *simdjson.Iter) (bool, error)
+}
+
+// andMatcher matches if all matchers match.
+type andMatcher []docMatcher
+
+func (m andMatcher) matchDoc(doc *simdjson.Iter) (bool, error) {
+	for _, sub := range m {
+		ok, err := sub.matchDoc(doc)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// orMatcher matches if any matcher matches.
+type orMatcher []docMatcher
+
+func (m orMatcher) matchDoc(doc *simdjson.Iter) (bool, error) {
+	for _, sub := range m {
+		ok, err := sub.matchDoc(doc)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// norMatcher matches if no matcher matches.
+type norMatcher []docMatcher
+
+func (m norMatcher) matchDoc(doc *simdjson.Iter) (bool, error) {
+	ok, err := orMatcher(m).matchDoc(doc)
+	return !ok && err == nil, err
+}
+
+// fieldMatcher matches if all operators match the values at path.
+type fieldMatcher struct {
+	path []string
+	ops  []fieldOp
+}
+
+func (m *fieldMatcher) matchDoc(doc *simdjson.Iter) (bool, error) {
+	var tmp [4]simdjson.Iter
+	vals, err := resolve(tmp[:0], *doc, m.path)
+	if err != nil {
+		return false, err
+	}
+	for _, op := range m.ops {
+		ok, err := op.match(vals)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// resolve appends all values found at path to dst.
+// Objects inside arrays are searched for the remaining path,
+// unless the path element is an array index.
+func resolve(dst []simdjson.Iter, it simdjson.Iter, path []string) ([]simdjson.Iter, error) {
+	if len(path) == 0 {
+		return append(dst, it), nil
+	}
+	switch it.Type() {
+	case simdjson.TypeObject:
+		var o simdjson.Object
+		obj, err := it.Object(&o)
+		if err != nil {
+			return dst, err
+		}
+		var elem simdjson.Iter
+		for {
+			name, t, err := obj.NextElementBytes(&elem)
+			if err != nil || t == simdjson.TypeNone {
+				return dst, err
+			}
+			if string(name) == path[0] {
+				return resolve(dst, elem, path[1:])
+			}
+		}
+	case simdjson.TypeArray:
+		var a simdjson.Array
+		arr, err := it.Array(&a)
+		if err != nil {
+			return dst, err
+		}
+		idx, isIdx := arrayIndex(path[0])
+		elems := arr.Iter()
+		for n := 0; elems.Advance() != simdjson.TypeNone; n++ {
+			switch {
+			case isIdx:
+				if n == idx {
+					return resolve(dst, elems, path[1:])
+				}
+			case elems.Type() == simdjson.TypeObject:
+				dst, err = resolve(dst, elems, path)
+				if err != nil {
+					return dst, err
+				}
+			}
+		}
+	}
+	return dst, nil
+}
+
+// fieldOp is an operator applied to the values of a field.
+// vals is empty if the field is missing.
+type fieldOp interface {
+	match(vals []simdjson.Iter) (bool, error)
+}
+
+// anyValue returns whether fn returns true for any value or any element of an array value.
+func anyValue(vals []simdjson.Iter, fn func(it *simdjson.Iter) (bool, error)) (bool, error) {
+	for i := range vals {
+		ok, err := fn(&vals[i])
+		if err != nil || ok {
+			return ok, err
+		}
+		if vals[i].Type() != simdjson.TypeArray {
+			continue
+		}
+		var a simdjson.Array
+		arr, err := vals[i].Array(&a)
+		if err != nil {
+			return false, err
+		}
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			elem := elems
+			ok, err := fn(&elem)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// eqOp implements $eq.
+// Null also matches missing fields.
+type eqOp struct {
+	v value
+}
+
+func (o eqOp) match(vals []simdjson.Iter) (bool, error) {
+	if len(vals) == 0 {
+		return o.v.t == simdjson.TypeNull, nil
+	}
+	return anyValue(vals, func(it *simdjson.Iter) (bool, error) {
+		return equal(it, &o.v)
+	})
+}
+
+// notOp matches if not all operators match.
+type notOp []fieldOp
+
+func (o notOp) match(vals []simdjson.Iter) (bool, error) {
+	for _, op := range o {
+		ok, err := op.match(vals)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type cmpKind uint8
+
+const (
+	cmpGt cmpKind = iota
+	cmpGte
+	cmpLt
+	cmpLte
+)
+
+var cmpOps = map[string]cmpKind{
+	"$gt":  cmpGt,
+	"$gte": cmpGte,
+	"$lt":  cmpLt,
+	"$lte": cmpLte,
+}
+
+// cmpOp implements $gt, $gte, $lt and $lte.
+type cmpOp struct {
+	op cmpKind
+	v  value
+}
+
+func (o cmpOp) match(vals []simdjson.Iter) (bool, error) {
+	return anyValue(vals, func(it *simdjson.Iter) (bool, error) {
+		c, ok, err := compare(it, &o.v)
+		if err != nil || !ok {
+			return false, err
+		}
+		switch o.op {
+		case cmpGt:
+			return c > 0, nil
+		case cmpGte:
+			return c >= 0, nil
+		case cmpLt:
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	})
+}
+
+// inOp implements $in.
+type inOp struct {
+	vals []value
+}
+
+func (o inOp) match(vals []simdjson.Iter) (bool, error) {
+	if len(vals) == 0 {
+		for i := range o.vals {
+			if o.vals[i].t == simdjson.TypeNull {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return anyValue(vals, func(it *simdjson.Iter) (bool, error) {
+		for i := range o.vals {
+			ok, err := equal(it, &o.vals[i])
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// existsOp implements $exists.
+type existsOp struct {
+	want bool
+}
+
+func (o existsOp) match(vals []simdjson.Iter) (bool, error) {
+	return (len(vals) > 0) == o.want, nil
+}
+
+// typeOp implements $type.
+type typeOp struct {
+	mask uint32
+}
+
+func (o typeOp) match(vals []simdjson.Iter) (bool, error) {
+	return anyValue(vals, func(it *simdjson.Iter) (bool, error) {
+		return o.mask&(1<<it.Type()) != 0, nil
+	})
+}
+
+// regexOp implements $regex.
+type regexOp struct {
+	re *regexp.Regexp
+}
+
+func (o regexOp) match(vals []simdjson.Iter) (bool, error) {
+	return anyValue(vals, func(it *simdjson.Iter) (bool, error) {
+		if it.Type() != simdjson.TypeString {
+			return false, nil
+		}
+		b, err := it.StringBytes()
+		if err != nil {
+			return false, err
+		}
+		return o.re.Match(b), nil
+	})
+}
+
+// elemMatchOp implements $elemMatch.
+// Either ops or doc is set.
+type elemMatchOp struct {
+	ops []fieldOp
+	doc docMatcher
+}
+
+func (o elemMatchOp) match(vals []simdjson.Iter) (bool, error) {
+	for i := range vals {
+		if vals[i].Type() != simdjson.TypeArray {
+			continue
+		}
+		var a simdjson.Array
+		arr, err := vals[i].Array(&a)
+		if err != nil {
+			return false, err
+		}
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			ok, err := o.matchElem(elems)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (o elemMatchOp) matchElem(elem simdjson.Iter) (bool, error) {
+	if o.doc != nil {
+		if elem.Type() != simdjson.TypeObject {
+			return false, nil
+		}
+		return o.doc.matchDoc(&elem)
+	}
+	single := []simdjson.Iter{elem}
+	for _, op := range o.ops {
+		ok, err := op.match(single)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sizeOp implements $size.
+type sizeOp struct {
+	n int
+}
+
+func (o sizeOp) match(vals []simdjson.Iter) (bool, error) {
+	for i := range vals {
+		if vals[i].Type() != simdjson.TypeArray {
+			continue
+		}
+		var a simdjson.Array
+		arr, err := vals[i].Array(&a)
+		if err != nil {
+			return false, err
+		}
+		n := 0
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			n++
+		}
+		if n == o.n {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// equal returns whether the value of it equals v.
+func equal(it *simdjson.Iter, v *value) (bool, error) {
+	t := it.Type()
+	switch v.t {
+	case simdjson.TypeNull:
+		return t == simdjson.TypeNull, nil
+	case simdjson.TypeBool:
+		if t != simdjson.TypeBool {
+			return false, nil
+		}
+		b, err := it.Bool()
+		return b == v.b, err
+	case simdjson.TypeString:
+		if t != simdjson.TypeString {
+			return false, nil
+		}
+		b, err := it.StringBytes()
+		return string(b) == v.s, err
+	case simdjson.TypeInt, simdjson.TypeUint, simdjson.TypeFloat:
+		c, ok, err := compare(it, v)
+		return ok && c == 0, err
+	case simdjson.TypeArray:
+		if t != simdjson.TypeArray {
+			return false, nil
+		}
+		var a simdjson.Array
+		arr, err := it.Array(&a)
+		if err != nil {
+			return false, err
+		}
+		elems := arr.Iter()
+		n := 0
+		for elems.Advance() != simdjson.TypeNone {
+			if n >= len(v.arr) {
+				return false, nil
+			}
+			ok, err := equal(&elems, &v.arr[n])
+			if err != nil || !ok {
+				return false, err
+			}
+			n++
+		}
+		return n == len(v.arr), nil
+	case simdjson.TypeObject:
+		if t != simdjson.TypeObject {
+			return false, nil
+		}
+		var o simdjson.Object
+		obj, err := it.Object(&o)
+		if err != nil {
+			return false, err
+		}
+		var elem simdjson.Iter
+		n := 0
+		for {
+			name, t, err := obj.NextElementBytes(&elem)
+			if err != nil {
+				return false, err
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			if n >= len(v.keys) || string(name) != v.keys[n] {
+				return false, nil
+			}
+			ok, err := equal(&elem, &v.arr[n])
+			if err != nil || !ok {
+				return false, err
+			}
+			n++
+		}
+		return n == len(v.keys), nil
+	}
+	return false, nil
+}
+
+// compare compares it to v.
+// Only numbers with numbers and strings with strings can be compared,
+// otherwise false is returned.
+func compare(it *simdjson.Iter, v *value) (int, bool, error) {
+	switch it.Type() {
+	case simdjson.TypeString:
+		if v.t != simdjson.TypeString {
+			return 0, false, nil
+		}
+		b, err := it.StringBytes()
+		if err != nil {
+			return 0, false, err
+		}
+		return bytes.Compare(b, []byte(v.s)), true, nil
+	case simdjson.TypeInt, simdjson.TypeUint, simdjson.TypeFloat:
+		if !v.isNumber() {
+			return 0, false, nil
+		}
+		n, err := iterNumber(it)
+		if err != nil {
+			return 0, false, err
+		}
+		c, ok := compareNumbers(n, v.num)
+		return c, ok, nil
+	}
+	return 0, false, nil
+}
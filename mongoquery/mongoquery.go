@@ -0,0 +1,478 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mongoquery matches records parsed by simdjson against
+// MongoDB-style query documents, for example:
+//
+//	{"age":{"$gt":30},"tags":{"$in":["a","b"]},"$or":[{"x":1},{"y":null}]}
+//
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin,
+// $exists, $type, $regex (with $options), $not, $elemMatch and $size
+// on fields, and $and, $or and $nor on documents.
+//
+// Field names are dotted paths. When a path crosses an array, each object
+// in the array is searched, and a numeric path element selects an array index.
+// Like MongoDB, a condition on a field holding an array matches if the array
+// itself or any of its elements match.
+//
+// Numbers are compared by value regardless of whether they are stored as
+// int, uint or float, so 1, 1.0 and the uint 1 are equal.
+// Ordering comparisons only match values of the same kind: numbers with
+// numbers and strings with strings.
+package mongoquery
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Query is a compiled query document.
+// The compiled query does not reference the tape it was compiled from
+// and can be used concurrently.
+type Query struct {
+	m docMatcher
+}
+
+// Compile compiles a query document.
+// The Iter can be a root element or an object.
+func Compile(query simdjson.Iter) (*Query, error) {
+	it, err := documentIter(query)
+	if err != nil {
+		return nil, err
+	}
+	m, err := compileDoc(&it)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{m: m}, nil
+}
+
+// CompileJSON parses and compiles a query document.
+func CompileJSON(query []byte) (*Query, error) {
+	pj, err := simdjson.Parse(query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mongoquery: parsing query: %w", err)
+	}
+	return Compile(pj.Iter())
+}
+
+// Match returns whether a record matches the query.
+// The Iter can be a root element or the record itself,
+// as returned by ParsedJson.ForEach.
+// If a root contains several records only the first is checked.
+func (q *Query) Match(doc simdjson.Iter) (bool, error) {
+	it, err := documentIter(doc)
+	if err != nil {
+		return false, err
+	}
+	return q.m.matchDoc(&it)
+}
+
+// Filter calls fn with every record in pj that matches the query.
+// If fn returns an error, filtering stops and the error is returned.
+func (q *Query) Filter(pj *simdjson.ParsedJson, fn func(i simdjson.Iter) error) error {
+	return pj.ForEach(func(i simdjson.Iter) error {
+		ok, err := q.m.matchDoc(&i)
+		if err != nil || !ok {
+			return err
+		}
+		return fn(i)
+	})
+}
+
+// documentIter returns an iterator positioned at the content of a root element.
+func documentIter(i simdjson.Iter) (simdjson.Iter, error) {
+	if i.Type() == simdjson.TypeNone {
+		if i.AdvanceInto() == simdjson.TagEnd {
+			return i, errors.New("mongoquery: no document found")
+		}
+	}
+	if i.Type() == simdjson.TypeRoot {
+		_, r, err := i.Root(nil)
+		if err != nil {
+			return i, err
+		}
+		i = *r
+	}
+	return i, nil
+}
+
+// compileDoc compiles a query document.
+func compileDoc(it *simdjson.Iter) (docMatcher, error) {
+	if it.Type() != simdjson.TypeObject {
+		return nil, fmt.Errorf("mongoquery: query must be an object, got %v", it.Type())
+	}
+	obj, err := it.Object(nil)
+	if err != nil {
+		return nil, err
+	}
+	var clauses andMatcher
+	var elem simdjson.Iter
+	for {
+		name, t, err := obj.NextElement(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		var m docMatcher
+		switch name {
+		case "$and", "$or", "$nor":
+			list, err := compileDocList(name, &elem)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "$and":
+				m = list
+			case "$or":
+				m = orMatcher(list)
+			default:
+				m = norMatcher(list)
+			}
+		default:
+			if strings.HasPrefix(name, "$") {
+				return nil, fmt.Errorf("mongoquery: unknown top level operator %s", name)
+			}
+			m, err = compileField(name, &elem)
+			if err != nil {
+				return nil, err
+			}
+		}
+		clauses = append(clauses, m)
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return clauses, nil
+}
+
+// compileDocList compiles an array of query documents.
+func compileDocList(op string, it *simdjson.Iter) (andMatcher, error) {
+	if it.Type() != simdjson.TypeArray {
+		return nil, fmt.Errorf("mongoquery: %s must be an array, got %v", op, it.Type())
+	}
+	arr, err := it.Array(nil)
+	if err != nil {
+		return nil, err
+	}
+	var list andMatcher
+	elems := arr.Iter()
+	for elems.Advance() != simdjson.TypeNone {
+		m, err := compileDoc(&elems)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("mongoquery: %s must be a non-empty array", op)
+	}
+	return list, nil
+}
+
+// compileField compiles the condition on a single field.
+func compileField(name string, it *simdjson.Iter) (docMatcher, error) {
+	f := &fieldMatcher{path: strings.Split(name, ".")}
+	isOps, err := isOperatorDoc(it)
+	if err != nil {
+		return nil, err
+	}
+	if isOps {
+		f.ops, err = compileOps(it)
+		if err != nil {
+			return nil, fmt.Errorf("%w (field %q)", err, name)
+		}
+		return f, nil
+	}
+	v, err := toValue(it)
+	if err != nil {
+		return nil, err
+	}
+	f.ops = []fieldOp{eqOp{v: v}}
+	return f, nil
+}
+
+// isOperatorDoc returns whether it is an object where the first key is an operator.
+func isOperatorDoc(it *simdjson.Iter) (bool, error) {
+	if it.Type() != simdjson.TypeObject {
+		return false, nil
+	}
+	obj, err := it.Object(nil)
+	if err != nil {
+		return false, err
+	}
+	var elem simdjson.Iter
+	name, _, err := obj.NextElementBytes(&elem)
+	return len(name) > 0 && name[0] == '$', err
+}
+
+// compileOps compiles an operator document.
+func compileOps(it *simdjson.Iter) ([]fieldOp, error) {
+	obj, err := it.Object(nil)
+	if err != nil {
+		return nil, err
+	}
+	var ops []fieldOp
+	var pattern, options *string
+	var elem simdjson.Iter
+	for {
+		name, t, err := obj.NextElement(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		var op fieldOp
+		switch name {
+		case "$eq", "$ne":
+			v, err := toValue(&elem)
+			if err != nil {
+				return nil, err
+			}
+			op = eqOp{v: v}
+			if name == "$ne" {
+				op = notOp{eqOp{v: v}}
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			v, err := toValue(&elem)
+			if err != nil {
+				return nil, err
+			}
+			op = cmpOp{op: cmpOps[name], v: v}
+		case "$in", "$nin":
+			if t != simdjson.TypeArray {
+				return nil, fmt.Errorf("mongoquery: %s must be an array, got %v", name, t)
+			}
+			v, err := toValue(&elem)
+			if err != nil {
+				return nil, err
+			}
+			op = inOp{vals: v.arr}
+			if name == "$nin" {
+				op = notOp{inOp{vals: v.arr}}
+			}
+		case "$exists":
+			b, err := elem.Bool()
+			if err != nil {
+				return nil, fmt.Errorf("mongoquery: $exists must be a bool, got %v", t)
+			}
+			op = existsOp{want: b}
+		case "$type":
+			mask, err := typeMask(&elem)
+			if err != nil {
+				return nil, err
+			}
+			op = typeOp{mask: mask}
+		case "$regex", "$options":
+			s, err := elem.String()
+			if err != nil {
+				return nil, fmt.Errorf("mongoquery: %s must be a string, got %v", name, t)
+			}
+			if name == "$regex" {
+				pattern = &s
+			} else {
+				options = &s
+			}
+			continue
+		case "$not":
+			isOps, err := isOperatorDoc(&elem)
+			if err != nil {
+				return nil, err
+			}
+			if !isOps {
+				return nil, errors.New("mongoquery: $not must be an operator document")
+			}
+			sub, err := compileOps(&elem)
+			if err != nil {
+				return nil, err
+			}
+			op = notOp(sub)
+		case "$elemMatch":
+			op, err = compileElemMatch(&elem)
+			if err != nil {
+				return nil, err
+			}
+		case "$size":
+			n, err := elem.Int()
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("mongoquery: $size must be a non-negative integer")
+			}
+			op = sizeOp{n: int(n)}
+		default:
+			if !strings.HasPrefix(name, "$") {
+				return nil, fmt.Errorf("mongoquery: cannot mix operators and field %q", name)
+			}
+			return nil, fmt.Errorf("mongoquery: unknown operator %s", name)
+		}
+		ops = append(ops, op)
+	}
+	if options != nil && pattern == nil {
+		return nil, errors.New("mongoquery: $options without $regex")
+	}
+	if pattern != nil {
+		op, err := compileRegex(*pattern, options)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// compileElemMatch compiles $elemMatch.
+// If the value contains only field operators, they are applied to each element,
+// otherwise it is a query document matched against each element.
+func compileElemMatch(it *simdjson.Iter) (fieldOp, error) {
+	if it.Type() != simdjson.TypeObject {
+		return nil, fmt.Errorf("mongoquery: $elemMatch must be an object, got %v", it.Type())
+	}
+	obj, err := it.Object(nil)
+	if err != nil {
+		return nil, err
+	}
+	fieldOps := true
+	var elem simdjson.Iter
+	for {
+		name, t, err := obj.NextElementBytes(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if t == simdjson.TypeNone {
+			break
+		}
+		switch string(name) {
+		case "$and", "$or", "$nor":
+			fieldOps = false
+		default:
+			if len(name) == 0 || name[0] != '$' {
+				fieldOps = false
+			}
+		}
+	}
+	if fieldOps {
+		ops, err := compileOps(it)
+		return elemMatchOp{ops: ops}, err
+	}
+	doc, err := compileDoc(it)
+	return elemMatchOp{doc: doc}, err
+}
+
+// compileRegex compiles a $regex operator.
+// Options i, m and s are supported.
+func compileRegex(pattern string, options *string) (fieldOp, error) {
+	if options != nil && *options != "" {
+		for _, c := range *options {
+			if !strings.ContainsRune("ims", c) {
+				return nil, fmt.Errorf("mongoquery: unsupported $regex option %q", c)
+			}
+		}
+		pattern = "(?" + *options + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("mongoquery: $regex: %w", err)
+	}
+	return regexOp{re: re}, nil
+}
+
+// typeNames contains the accepted $type aliases.
+var typeNames = map[string]uint32{
+	"double": 1 << simdjson.TypeFloat,
+	"float":  1 << simdjson.TypeFloat,
+	"string": 1 << simdjson.TypeString,
+	"object": 1 << simdjson.TypeObject,
+	"array":  1 << simdjson.TypeArray,
+	"bool":   1 << simdjson.TypeBool,
+	"null":   1 << simdjson.TypeNull,
+	"int":    1<<simdjson.TypeInt | 1<<simdjson.TypeUint,
+	"long":   1<<simdjson.TypeInt | 1<<simdjson.TypeUint,
+	"uint":   1 << simdjson.TypeUint,
+	"number": 1<<simdjson.TypeInt | 1<<simdjson.TypeUint | 1<<simdjson.TypeFloat,
+}
+
+// typeCodes contains the accepted numeric BSON type codes.
+var typeCodes = map[int64]string{
+	1:  "double",
+	2:  "string",
+	3:  "object",
+	4:  "array",
+	8:  "bool",
+	10: "null",
+	16: "int",
+	18: "long",
+}
+
+// typeMask returns the types matched by a $type value.
+func typeMask(it *simdjson.Iter) (uint32, error) {
+	switch it.Type() {
+	case simdjson.TypeString:
+		s, err := it.String()
+		if err != nil {
+			return 0, err
+		}
+		mask, ok := typeNames[s]
+		if !ok {
+			return 0, fmt.Errorf("mongoquery: unknown $type %q", s)
+		}
+		return mask, nil
+	case simdjson.TypeInt, simdjson.TypeUint, simdjson.TypeFloat:
+		n, err := it.Int()
+		if err != nil {
+			return 0, err
+		}
+		name, ok := typeCodes[n]
+		if !ok {
+			return 0, fmt.Errorf("mongoquery: unknown $type %d", n)
+		}
+		return typeNames[name], nil
+	case simdjson.TypeArray:
+		arr, err := it.Array(nil)
+		if err != nil {
+			return 0, err
+		}
+		var mask uint32
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			if elems.Type() == simdjson.TypeArray {
+				return 0, errors.New("mongoquery: nested $type array")
+			}
+			m, err := typeMask(&elems)
+			if err != nil {
+				return 0, err
+			}
+			mask |= m
+		}
+		return mask, nil
+	}
+	return 0, fmt.Errorf("mongoquery: $type must be a string, number or array, got %v", it.Type())
+}
+
+// arrayIndex returns the path element as an array index.
+func arrayIndex(s string) (int, bool) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
@@ -0,0 +1,193 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mongoquery
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+const testRecords = `{"id":0,"name":"alice","age":31,"tags":["a","x"],"addr":{"city":"Oslo","zip":"0150"}}
+{"id":1,"name":"bob","age":25.5,"tags":["b"],"addr":{"city":"Bergen"}}
+{"id":2,"name":"Carol","age":18446744073709551615,"tags":[],"items":[{"sku":"p1","qty":2},{"sku":"p2","qty":10}]}
+{"id":3,"name":null,"age":30,"items":[{"sku":"p1","qty":7}],"scores":[[1,2],[3]]}
+{"id":4,"age":-5,"tags":"a"}
+`
+
+func TestQuery_Filter(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := simdjson.ParseND([]byte(testRecords), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{query: `{}`, want: []int64{0, 1, 2, 3, 4}},
+		{query: `{"name":"bob"}`, want: []int64{1}},
+		{query: `{"age":30.0}`, want: []int64{3}},
+		{query: `{"age":{"$gt":30}}`, want: []int64{0, 2}},
+		{query: `{"age":{"$gte":30,"$lt":1e30}}`, want: []int64{0, 2, 3}},
+		{query: `{"age":{"$lte":25.5}}`, want: []int64{1, 4}},
+		{query: `{"age":{"$gt":18446744073709551614}}`, want: []int64{2}},
+		{query: `{"age":{"$gt":9223372036854775807.0}}`, want: []int64{2}},
+		{query: `{"age":{"$ne":30}}`, want: []int64{0, 1, 2, 4}},
+		{query: `{"tags":"a"}`, want: []int64{0, 4}},
+		{query: `{"tags":["b"]}`, want: []int64{1}},
+		{query: `{"tags":{"$in":["b","x"]}}`, want: []int64{0, 1}},
+		{query: `{"tags":{"$nin":["a"]}}`, want: []int64{1, 2, 3}},
+		{query: `{"tags":{"$size":0}}`, want: []int64{2}},
+		{query: `{"tags":{"$exists":false}}`, want: []int64{3}},
+		{query: `{"name":null}`, want: []int64{3, 4}},
+		{query: `{"name":{"$type":"string"}}`, want: []int64{0, 1, 2}},
+		{query: `{"age":{"$type":["double","null"]}}`, want: []int64{1}},
+		{query: `{"age":{"$type":16}}`, want: []int64{0, 2, 3, 4}},
+		{query: `{"name":{"$regex":"^c","$options":"i"}}`, want: []int64{2}},
+		{query: `{"name":{"$not":{"$regex":"^[ab]"}}}`, want: []int64{2, 3, 4}},
+		{query: `{"addr.city":"Oslo"}`, want: []int64{0}},
+		{query: `{"addr":{"city":"Bergen"}}`, want: []int64{1}},
+		{query: `{"items.sku":"p1"}`, want: []int64{2, 3}},
+		{query: `{"items.1.qty":10}`, want: []int64{2}},
+		{query: `{"items":{"$elemMatch":{"sku":"p1","qty":{"$gt":5}}}}`, want: []int64{3}},
+		{query: `{"scores":{"$elemMatch":{"$size":1}}}`, want: []int64{3}},
+		{query: `{"tags":{"$elemMatch":{"$eq":"x"}}}`, want: []int64{0}},
+		{query: `{"$or":[{"name":"bob"},{"age":{"$lt":0}}]}`, want: []int64{1, 4}},
+		{query: `{"$and":[{"age":{"$gt":20}},{"age":{"$lt":31}}]}`, want: []int64{1, 3}},
+		{query: `{"$nor":[{"tags":"a"},{"name":null}]}`, want: []int64{1, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := CompileJSON([]byte(test.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			err = q.Filter(pj, func(i simdjson.Iter) error {
+				var e simdjson.Element
+				if _, err := i.FindElement(&e, "id"); err != nil {
+					return err
+				}
+				id, err := e.Iter.Int()
+				got = append(got, id)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuery_Match(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	q, err := CompileJSON([]byte(`{"a.b":{"$gte":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for doc, want := range map[string]bool{
+		`{"a":{"b":1}}`:           true,
+		`{"a":{"b":0.5}}`:         false,
+		`{"a":[{"b":0},{"b":2}]}`: true,
+		`{"a":{"b":"1"}}`:         false,
+		`[1,2]`:                   false,
+	} {
+		pj, err := simdjson.Parse([]byte(doc), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := q.Match(pj.Iter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", doc, got, want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	tests := map[string]string{
+		`[]`:                                  "must be an object",
+		`{"$xor":[]}`:                         "unknown top level operator",
+		`{"$or":[]}`:                          "non-empty",
+		`{"a":{"$foo":1}}`:                    "unknown operator",
+		`{"a":{"$gt":1,"b":2}}`:               "cannot mix",
+		`{"a":{"$in":1}}`:                     "must be an array",
+		`{"a":{"$exists":1}}`:                 "must be a bool",
+		`{"a":{"$type":"date"}}`:              "unknown $type",
+		`{"a":{"$regex":"("}}`:                "$regex",
+		`{"a":{"$regex":"a","$options":"x"}}`: "unsupported $regex option",
+		`{"a":{"$options":"i"}}`:              "without $regex",
+		`{"a":{"$not":1}}`:                    "$not",
+		`{"a":{"$size":-1}}`:                  "$size",
+	}
+	for query, want := range tests {
+		_, err := CompileJSON([]byte(query))
+		if err == nil {
+			t.Errorf("%s: expected error", query)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %q does not contain %q", query, err, want)
+		}
+	}
+}
+
+func TestCompareNumbers(t *testing.T) {
+	i := func(v int64) number { return number{t: simdjson.TypeInt, i: v} }
+	u := func(v uint64) number { return number{t: simdjson.TypeUint, u: v} }
+	f := func(v float64) number { return number{t: simdjson.TypeFloat, f: v} }
+	tests := []struct {
+		a, b number
+		want int
+	}{
+		{a: i(-1), b: u(0), want: -1},
+		{a: u(math.MaxUint64), b: i(math.MaxInt64), want: 1},
+		{a: f(1.5), b: i(1), want: 1},
+		{a: f(-1.5), b: i(-1), want: -1},
+		{a: f(-1.5), b: i(-2), want: 1},
+		{a: i(math.MaxInt64), b: f(9223372036854775807), want: -1},
+		{a: u(math.MaxUint64), b: f(18446744073709551615), want: -1},
+		{a: u(1 << 60), b: f(1 << 60), want: 0},
+		{a: f(-1), b: u(0), want: -1},
+		{a: f(2), b: f(2), want: 0},
+	}
+	for _, test := range tests {
+		got, ok := compareNumbers(test.a, test.b)
+		if !ok || got != test.want {
+			t.Errorf("compare(%+v, %+v): got %d, %v want %d", test.a, test.b, got, ok, test.want)
+		}
+	}
+	if _, ok := compareNumbers(f(math.NaN()), i(0)); ok {
+		t.Error("NaN should not compare")
+	}
+}
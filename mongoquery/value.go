@@ -0,0 +1,234 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mongoquery
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/minio/simdjson-go"
+)
+
+// value is an operand copied from the query document.
+type value struct {
+	t   simdjson.Type
+	b   bool
+	s   string
+	num number
+
+	// arr contains array elements or object values.
+	arr []value
+	// keys contains object keys.
+	keys []string
+}
+
+func (v *value) isNumber() bool {
+	switch v.t {
+	case simdjson.TypeInt, simdjson.TypeUint, simdjson.TypeFloat:
+		return true
+	}
+	return false
+}
+
+// toValue copies the value of it.
+func toValue(it *simdjson.Iter) (value, error) {
+	v := value{t: it.Type()}
+	var err error
+	switch v.t {
+	case simdjson.TypeNull:
+	case simdjson.TypeBool:
+		v.b, err = it.Bool()
+	case simdjson.TypeString:
+		v.s, err = it.String()
+	case simdjson.TypeInt, simdjson.TypeUint, simdjson.TypeFloat:
+		v.num, err = iterNumber(it)
+	case simdjson.TypeArray:
+		var arr *simdjson.Array
+		arr, err = it.Array(nil)
+		if err != nil {
+			return v, err
+		}
+		elems := arr.Iter()
+		for elems.Advance() != simdjson.TypeNone {
+			e, err := toValue(&elems)
+			if err != nil {
+				return v, err
+			}
+			v.arr = append(v.arr, e)
+		}
+	case simdjson.TypeObject:
+		var obj *simdjson.Object
+		obj, err = it.Object(nil)
+		if err != nil {
+			return v, err
+		}
+		var elem simdjson.Iter
+		for {
+			name, t, err := obj.NextElement(&elem)
+			if err != nil {
+				return v, err
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			e, err := toValue(&elem)
+			if err != nil {
+				return v, err
+			}
+			v.keys = append(v.keys, name)
+			v.arr = append(v.arr, e)
+		}
+	default:
+		err = fmt.Errorf("mongoquery: unexpected value type %v", v.t)
+	}
+	return v, err
+}
+
+// number is an int64, uint64 or float64 value.
+type number struct {
+	t simdjson.Type
+	i int64
+	u uint64
+	f float64
+}
+
+// iterNumber returns the number of it without conversion.
+func iterNumber(it *simdjson.Iter) (number, error) {
+	n := number{t: it.Type()}
+	var err error
+	switch n.t {
+	case simdjson.TypeInt:
+		n.i, err = it.Int()
+	case simdjson.TypeUint:
+		n.u, err = it.Uint()
+	default:
+		n.f, err = it.Float()
+	}
+	return n, err
+}
+
+// compareNumbers compares two numbers exactly, regardless of their types.
+// False is returned if either is NaN.
+func compareNumbers(a, b number) (int, bool) {
+	switch a.t {
+	case simdjson.TypeInt:
+		switch b.t {
+		case simdjson.TypeInt:
+			return cmpInt(a.i, b.i), true
+		case simdjson.TypeUint:
+			return cmpIntUint(a.i, b.u), true
+		default:
+			c, ok := cmpFloatInt(b.f, a.i)
+			return -c, ok
+		}
+	case simdjson.TypeUint:
+		switch b.t {
+		case simdjson.TypeInt:
+			return -cmpIntUint(b.i, a.u), true
+		case simdjson.TypeUint:
+			return cmpUint(a.u, b.u), true
+		default:
+			c, ok := cmpFloatUint(b.f, a.u)
+			return -c, ok
+		}
+	default:
+		switch b.t {
+		case simdjson.TypeInt:
+			return cmpFloatInt(a.f, b.i)
+		case simdjson.TypeUint:
+			return cmpFloatUint(a.f, b.u)
+		default:
+			if math.IsNaN(a.f) || math.IsNaN(b.f) {
+				return 0, false
+			}
+			return cmpFloat(a.f, b.f), true
+		}
+	}
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpIntUint(a int64, b uint64) int {
+	if a < 0 {
+		return -1
+	}
+	return cmpUint(uint64(a), b)
+}
+
+// cmpFloatInt compares f to i without losing precision.
+func cmpFloatInt(f float64, i int64) (int, bool) {
+	switch {
+	case math.IsNaN(f):
+		return 0, false
+	case f < math.MinInt64:
+		return -1, true
+	case f >= -math.MinInt64:
+		return 1, true
+	}
+	// f is within int64 range, compare the integer part and then the fraction.
+	t := int64(f)
+	if c := cmpInt(t, i); c != 0 {
+		return c, true
+	}
+	return cmpFloat(f-float64(t), 0), true
+}
+
+// cmpFloatUint compares f to u without losing precision.
+func cmpFloatUint(f float64, u uint64) (int, bool) {
+	switch {
+	case math.IsNaN(f):
+		return 0, false
+	case f < 0:
+		return -1, true
+	case f >= math.MaxUint64:
+		// MaxUint64 rounds up to 2^64 as a float.
+		return 1, true
+	}
+	t := uint64(f)
+	if c := cmpUint(t, u); c != 0 {
+		return c, true
+	}
+	return cmpFloat(f-float64(t), 0), true
+}
@@ -18,6 +18,7 @@ package simdjson
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -315,6 +316,97 @@ func TestNdjsonCountWhere(t *testing.T) {
 	})
 }
 
+func TestParseNDStream(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	// Generate enough input for several blocks.
+	var sb strings.Builder
+	const n = 250000
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, `{"n":%d,"s":"%s","a":[1,2,3,{"b":null}]}`+"\n", i, strings.Repeat("x", i%100))
+	}
+	input := sb.String()
+
+	res := make(chan Stream)
+	reuse := make(chan *ParsedJson, 2)
+	ParseNDStream(strings.NewReader(input), res, reuse)
+	var next int64
+	var blocks int
+	for got := range res {
+		if got.Error != nil {
+			if got.Error != io.EOF {
+				t.Fatal(got.Error)
+			}
+			break
+		}
+		blocks++
+		err := got.Value.ForEach(func(i Iter) error {
+			elem, err := i.FindElement(nil, "n")
+			if err != nil {
+				return err
+			}
+			v, err := elem.Iter.Int()
+			if err != nil {
+				return err
+			}
+			if v != next {
+				return fmt.Errorf("got record %d, want %d", v, next)
+			}
+			next++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case reuse <- got.Value:
+		default:
+		}
+	}
+	if next != n {
+		t.Errorf("got %d records, want %d", next, n)
+	}
+	if blocks < 2 {
+		t.Errorf("got %d blocks, want more than one", blocks)
+	}
+
+	// Workers must not wait for values to be returned.
+	res = make(chan Stream)
+	ParseNDStream(strings.NewReader(input), res, make(chan *ParsedJson))
+	next = 0
+	for got := range res {
+		if got.Error != nil {
+			if got.Error != io.EOF {
+				t.Fatal(got.Error)
+			}
+			break
+		}
+		c, err := got.Value.RecordCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		next += int64(c)
+	}
+	if next != n {
+		t.Errorf("got %d records without reuse, want %d", next, n)
+	}
+
+	// Errors must be returned after all preceding blocks.
+	res = make(chan Stream)
+	ParseNDStream(strings.NewReader(input+"{\"n\":}\n"), res, nil)
+	var gotErr error
+	for got := range res {
+		if got.Error != nil {
+			gotErr = got.Error
+			break
+		}
+	}
+	if gotErr == nil || gotErr == io.EOF {
+		t.Errorf("want parse error, got %v", gotErr)
+	}
+}
+
 func TestNdjsonCountWhere2(t *testing.T) {
 	if !SupportedCPU() {
 		t.SkipNow()
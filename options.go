@@ -1,5 +1,7 @@
 package simdjson
 
+import "errors"
+
 // ParserOption is a parser option.
 type ParserOption func(pj *internalParsedJson) error
 
@@ -16,3 +18,78 @@ func WithCopyStrings(b bool) ParserOption {
 		return nil
 	}
 }
+
+// WithStringInterning will deduplicate copied strings of at most maxLen bytes.
+// This applies to object keys as well as string values.
+// When a string has previously been added to the Strings buffer the tape will point
+// to the existing copy instead of adding another one.
+// This is useful for NDJSON where the same keys repeat on every line.
+// Interning only applies to strings that are copied, see WithCopyStrings.
+// Up to 49152 distinct strings are interned per parse, later strings are copied as usual.
+// FindKey and FindPath compare interned keys by their offset instead of their bytes,
+// until a string on the tape is changed.
+// A maxLen of 0 or less disables interning.
+// Default: disabled.
+func WithStringInterning(maxLen int) ParserOption {
+	return func(pj *internalParsedJson) error {
+		pj.internMaxLen = maxLen
+		return nil
+	}
+}
+
+// WithSizeHints sets the expected size of the output relative to the input.
+// tape is the number of tape entries and strings the number of copied string bytes
+// per byte of JSON input.
+// Without hints, or when a hint is 0, sizes are learned from previous parses
+// when reusing a ParsedJson or parsing a stream, starting at 0.15 and 0.10.
+// Correct hints avoid reallocations while parsing, while too big hints waste memory.
+func WithSizeHints(tape, strings float64) ParserOption {
+	return func(pj *internalParsedJson) error {
+		if tape < 0 || strings < 0 {
+			return errors.New("negative size hint")
+		}
+		pj.hintTape, pj.hintStrings = tape, strings
+		return nil
+	}
+}
+
+// WithFloatPrecisionFlags will add the FloatInexact, FloatExceedsSafeInteger,
+// FloatUnderflowToZero and FloatFromExponent flags to parsed floats.
+// Computing the flags adds a cost to parsing every float,
+// and floats with flags take more space when serialized.
+// FloatOverflowedInteger is always set.
+// Default: false.
+func WithFloatPrecisionFlags(b bool) ParserOption {
+	return func(pj *internalParsedJson) error {
+		pj.floatPrecision = b
+		return nil
+	}
+}
+
+// WithRecordIndex will collect the offsets of root elements while building the tape.
+// The index makes ParsedJson.RecordCount and ParsedJson.Record O(1).
+// Without this option the root elements are located on every call,
+// unless ParsedJson.BuildRecordIndex is called.
+// Default: false.
+func WithRecordIndex(b bool) ParserOption {
+	return func(pj *internalParsedJson) error {
+		pj.recordIndex = b
+		return nil
+	}
+}
+
+// WithCompactTape will store short strings and small integers inline on the tape.
+// Strings of at most 6 bytes and integers that fit in 56 bits use a single
+// tape entry with the TagStringInline or TagIntegerInline tag,
+// instead of two entries and a copy of the string.
+// This reduces the tape size, especially for NDJSON with many short keys.
+// Iter, Object and Array handle inline values transparently,
+// but code reading the tape directly must handle the additional tags.
+// Inline values can only be replaced by values that fit inline.
+// Default: false.
+func WithCompactTape(b bool) ParserOption {
+	return func(pj *internalParsedJson) error {
+		pj.compact = b
+		return nil
+	}
+}
@@ -26,14 +26,14 @@ import (
 )
 
 func (pj *internalParsedJson) initialize(size int) {
-	// Estimate the tape size to be about 15% of the length of the JSON message
-	avgTapeSize := size * 15 / 100
+	// Estimate the tape and strings size from previous parses,
+	// or about 15% and 10% of the length of the JSON message.
+	avgTapeSize, stringsSize := pj.estimateSizes(size)
 	if cap(pj.Tape) < avgTapeSize {
 		pj.Tape = make([]uint64, 0, avgTapeSize)
 	}
 	pj.Tape = pj.Tape[:0]
 
-	stringsSize := size / 10
 	if stringsSize < 128 {
 		stringsSize = 128 // always allocate at least 128 for the string buffer
 	}
@@ -47,6 +47,17 @@ func (pj *internalParsedJson) initialize(size int) {
 	}
 	pj.containingScopeOffset = pj.containingScopeOffset[:0]
 	pj.indexesChan = indexChan{}
+	if pj.internMaxLen > 0 {
+		// The previous table may be used by the previous tape,
+		// so a new table is started, sized like the previous one.
+		size := 0
+		if pj.internTable != nil {
+			size = len(pj.internTable.entries)
+		}
+		pj.internTable = newInternTable(pj.internMaxLen, size)
+	} else {
+		pj.internTable = nil
+	}
 }
 
 func (pj *internalParsedJson) parseMessage(msg []byte, ndjson bool) (err error) {
@@ -117,11 +128,22 @@ func (pj *internalParsedJson) parseMessage(msg []byte, ndjson bool) (err error)
 				}
 			}
 		}
+		pj.observeSizes()
 		return nil
 	}
 
 	if errStage1 != nil {
 		return errStage1
 	}
+	if err == nil {
+		pj.observeSizes()
+	}
 	return
 }
+
+// observeSizes will record the sizes of the parsed tape and strings.
+func (pj *internalParsedJson) observeSizes() {
+	if pj.sizes != nil {
+		pj.sizes.observe(len(pj.Message), len(pj.Tape), len(pj.Strings.B))
+	}
+}
@@ -276,6 +276,70 @@ func TestParseNumber(t *testing.T) {
 	}
 }
 
+func TestParseNumberPrecisionFlags(t *testing.T) {
+	testCases := []struct {
+		input     string
+		wantTag   Tag
+		expectedD float64
+		expectedI int64
+		expectedU uint64
+		flags     FloatFlags
+	}{
+		{input: "1", wantTag: TagInteger, expectedI: 1},
+		{input: "10000000000000000001", wantTag: TagUint, expectedU: 10000000000000000001},
+		// math.MinInt64 - 1
+		{input: "-9223372036854775809", wantTag: TagFloat, expectedD: -9.223372036854776e+18, flags: FloatOverflowedInteger.Flags(FloatInexact, FloatExceedsSafeInteger)},
+		{input: "-10000000000000000000", wantTag: TagFloat, expectedD: -10000000000000000000, flags: FloatOverflowedInteger.Flags(FloatExceedsSafeInteger)},
+		{input: "100000000000000000000", wantTag: TagFloat, expectedD: 100000000000000000000, flags: FloatOverflowedInteger.Flags(FloatExceedsSafeInteger)},
+		// math.MaxUint64 +1
+		{input: "18446744073709551616", wantTag: TagFloat, expectedD: 1.8446744073709552e+19, flags: FloatOverflowedInteger.Flags(FloatExceedsSafeInteger)},
+		{input: "1.0", wantTag: TagFloat, expectedD: 1.0},
+		{input: "9876.543210", wantTag: TagFloat, expectedD: 9876.543210, flags: FloatInexact.Flags()},
+		{input: "0.123456789e-12", wantTag: TagFloat, expectedD: 1.23456789e-13, flags: FloatInexact.Flags(FloatFromExponent)},
+		{input: "1.234567890E+34", wantTag: TagFloat, expectedD: 1.234567890e+34, flags: FloatInexact.Flags(FloatExceedsSafeInteger, FloatFromExponent)},
+		{input: "23456789012E66", wantTag: TagFloat, expectedD: 23456789012e66, flags: FloatInexact.Flags(FloatExceedsSafeInteger, FloatFromExponent)},
+		{input: "-9876.543210", wantTag: TagFloat, expectedD: -9876.543210, flags: FloatInexact.Flags()},
+		{input: "-65.619720000000029", wantTag: TagFloat, expectedD: -65.61972000000003, flags: FloatInexact.Flags()},
+		{input: "0.5", wantTag: TagFloat, expectedD: 0.5},
+		{input: "0.1", wantTag: TagFloat, expectedD: 0.1, flags: FloatInexact.Flags()},
+		{input: "1e22", wantTag: TagFloat, expectedD: 1e22, flags: FloatExceedsSafeInteger.Flags(FloatFromExponent)},
+		{input: "1e23", wantTag: TagFloat, expectedD: 1e23, flags: FloatInexact.Flags(FloatExceedsSafeInteger, FloatFromExponent)},
+		{input: "9007199254740993.0", wantTag: TagFloat, expectedD: 9007199254740992, flags: FloatInexact.Flags(FloatExceedsSafeInteger)},
+		{input: "1e-400", wantTag: TagFloat, expectedD: 0, flags: FloatInexact.Flags(FloatUnderflowToZero, FloatFromExponent)},
+		{input: "-0.0", wantTag: TagFloat, expectedD: 0},
+		{input: "123456789012345678901234567890", wantTag: TagFloat, expectedD: 123456789012345678901234567890, flags: FloatOverflowedInteger.Flags(FloatInexact, FloatExceedsSafeInteger)},
+		{input: "1.00000000000000000000000000000", wantTag: TagFloat, expectedD: 1},
+		{input: "0.500000000000000000000000000001", wantTag: TagFloat, expectedD: 0.5, flags: FloatInexact.Flags()},
+	}
+
+	for _, tc := range testCases {
+		id, val := parseNumberFlags([]byte(fmt.Sprintf(`%s:`, tc.input)), true)
+		tag := Tag(id >> JSONTAGOFFSET)
+		flags := id & JSONVALUEMASK
+		if tag != tc.wantTag {
+			t.Errorf("%s: got tag %v want %v", tc.input, tag, tc.wantTag)
+		}
+		switch tag {
+		case TagFloat:
+			// Expected values are exact, closeEnough does not handle zero.
+			if got := math.Float64frombits(val); got != tc.expectedD {
+				t.Errorf("%s: got %g want %g", tc.input, got, tc.expectedD)
+			}
+		case TagInteger:
+			if tc.expectedI != int64(val) {
+				t.Errorf("%s: got %d want %d", tc.input, int64(val), tc.expectedI)
+			}
+		case TagUint:
+			if tc.expectedU != val {
+				t.Errorf("%s: got %d want %d", tc.input, val, tc.expectedU)
+			}
+		}
+		if flags != uint64(tc.flags) {
+			t.Errorf("%s: got flags %d want %d", tc.input, flags, tc.flags)
+		}
+	}
+}
+
 // The following code is borrowed from Golang (https://golang.org/src/strconv/atoi_test.go)
 
 type parseInt64Test struct {
@@ -696,3 +760,352 @@ func TestVerifyTape(t *testing.T) {
 		})
 	}
 }
+
+func TestWithStringInterning(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	var sb strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, `{"timestamp":%d,"level":"info","msg":"message %d","tags":["a","b\n","a"]}`+"\n", i, i)
+	}
+	input := []byte(sb.String())
+	want, err := ParseND(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseND(input, nil, WithStringInterning(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Strings.B) >= len(want.Strings.B) {
+		t.Errorf("strings not deduplicated, got %d bytes, without interning %d bytes", len(got.Strings.B), len(want.Strings.B))
+	}
+	iw, ig := want.Iter(), got.Iter()
+	wantJSON, err := iw.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := ig.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wantJSON, gotJSON) {
+		t.Fatalf("output mismatch\nwant: %s\ngot:  %s", string(wantJSON), string(gotJSON))
+	}
+
+	// All "timestamp" keys should point to the same offset.
+	offsets := make(map[uint64]struct{})
+	err = got.ForEach(func(i Iter) error {
+		obj, err := i.Object(nil)
+		if err != nil {
+			return err
+		}
+		offsets[obj.tape.Tape[obj.off]&JSONVALUEMASK] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 1 {
+		t.Errorf("want 1 key offset, got %d", len(offsets))
+	}
+
+	// Reusing without the option should disable interning.
+	got, err = ParseND(input, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Strings.B) != len(want.Strings.B) {
+		t.Errorf("want %d string bytes, got %d", len(want.Strings.B), len(got.Strings.B))
+	}
+}
+
+func TestStringInterningFindKey(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	// findAll returns the value of key in every record, or "" if not found.
+	findAll := func(t *testing.T, pj *ParsedJson, key string) []string {
+		t.Helper()
+		var res []string
+		err := pj.ForEach(func(i Iter) error {
+			obj, err := i.Object(nil)
+			if err != nil {
+				return err
+			}
+			var v string
+			if elem := obj.FindKey(key, nil); elem != nil {
+				v, err = elem.Iter.StringCvt()
+				if err != nil {
+					return err
+				}
+			}
+			res = append(res, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	const input = `{"level":"info","n":1}` + "\n" + `{"\u006cevel":"warn","n":2}` + "\n" + `{"n":3,"level":"level"}`
+	want := []string{"info", "warn", "level"}
+	for _, compact := range []bool{false, true} {
+		pj, err := ParseND([]byte(input), nil, WithStringInterning(16), WithCompactTape(compact))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pj.meta.internIndex(pj.Strings) == nil {
+			t.Fatal("no intern index")
+		}
+		if got := findAll(t, pj, "level"); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("compact %v: want %v, got %v", compact, want, got)
+		}
+		if got := findAll(t, pj, "leveL"); fmt.Sprint(got) != "[  ]" {
+			t.Errorf("compact %v: want no matches, got %q", compact, got)
+		}
+		// Keys longer than the interned length are compared.
+		if got := findAll(t, pj, "levellevellevellevel"); fmt.Sprint(got) != "[  ]" {
+			t.Errorf("compact %v: want no matches, got %q", compact, got)
+		}
+		i := pj.Iter()
+		elem, err := i.FindElement(nil, "level")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := elem.Iter.String(); s != "info" {
+			t.Errorf("compact %v: want info, got %q", compact, s)
+		}
+
+		// Clones keep the index.
+		clone := pj.Clone(nil)
+		if clone.meta.internIndex(clone.Strings) == nil {
+			t.Error("clone has no intern index")
+		}
+		if got := findAll(t, clone, "level"); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("clone: want %v, got %v", want, got)
+		}
+
+		// Setting a string invalidates the index, keys are then compared.
+		elem, err = i.FindElement(nil, "n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := elem.Iter.SetString("level"); err != nil {
+			t.Fatal(err)
+		}
+		if !compact && pj.meta.internIndex(pj.Strings) != nil {
+			t.Error("intern index not invalidated")
+		}
+		if got := findAll(t, pj, "level"); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("compact %v: want %v after edit, got %v", compact, want, got)
+		}
+	}
+
+	// Keys seen after the table is full are not interned.
+	var sb strings.Builder
+	for i := 0; i < internMaxEntries; i++ {
+		fmt.Fprintf(&sb, `{"level":"v%d"}`+"\n", i)
+	}
+	sb.WriteString(`{"late":"x"}` + "\n" + `{"late":"y"}`)
+	pj, err := ParseND([]byte(sb.String()), nil, WithStringInterning(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := pj.meta.internIndex(pj.Strings); x == nil || !x.table.full {
+		t.Fatal("want full intern table")
+	}
+	got := findAll(t, pj, "late")
+	if n := len(got); n != internMaxEntries+2 || got[n-2] != "x" || got[n-1] != "y" {
+		t.Errorf("want late keys found, got %v", got[n-2:])
+	}
+	if got := findAll(t, pj, "level"); got[internMaxEntries-1] != fmt.Sprintf("v%d", internMaxEntries-1) {
+		t.Errorf("want last level found, got %q", got[internMaxEntries-1])
+	}
+}
+
+func TestAdaptiveSizes(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	// Numbers give a much higher tape ratio than the default.
+	numbers := func(n int) []byte {
+		var sb strings.Builder
+		sb.WriteString("[")
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, "%d", i%10)
+		}
+		sb.WriteString("]")
+		return []byte(sb.String())
+	}
+	small, big := numbers(1000), numbers(50000)
+	want, err := Parse(big, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pj, err := Parse(small, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fresh internalParsedJson
+	if tape, _ := fresh.estimateSizes(len(big)); tape >= len(want.Tape) {
+		t.Fatalf("default estimate %d should be too small for %d entries", tape, len(want.Tape))
+	}
+	if tape, _ := pj.internal.estimateSizes(len(big)); tape < len(want.Tape) {
+		t.Errorf("learned estimate %d is too small for %d entries", tape, len(want.Tape))
+	}
+
+	// A single input with smaller ratio should not shrink much.
+	before, _ := pj.internal.estimateSizes(len(big))
+	pj, err = Parse([]byte(`{"s":"`+strings.Repeat("a", 10000)+`"}`), pj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := pj.internal.estimateSizes(len(big)); after < before/2 {
+		t.Errorf("estimate shrunk from %d to %d", before, after)
+	}
+
+	// With hints the estimate is used as is.
+	pj, err = Parse(big, nil, WithSizeHints(2, 0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int(float64(len(big)) * 2); cap(pj.Tape) != want {
+		t.Errorf("want tape capacity %d, got %d", want, cap(pj.Tape))
+	}
+	if _, err := Parse(big, nil, WithSizeHints(-1, 0)); err == nil {
+		t.Error("want error for negative hint")
+	}
+}
+
+func TestCompactTape(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := loadCompressed(t, tt.name)
+			want, err := Parse(ref, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, copyStrings := range []bool{true, false} {
+				pj, err := Parse(ref, nil, WithCompactTape(true), WithCopyStrings(copyStrings))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(pj.Tape) > len(want.Tape) {
+					t.Errorf("compact tape is bigger: %d > %d", len(pj.Tape), len(want.Tape))
+				}
+				wantJSON, err := want.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := pj.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, wantJSON) {
+					t.Fatal("compact tape output mismatch")
+				}
+
+				// Serialized tapes must round trip.
+				s := NewSerializer()
+				pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err = pj2.MarshalJSON(); err != nil || !bytes.Equal(got, wantJSON) {
+					t.Fatal("deserialized compact tape mismatch", err)
+				}
+
+				// Hashes must not depend on the tape layout.
+				mw, err := ComputeMerkle(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mg, err := ComputeMerkle(pj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if mw.Roots()[0] != mg.Roots()[0] {
+					t.Error("merkle hash mismatch")
+				}
+			}
+		})
+	}
+}
+
+func TestCompactTapeValues(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = `{"a":"short","long":"a longer string","n":[-1,2,36028797018963967,36028797018963968,1.5]}`
+	pj, err := Parse([]byte(input), nil, WithCompactTape(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Parse([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "a", "short", "long", "n", -1, 2 and 2^55-1 are inline.
+	if got, exp := len(want.Tape)-len(pj.Tape), 7; got != exp {
+		t.Errorf("want %d entries saved, got %d", exp, got)
+	}
+	i := pj.Iter()
+	elem, err := i.FindElement(nil, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := elem.Iter.String(); err != nil || s != "short" {
+		t.Errorf("want %q, got %q (%v)", "short", s, err)
+	}
+	if err := elem.Iter.SetString("tiny"); err != nil {
+		t.Error(err)
+	}
+	if err := elem.Iter.SetString("too long to inline"); err == nil {
+		t.Error("want error replacing inline string with long string")
+	}
+	elem, err = i.FindElement(elem, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err := elem.Iter.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := arr.Iter()
+	floats, err := arr.AsFloat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFloats := []float64{-1, 2, 36028797018963967, 36028797018963968, 1.5}
+	for j := range wantFloats {
+		if floats[j] != wantFloats[j] {
+			t.Errorf("index %d: want %v, got %v", j, wantFloats[j], floats[j])
+		}
+	}
+	it.Advance()
+	if v, err := it.Int(); err != nil || v != -1 {
+		t.Errorf("want -1, got %d (%v)", v, err)
+	}
+	if err := it.SetInt(100); err != nil {
+		t.Error(err)
+	}
+	if err := it.SetInt(math.MaxInt64); err == nil {
+		t.Error("want error replacing inline integer with big integer")
+	}
+	got, err := pj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = `{"a":"tiny","long":"a longer string","n":[100,2,36028797018963967,36028797018963968,1.5]}`
+	if string(got) != exp {
+		t.Errorf("want %s, got %s", exp, got)
+	}
+}
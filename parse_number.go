@@ -17,8 +17,11 @@
 package simdjson
 
 import (
+	"bytes"
 	"errors"
 	"math"
+	"math/big"
+	"math/bits"
 	"reflect"
 	"strconv"
 	"unsafe"
@@ -31,6 +34,7 @@ const (
 	isEOVFlag
 	isDigitFlag
 	isMustHaveDigitNext
+	isExponentFlag
 )
 
 var isNumberRune = [256]uint8{
@@ -47,8 +51,8 @@ var isNumberRune = [256]uint8{
 	'.':  isPartOfNumberFlag | isFloatOnlyFlag | isMustHaveDigitNext,
 	'+':  isPartOfNumberFlag,
 	'-':  isPartOfNumberFlag | isMinusFlag | isMustHaveDigitNext,
-	'e':  isPartOfNumberFlag | isFloatOnlyFlag,
-	'E':  isPartOfNumberFlag | isFloatOnlyFlag,
+	'e':  isPartOfNumberFlag | isFloatOnlyFlag | isExponentFlag,
+	'E':  isPartOfNumberFlag | isFloatOnlyFlag | isExponentFlag,
 	',':  isEOVFlag,
 	'}':  isEOVFlag,
 	']':  isEOVFlag,
@@ -63,6 +67,13 @@ var isNumberRune = [256]uint8{
 // Any non-number characters at the end will be ignored.
 // Returns TagEnd if no valid value found be found.
 func parseNumber(buf []byte) (id, val uint64) {
+	return parseNumberFlags(buf, false)
+}
+
+// parseNumberFlags will parse the number starting in the buffer like parseNumber.
+// If precision is set, floats will also get the precision and notation flags,
+// see WithFloatPrecisionFlags.
+func parseNumberFlags(buf []byte, precision bool) (id, val uint64) {
 	pos := 0
 	found := uint8(0)
 	for i, v := range buf {
@@ -129,11 +140,127 @@ func parseNumber(buf []byte) (id, val uint64) {
 	}
 	f64, err := strconv.ParseFloat(unsafeBytesToString(buf[:pos]), 64)
 	if err == nil {
-		return floatTag, math.Float64bits(f64)
+		if !precision {
+			return floatTag, math.Float64bits(f64)
+		}
+		if found&isExponentFlag != 0 {
+			floatTag |= uint64(FloatFromExponent)
+		}
+		return floatTag | floatPrecisionFlags(buf[:pos], found&isExponentFlag != 0, f64), math.Float64bits(f64)
 	}
 	return 0, 0
 }
 
+// maxSafeInteger is the biggest integer where all smaller integers can be represented by a float64.
+const maxSafeInteger = 1<<53 - 1
+
+// pow5 contains powers of 5 that fit within an uint64.
+var pow5 = [...]uint64{
+	1, 5, 25, 125, 625, 3125, 15625, 78125, 390625, 1953125, 9765625, 48828125, 244140625,
+	1220703125, 6103515625, 30517578125, 152587890625, 762939453125, 3814697265625,
+	19073486328125, 95367431640625, 476837158203125, 2384185791015625, 11920928955078125,
+	59604644775390625, 298023223876953125, 1490116119384765625, 7450580596923828125,
+}
+
+// floatPrecisionFlags returns the precision related flags of
+// the valid JSON number in b, which was parsed as f.
+func floatPrecisionFlags(b []byte, hasExp bool, f float64) uint64 {
+	var flags uint64
+	if math.Abs(f) > maxSafeInteger {
+		flags |= uint64(FloatExceedsSafeInteger)
+	}
+
+	mantEnd, exp := len(b), 0
+	if hasExp {
+		mantEnd = bytes.IndexAny(b, "eE")
+		neg := false
+		for _, c := range b[mantEnd+1:] {
+			switch {
+			case c == '-':
+				neg = true
+			case c >= '0' && c <= '9' && exp < 1<<16:
+				exp = exp*10 + int(c-'0')
+			}
+		}
+		if neg {
+			exp = -exp
+		}
+	}
+	mantissa := b[:mantEnd]
+	if f == 0 {
+		if bytes.ContainsAny(mantissa, "123456789") {
+			flags |= uint64(FloatUnderflowToZero | FloatInexact)
+		}
+		return flags
+	}
+
+	// Fast path: A value with decimals can only be exact if the last
+	// significant digit is 5.
+	exp10 := exp
+	if dot := bytes.IndexByte(mantissa, '.'); dot >= 0 {
+		exp10 -= len(mantissa) - dot - 1
+	}
+	last := len(mantissa) - 1
+	for ; mantissa[last] == '0' || mantissa[last] == '.'; last-- {
+		if mantissa[last] == '0' {
+			exp10++
+		}
+	}
+	if exp10 < 0 && mantissa[last] != '5' {
+		return flags | uint64(FloatInexact)
+	}
+
+	// Collect up to 19 significant digits in mant.
+	var mant uint64
+	var digits int
+	for _, c := range mantissa[:last+1] {
+		if c < '0' || c > '9' || (c == '0' && digits == 0) {
+			continue
+		}
+		if digits == 19 {
+			// More significant digits than we can track.
+			want, ok := new(big.Rat).SetString(string(b))
+			if !ok || want.Cmp(new(big.Rat).SetFloat64(f)) != 0 {
+				flags |= uint64(FloatInexact)
+			}
+			return flags
+		}
+		mant = mant*10 + uint64(c-'0')
+		digits++
+	}
+	if !decimalIsExact(mant, exp10) {
+		flags |= uint64(FloatInexact)
+	}
+	return flags
+}
+
+// decimalIsExact returns whether mant * 10^exp10 can be represented exactly by a float64.
+// The value must be within float64 range.
+func decimalIsExact(mant uint64, exp10 int) bool {
+	if mant == 0 {
+		return true
+	}
+	for mant%10 == 0 {
+		mant /= 10
+		exp10++
+	}
+	if exp10 >= 0 {
+		// mant * 2^exp10 * 5^exp10. The odd part must fit within the 53 bit mantissa.
+		if exp10 >= len(pow5) {
+			return false
+		}
+		hi, lo := bits.Mul64(mant>>bits.TrailingZeros64(mant), pow5[exp10])
+		return hi == 0 && lo <= 1<<53
+	}
+	// mant / (2^k * 5^k). Only exact if 5^k divides mant.
+	k := -exp10
+	if k >= len(pow5) || mant%pow5[k] != 0 {
+		return false
+	}
+	mant /= pow5[k]
+	return mant>>bits.TrailingZeros64(mant) <= 1<<53
+}
+
 // unsafeBytesToString should only be used when we have control of b.
 func unsafeBytesToString(b []byte) (s string) {
 	var length = len(b)
@@ -19,6 +19,7 @@ package simdjson
 import (
 	"fmt"
 	"math"
+	"math/big"
 	"math/rand"
 	"regexp"
 	"strconv"
@@ -195,3 +196,37 @@ func initAtofOnce() {
 		benchmarksRandomNormalSimd[i] = benchmarksRandomNormal[i] + ":"
 	}
 }
+
+func TestFloatPrecisionFlags(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 100000; i++ {
+		var s string
+		switch i % 4 {
+		case 0:
+			s = strconv.FormatFloat(rng.NormFloat64()*math.Pow10(rng.Intn(40)-20), 'g', -1, 64)
+		case 1:
+			s = fmt.Sprintf("%d.%d", rng.Intn(1000), rng.Intn(1000))
+		case 2:
+			s = fmt.Sprintf("%de%d", rng.Int63n(1e6)*5, rng.Intn(60)-30)
+		default:
+			s = fmt.Sprintf("%d.%05de%d", rng.Int63(), rng.Intn(100)*25, rng.Intn(40)-20)
+		}
+		tag, val := parseNumberFlags([]byte(s), true)
+		if Tag(tag>>JSONTAGOFFSET) != TagFloat {
+			continue
+		}
+		f := math.Float64frombits(val)
+		want, ok := new(big.Rat).SetString(s)
+		if !ok {
+			t.Fatal("unable to parse", s)
+		}
+		exact := want.Cmp(new(big.Rat).SetFloat64(f)) == 0
+		flags := FloatFlags(tag & JSONVALUEMASK)
+		if flags.Contains(FloatInexact) == exact {
+			t.Fatalf("%s: inexact flag: %v, exact: %v", s, flags.Contains(FloatInexact), exact)
+		}
+		if flags.Contains(FloatExceedsSafeInteger) != (math.Abs(f) > 1<<53-1) {
+			t.Fatalf("%s: exceeds safe integer flag mismatch", s)
+		}
+	}
+}
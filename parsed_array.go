@@ -143,6 +143,9 @@ readArray:
 				return nil, errors.New("corrupt input: expected integer, but no more values")
 			}
 			dst = append(dst, float64(int64(a.tape.Tape[a.off])))
+		case TagIntegerInline:
+			dst = append(dst, float64(inlineInt(a.tape.Tape[a.off-1]&JSONVALUEMASK)))
+			continue
 		case TagUint:
 			if len(a.tape.Tape) <= a.off {
 				return nil, errors.New("corrupt input: expected integer, but no more values")
@@ -189,6 +192,9 @@ readArray:
 				return nil, errors.New("corrupt input: expected integer, but no more values")
 			}
 			dst = append(dst, int64(a.tape.Tape[a.off]))
+		case TagIntegerInline:
+			dst = append(dst, inlineInt(a.tape.Tape[a.off-1]&JSONVALUEMASK))
+			continue
 		case TagUint:
 			if len(a.tape.Tape) <= a.off {
 				return nil, errors.New("corrupt input: expected integer, but no more values")
@@ -199,7 +205,7 @@ readArray:
 				return nil, errors.New("unsigned integer value overflows int64")
 			}
 
-			dst = append(dst)
+			dst = append(dst, int64(val))
 		case TagArrayEnd:
 			break readArray
 		default:
@@ -245,6 +251,13 @@ readArray:
 				return nil, errors.New("int64 value is negative")
 			}
 			dst = append(dst, uint64(val))
+		case TagIntegerInline:
+			val := inlineInt(a.tape.Tape[a.off-1] & JSONVALUEMASK)
+			if val < 0 {
+				return nil, errors.New("int64 value is negative")
+			}
+			dst = append(dst, uint64(val))
+			continue
 		case TagUint:
 			if len(a.tape.Tape) <= a.off {
 				return nil, errors.New("corrupt input: expected integer, but no more values")
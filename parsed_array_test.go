@@ -0,0 +1,70 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"math"
+	"testing"
+)
+
+func TestArray_AsInteger(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"a":[1,-2,3.5,4],"u":[18446744073709551615]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	array := func(key string) *Array {
+		t.Helper()
+		i := pj.Iter()
+		elem, err := i.FindElement(nil, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arr, err := elem.Iter.Array(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return arr
+	}
+	// Store an unsigned value that fits in int64.
+	it := array("a").Iter()
+	for n := 0; n < 4; n++ {
+		it.Advance()
+	}
+	if err := it.SetUInt(math.MaxInt64); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := array("a").AsInteger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{1, -2, 3, math.MaxInt64}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("index %d: want %d, got %d", i, want[i], got[i])
+		}
+	}
+	if _, err := array("u").AsInteger(); err == nil {
+		t.Error("want overflow error")
+	}
+}
@@ -0,0 +1,323 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Builder can be used to construct a tape directly without parsing JSON.
+// Values are added in document order.
+// Each top level value is added as a separate root element, similar to NDJSON.
+// The first error encountered is kept and returned by Finish.
+// Subsequent calls are ignored after an error.
+// The zero value is ready to use.
+type Builder struct {
+	pj    ParsedJson
+	stack []builderFrame
+	err   error
+}
+
+type builderFrame struct {
+	off     int  // tape offset of the opening tag
+	tag     Tag  // TagRoot, TagObjectStart or TagArrayStart
+	wantKey bool // the object expects a key next
+}
+
+// NewBuilder returns a new Builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Reset the builder so it can be reused.
+// This will reuse the buffers of the last ParsedJson returned by Finish.
+func (b *Builder) Reset() {
+	b.pj.Tape = b.pj.Tape[:0]
+	if b.pj.Strings != nil {
+		b.pj.Strings.B = b.pj.Strings.B[:0]
+	}
+	b.pj.Message = nil
+	b.pj.meta = nil
+	b.stack = b.stack[:0]
+	b.err = nil
+}
+
+// Err returns the first error encountered, if any.
+func (b *Builder) Err() error {
+	return b.err
+}
+
+// Finish returns the constructed tape.
+// All objects and arrays must be closed.
+// The returned value is only valid until the Builder is reset.
+func (b *Builder) Finish() (*ParsedJson, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.stack) > 0 {
+		return nil, fmt.Errorf("builder: %d objects or arrays not closed", len(b.stack))
+	}
+	if b.pj.Strings == nil {
+		b.pj.Strings = &TStrings{}
+	}
+	return &b.pj, nil
+}
+
+// BeginObject starts a new object.
+// Add keys and values and close it with EndObject.
+func (b *Builder) BeginObject() {
+	b.open(TagObjectStart)
+}
+
+// EndObject closes the current object.
+func (b *Builder) EndObject() {
+	b.close(TagObjectStart, TagObjectEnd)
+}
+
+// BeginArray starts a new array.
+// Add values and close it with EndArray.
+func (b *Builder) BeginArray() {
+	b.open(TagArrayStart)
+}
+
+// EndArray closes the current array.
+func (b *Builder) EndArray() {
+	b.close(TagArrayStart, TagArrayEnd)
+}
+
+// Key adds an object key. It must be followed by a value.
+func (b *Builder) Key(k string) {
+	if b.err != nil {
+		return
+	}
+	if len(b.stack) == 0 || !b.stack[len(b.stack)-1].wantKey {
+		b.err = errors.New("builder: unexpected object key")
+		return
+	}
+	b.stack[len(b.stack)-1].wantKey = false
+	b.writeString(k)
+}
+
+// String adds a string value.
+func (b *Builder) String(v string) {
+	if !b.beginValue() {
+		return
+	}
+	b.writeString(v)
+	b.endValue()
+}
+
+// StringBytes adds a string value.
+func (b *Builder) StringBytes(v []byte) {
+	if !b.beginValue() {
+		return
+	}
+	b.writeString(string(v))
+	b.endValue()
+}
+
+// Int adds an integer value.
+func (b *Builder) Int(v int64) {
+	if !b.beginValue() {
+		return
+	}
+	b.pj.Tape = append(b.pj.Tape, uint64(TagInteger)<<JSONTAGOFFSET, uint64(v))
+	b.endValue()
+}
+
+// Uint adds an unsigned integer value.
+func (b *Builder) Uint(v uint64) {
+	if !b.beginValue() {
+		return
+	}
+	b.pj.Tape = append(b.pj.Tape, uint64(TagUint)<<JSONTAGOFFSET, v)
+	b.endValue()
+}
+
+// Float adds a float value.
+// NaN and infinite values are not allowed.
+func (b *Builder) Float(v float64) {
+	if b.err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		b.err = fmt.Errorf("builder: invalid float value %v", v)
+		return
+	}
+	if !b.beginValue() {
+		return
+	}
+	b.pj.Tape = append(b.pj.Tape, uint64(TagFloat)<<JSONTAGOFFSET, math.Float64bits(v))
+	b.endValue()
+}
+
+// Bool adds a boolean value.
+func (b *Builder) Bool(v bool) {
+	if !b.beginValue() {
+		return
+	}
+	if v {
+		b.pj.Tape = append(b.pj.Tape, uint64(TagBoolTrue)<<JSONTAGOFFSET)
+	} else {
+		b.pj.Tape = append(b.pj.Tape, uint64(TagBoolFalse)<<JSONTAGOFFSET)
+	}
+	b.endValue()
+}
+
+// Null adds a null value.
+func (b *Builder) Null() {
+	if !b.beginValue() {
+		return
+	}
+	b.pj.Tape = append(b.pj.Tape, uint64(TagNull)<<JSONTAGOFFSET)
+	b.endValue()
+}
+
+// Interface adds a Go value.
+// The types returned by Iter.Interface are supported:
+// nil, bool, string, all integer types, float32, float64,
+// []interface{} and map[string]interface{}.
+// Map keys are added in sorted order.
+func (b *Builder) Interface(v interface{}) {
+	if b.err != nil {
+		return
+	}
+	switch v := v.(type) {
+	case nil:
+		b.Null()
+	case bool:
+		b.Bool(v)
+	case string:
+		b.String(v)
+	case int:
+		b.Int(int64(v))
+	case int8:
+		b.Int(int64(v))
+	case int16:
+		b.Int(int64(v))
+	case int32:
+		b.Int(int64(v))
+	case int64:
+		b.Int(v)
+	case uint:
+		b.Uint(uint64(v))
+	case uint8:
+		b.Uint(uint64(v))
+	case uint16:
+		b.Uint(uint64(v))
+	case uint32:
+		b.Uint(uint64(v))
+	case uint64:
+		b.Uint(v)
+	case float32:
+		b.Float(float64(v))
+	case float64:
+		b.Float(v)
+	case []interface{}:
+		b.BeginArray()
+		for _, e := range v {
+			b.Interface(e)
+		}
+		b.EndArray()
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.BeginObject()
+		for _, k := range keys {
+			b.Key(k)
+			b.Interface(v[k])
+		}
+		b.EndObject()
+	default:
+		b.err = fmt.Errorf("builder: unsupported type %T", v)
+	}
+}
+
+// beginValue checks that a value can be added and opens a root if needed.
+func (b *Builder) beginValue() bool {
+	if b.err != nil {
+		return false
+	}
+	if len(b.stack) == 0 {
+		b.stack = append(b.stack, builderFrame{off: len(b.pj.Tape), tag: TagRoot})
+		b.pj.Tape = append(b.pj.Tape, uint64(TagRoot)<<JSONTAGOFFSET)
+		return true
+	}
+	if b.stack[len(b.stack)-1].wantKey {
+		b.err = errors.New("builder: object key expected")
+		return false
+	}
+	return true
+}
+
+// endValue must be called when a value has been completed.
+func (b *Builder) endValue() {
+	if len(b.stack) == 0 {
+		return
+	}
+	f := &b.stack[len(b.stack)-1]
+	switch f.tag {
+	case TagObjectStart:
+		f.wantKey = true
+	case TagRoot:
+		// Close the root
+		end := len(b.pj.Tape) + 1
+		b.pj.Tape[f.off] = uint64(TagRoot)<<JSONTAGOFFSET | uint64(end)
+		b.pj.Tape = append(b.pj.Tape, uint64(TagRoot)<<JSONTAGOFFSET|uint64(f.off))
+		b.stack = b.stack[:len(b.stack)-1]
+	}
+}
+
+func (b *Builder) open(tag Tag) {
+	if !b.beginValue() {
+		return
+	}
+	b.stack = append(b.stack, builderFrame{off: len(b.pj.Tape), tag: tag, wantKey: tag == TagObjectStart})
+	b.pj.Tape = append(b.pj.Tape, uint64(tag)<<JSONTAGOFFSET)
+}
+
+func (b *Builder) close(open, close Tag) {
+	if b.err != nil {
+		return
+	}
+	if len(b.stack) == 0 || b.stack[len(b.stack)-1].tag != open {
+		b.err = fmt.Errorf("builder: unexpected %v", close)
+		return
+	}
+	f := b.stack[len(b.stack)-1]
+	if !f.wantKey && open == TagObjectStart {
+		b.err = errors.New("builder: object key without value")
+		return
+	}
+	b.stack = b.stack[:len(b.stack)-1]
+	end := len(b.pj.Tape) + 1
+	b.pj.Tape[f.off] = uint64(open)<<JSONTAGOFFSET | uint64(end)
+	b.pj.Tape = append(b.pj.Tape, uint64(close)<<JSONTAGOFFSET|uint64(f.off))
+	b.endValue()
+}
+
+func (b *Builder) writeString(s string) {
+	if b.pj.Strings == nil {
+		b.pj.Strings = &TStrings{}
+	}
+	off := len(b.pj.Strings.B)
+	b.pj.Strings.B = append(b.pj.Strings.B, s...)
+	b.pj.Tape = append(b.pj.Tape, uint64(TagString)<<JSONTAGOFFSET|STRINGBUFBIT|uint64(off), uint64(len(s)))
+}
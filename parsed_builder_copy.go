@@ -0,0 +1,160 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Copy adds a copy of the current value of it.
+// Objects and arrays are copied with all their content.
+// The value can come from any ParsedJson, the tape entries are rebased
+// and strings are copied to the string buffer of the builder,
+// so the result does not reference the source.
+// If it is at a root element, the content of the root is copied.
+// If it has not been advanced, like the iterator returned by ParsedJson.Iter,
+// it is advanced to the first value, so the first root is copied.
+func (b *Builder) Copy(it Iter) {
+	if b.err != nil {
+		return
+	}
+	if it.t == TagEnd && it.Advance() == TypeNone {
+		b.err = errors.New("builder: no value to copy")
+		return
+	}
+	if it.t == TagRoot {
+		if _, _, err := it.Root(&it); err != nil {
+			b.err = fmt.Errorf("builder: %w", err)
+			return
+		}
+	}
+	if !b.beginValue() {
+		return
+	}
+	if err := b.copyValue(&it.tape, it.off-1, it.t); err != nil {
+		b.err = fmt.Errorf("builder: %w", err)
+		return
+	}
+	b.endValue()
+}
+
+// CopyValue adds an object key with a copy of the current value of it.
+func (b *Builder) CopyValue(key string, it Iter) {
+	b.Key(key)
+	b.Copy(it)
+}
+
+// CopyFields adds copies of fields of obj to the current object.
+// Fields are added in the order of keys and keys that are not in obj are skipped.
+// If no keys are specified all fields are copied in the order of obj.
+func (b *Builder) CopyFields(obj *Object, keys ...string) {
+	if b.err != nil {
+		return
+	}
+	if len(keys) == 0 {
+		// Iterate a copy, so obj is not advanced.
+		o := *obj
+		var i Iter
+		for b.err == nil {
+			name, t, err := o.NextElementBytes(&i)
+			if err != nil {
+				b.err = fmt.Errorf("builder: %w", err)
+				return
+			}
+			if t == TypeNone {
+				return
+			}
+			b.CopyValue(string(name), i)
+		}
+		return
+	}
+	var elem Element
+	for _, k := range keys {
+		if obj.FindKey(k, &elem) == nil {
+			continue
+		}
+		b.CopyValue(k, elem.Iter)
+	}
+}
+
+// CopyElements adds copies of all elements of arr.
+// Calling CopyElements with several arrays between BeginArray and EndArray
+// will concatenate the arrays.
+func (b *Builder) CopyElements(arr *Array) {
+	i := arr.Iter()
+	for b.err == nil && i.Advance() != TypeNone {
+		b.Copy(i)
+	}
+}
+
+// copyValue appends the value with the specified tag at tape offset off of src.
+func (b *Builder) copyValue(src *ParsedJson, off int, tag Tag) error {
+	tape := src.Tape
+	if off < 0 || off >= len(tape) {
+		return fmt.Errorf("copy offset %d outside tape", off)
+	}
+	end := off + 1
+	switch tag {
+	case TagObjectStart, TagArrayStart:
+		end = int(tape[off] & JSONVALUEMASK)
+	case TagString, TagInteger, TagUint, TagFloat:
+		end = off + 2
+	case TagBoolTrue, TagBoolFalse, TagNull, TagStringInline, TagIntegerInline:
+	default:
+		return fmt.Errorf("cannot copy %v", tag)
+	}
+	if end <= off || end > len(tape) {
+		return fmt.Errorf("corrupt input: %v at offset %d extends beyond tape", tag, off)
+	}
+
+	base := len(b.pj.Tape)
+	for pos := off; pos < end; pos++ {
+		v := tape[pos]
+		switch Tag(v >> JSONTAGOFFSET) {
+		case TagObjectStart, TagArrayStart, TagObjectEnd, TagArrayEnd:
+			// Rebase offset of the matching tag.
+			p := int(v & JSONVALUEMASK)
+			if p < off || p > end {
+				return fmt.Errorf("corrupt input: offset %d of %v outside copied value", p, Tag(v>>JSONTAGOFFSET))
+			}
+			v = v&JSONTAGMASK | uint64(base+p-off)
+		case TagString:
+			if pos+1 >= end {
+				return fmt.Errorf("corrupt input: no string length at offset %d", pos)
+			}
+			s, err := src.stringByteAt(v&JSONVALUEMASK, tape[pos+1])
+			if err != nil {
+				return err
+			}
+			b.writeString(string(s))
+			pos++
+			continue
+		case TagInteger, TagUint, TagFloat:
+			if pos+1 >= end {
+				return fmt.Errorf("corrupt input: no value at offset %d", pos)
+			}
+			b.pj.Tape = append(b.pj.Tape, v, tape[pos+1])
+			pos++
+			continue
+		case TagRoot, TagEnd:
+			return fmt.Errorf("corrupt input: unexpected %v at offset %d", Tag(v>>JSONTAGOFFSET), pos)
+		}
+		b.pj.Tape = append(b.pj.Tape, v)
+	}
+	return nil
+}
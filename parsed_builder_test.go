@@ -0,0 +1,268 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	var b Builder
+	b.BeginObject()
+	b.Key("str")
+	b.String("a\"b")
+	b.Key("int")
+	b.Int(-42)
+	b.Key("uint")
+	b.Uint(math.MaxUint64)
+	b.Key("float")
+	b.Float(1.5)
+	b.Key("arr")
+	b.BeginArray()
+	b.Bool(true)
+	b.Bool(false)
+	b.Null()
+	b.BeginObject()
+	b.EndObject()
+	b.BeginArray()
+	b.EndArray()
+	b.EndArray()
+	b.Key("map")
+	b.Interface(map[string]interface{}{"b": []interface{}{1, "x"}, "a": nil})
+	b.EndObject()
+	// Second root
+	b.StringBytes([]byte("second"))
+
+	pj, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := pj.Iter()
+	got, err := iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"str":"a\"b","int":-42,"uint":18446744073709551615,"float":1.5,"arr":[true,false,null,{},[]],"map":{"a":null,"b":[1,"x"]}}` + "\n" + `"second"`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// Check roots are usable.
+	n := 0
+	err = pj.ForEach(func(i Iter) error {
+		n++
+		if n == 1 {
+			e, err := i.FindElement(nil, "arr")
+			if err != nil {
+				return err
+			}
+			if e.Type != TypeArray {
+				t.Errorf("want array, got %v", e.Type)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("want 2 roots, got %d", n)
+	}
+
+	// Reuse
+	b.Reset()
+	b.Int(1)
+	pj, err = b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter = pj.Iter()
+	got, err = iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "1" {
+		t.Fatalf("got %s", got)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := map[string]func(b *Builder){
+		"key-at-root":      func(b *Builder) { b.Key("a") },
+		"value-for-key":    func(b *Builder) { b.BeginObject(); b.Int(1) },
+		"key-in-array":     func(b *Builder) { b.BeginArray(); b.Key("a") },
+		"missing-value":    func(b *Builder) { b.BeginObject(); b.Key("a"); b.EndObject() },
+		"unclosed":         func(b *Builder) { b.BeginArray() },
+		"mismatched-close": func(b *Builder) { b.BeginArray(); b.EndObject() },
+		"close-at-root":    func(b *Builder) { b.EndArray() },
+		"nan":              func(b *Builder) { b.Float(math.NaN()) },
+		"unsupported":      func(b *Builder) { b.Interface(struct{}{}) },
+	}
+	for name, fn := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b Builder
+			fn(&b)
+			if _, err := b.Finish(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestBuilderCopy(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	a, err := Parse([]byte(`{"id":7,"user":{"name":"gopher","tags":["x","yy"]},"items":[1,2],"skip":true}`), nil, WithCopyStrings(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Parse([]byte(`{"items":[3,{"k":"a longer string"}],"ok":false,"n":1.5}`), nil, WithCompactTape(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	object := func(pj *ParsedJson) *Object {
+		t.Helper()
+		i := pj.Iter()
+		i.Advance()
+		_, root, err := i.Root(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := root.Object(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+	find := func(obj *Object, key string) Iter {
+		t.Helper()
+		elem := obj.FindKey(key, nil)
+		if elem == nil {
+			t.Fatalf("key %q not found", key)
+		}
+		return elem.Iter
+	}
+	objA, objB := object(a), object(b)
+	itemsA, itemsB := find(objA, "items"), find(objB, "items")
+	arrA, err := itemsA.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrB, err := itemsB.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bld Builder
+	bld.BeginObject()
+	bld.CopyFields(objB, "n", "missing", "ok")
+	bld.CopyValue("who", find(objA, "user"))
+	bld.Key("items")
+	bld.BeginArray()
+	bld.CopyElements(arrA)
+	bld.CopyElements(arrB)
+	bld.EndArray()
+	bld.Key("computed")
+	bld.Int(42)
+	bld.Key("all")
+	bld.BeginObject()
+	bld.CopyFields(objA)
+	bld.EndObject()
+	bld.EndObject()
+	// Roots are copied as their content.
+	ri := b.Iter()
+	ri.Advance()
+	bld.Copy(ri)
+
+	pj, err := bld.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Modifying the sources must not affect the result.
+	for i := range a.Message {
+		a.Message[i] = 'x'
+	}
+	a.Strings.B = a.Strings.B[:0]
+	b.Strings.B = b.Strings.B[:0]
+
+	iter := pj.Iter()
+	got, err := iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"n":1.5,"ok":false,"who":{"name":"gopher","tags":["x","yy"]},"items":[1,2,3,{"k":"a longer string"}],"computed":42,` +
+		`"all":{"id":7,"user":{"name":"gopher","tags":["x","yy"]},"items":[1,2],"skip":true}}` + "\n" +
+		`{"items":[3,{"k":"a longer string"}],"ok":false,"n":1.5}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// The result must be a valid standalone tape.
+	s := NewSerializer()
+	pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter = pj2.Iter()
+	if got2, err := iter.MarshalJSON(); err != nil || string(got2) != want {
+		t.Fatalf("got  %s (%v)\nwant %s", got2, err, want)
+	}
+
+	// Keys must be added in objects.
+	bld.Reset()
+	bld.BeginArray()
+	bld.CopyFields(objB)
+	if _, err := bld.Finish(); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestBuilderCopyIter(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := ParseND([]byte("{\"a\":[1,\"x\"]}\n{\"b\":2}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An iterator that has not been advanced copies the first root.
+	var bld Builder
+	bld.Copy(pj.Iter())
+	got, err := bld.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := got.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"a":[1,"x"]}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	// An iterator at the end has nothing to copy.
+	i := pj.Iter()
+	for i.Advance() != TypeNone {
+	}
+	bld.Reset()
+	bld.Copy(i)
+	if _, err := bld.Finish(); err == nil {
+		t.Error("expected error")
+	}
+}
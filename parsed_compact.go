@@ -0,0 +1,95 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+// Inline values on compact tapes use a single tape entry.
+//
+// TagStringInline: The string bytes are stored in bits 0-47,
+// with the first byte in the lowest bits, and the length in bits 48-55.
+//
+// TagIntegerInline: The value is stored as a 56 bit two's complement integer.
+const (
+	maxInlineString   = 6
+	inlineLengthShift = 48
+)
+
+// littleEndian is true if the tape can be used directly as string bytes.
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// inlineInt returns the value stored in an inline integer payload.
+func inlineInt(payload uint64) int64 {
+	return int64(payload<<(64-JSONTAGOFFSET)) >> (64 - JSONTAGOFFSET)
+}
+
+// fitsInlineInt returns whether v can be stored as an inline integer.
+func fitsInlineInt(v int64) bool {
+	return inlineInt(uint64(v)&JSONVALUEMASK) == v
+}
+
+// inlineIntEntry returns the tape entry of an inline integer.
+func inlineIntEntry(v int64) uint64 {
+	return uint64(TagIntegerInline)<<JSONTAGOFFSET | uint64(v)&JSONVALUEMASK
+}
+
+// inlineStringEntry returns the tape entry of an inline string.
+// b must be at most maxInlineString bytes.
+func inlineStringEntry(b []byte) uint64 {
+	var tmp [8]byte
+	copy(tmp[:maxInlineString], b)
+	return uint64(TagStringInline)<<JSONTAGOFFSET | uint64(len(b))<<inlineLengthShift | binary.LittleEndian.Uint64(tmp[:])
+}
+
+// inlineStringBytes returns the bytes of the inline string at tape[off].
+// On little endian platforms the returned slice points to the tape.
+func inlineStringBytes(tape []uint64, off int) ([]byte, error) {
+	v := tape[off]
+	n := int(v>>inlineLengthShift) & 0xff
+	if n > maxInlineString {
+		return nil, errors.New("inline string too long")
+	}
+	if littleEndian {
+		return (*[8]byte)(unsafe.Pointer(&tape[off]))[:n:n], nil
+	}
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	return append([]byte{}, tmp[:n]...), nil
+}
+
+// tapeStringBytes returns the string at tape offset off,
+// which can be a regular or an inline string.
+func (pj *ParsedJson) tapeStringBytes(off int) ([]byte, error) {
+	v := pj.Tape[off]
+	switch Tag(v >> JSONTAGOFFSET) {
+	case TagString:
+		if off+1 >= len(pj.Tape) {
+			return nil, errors.New("corrupt input: no string length on tape")
+		}
+		return pj.stringByteAt(v&JSONVALUEMASK, pj.Tape[off+1])
+	case TagStringInline:
+		return inlineStringBytes(pj.Tape, off)
+	}
+	return nil, errors.New("value is not string")
+}
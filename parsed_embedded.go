@@ -0,0 +1,215 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ParseEmbedded parses the string value of the iterator as JSON.
+// This can be used for fields containing double-encoded JSON, like `{"msg":"{\"user\":1}"}`.
+// The unescaped string is copied, so the returned value does not reference the iterator tape.
+// An optional block of previously parsed json can be supplied to reduce allocations.
+func (i *Iter) ParseEmbedded(reuse *ParsedJson) (*ParsedJson, error) {
+	if i.t != TagString && i.t != TagStringInline {
+		return nil, fmt.Errorf("cannot parse embedded json from type %v", i.t.Type())
+	}
+	b, err := i.StringBytes()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(append([]byte(nil), b...), reuse)
+}
+
+// ExpandEmbedded returns a copy of pj where string values at the given paths
+// are replaced by their content parsed as JSON.
+// Paths are matched within every root element.
+// Values at the paths that are not strings are left unchanged,
+// but strings that cannot be parsed will return an error.
+// The returned tape does not reference pj.
+func ExpandEmbedded(pj *ParsedJson, paths ...Path) (*ParsedJson, error) {
+	targets, err := pj.findPaths(paths, func(t Tag) bool { return t == TagString || t == TagStringInline })
+	if err != nil {
+		return nil, err
+	}
+	var embedded *ParsedJson
+	var buf []byte
+	return rewriteTape(pj, targets, func(b *Builder, it Iter, p Path) error {
+		s, err := it.StringBytes()
+		if err != nil {
+			return err
+		}
+		// Copy, since the parsed message must stay valid until strings are copied.
+		buf = append(buf[:0], s...)
+		embedded, err = Parse(buf, embedded)
+		if err != nil {
+			return fmt.Errorf("parsing embedded json at %v: %w", p, err)
+		}
+		// Copy the content of the root element.
+		b.Copy(embedded.Iter())
+		return nil
+	})
+}
+
+// Stringify returns a copy of pj where values at the given paths are
+// replaced by strings containing their JSON encoding.
+// This is the inverse of ExpandEmbedded.
+// Paths are matched within every root element.
+// The returned tape does not reference pj.
+func Stringify(pj *ParsedJson, paths ...Path) (*ParsedJson, error) {
+	targets, err := pj.findPaths(paths, nil)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	return rewriteTape(pj, targets, func(b *Builder, it Iter, p Path) error {
+		buf, err = it.MarshalJSONBuffer(buf[:0])
+		if err != nil {
+			return err
+		}
+		b.StringBytes(buf)
+		return nil
+	})
+}
+
+// rewriteTape copies all root elements of pj to a new tape.
+// Values at the offsets in targets are not copied, but fn is called instead,
+// which must add a single value to b.
+func rewriteTape(pj *ParsedJson, targets map[int]Path, fn func(b *Builder, it Iter, p Path) error) (*ParsedJson, error) {
+	offs := make([]int, 0, len(targets))
+	for off := range targets {
+		offs = append(offs, off)
+	}
+	sort.Ints(offs)
+	r := tapeRewriter{b: NewBuilder(), targets: targets, offs: offs, fn: fn}
+	i := pj.Iter()
+	var root Iter
+	for i.Advance() == TypeRoot {
+		if _, _, err := i.Root(&root); err != nil {
+			return nil, err
+		}
+		if err := r.value(root); err != nil {
+			return nil, err
+		}
+	}
+	return r.b.Finish()
+}
+
+// tapeRewriter copies values to a Builder, replacing the values at target offsets.
+type tapeRewriter struct {
+	b       *Builder
+	targets map[int]Path
+	offs    []int // sorted offsets of targets
+	fn      func(b *Builder, it Iter, p Path) error
+}
+
+// value copies the current value of it.
+// Values without targets are copied as a whole,
+// otherwise objects and arrays are rebuilt element by element.
+func (r *tapeRewriter) value(it Iter) error {
+	off := it.off - 1
+	if p, ok := r.targets[off]; ok {
+		if err := r.fn(r.b, it, p); err != nil {
+			return err
+		}
+		return r.b.Err()
+	}
+	switch it.t {
+	case TagObjectStart, TagArrayStart:
+	default:
+		r.b.Copy(it)
+		return r.b.Err()
+	}
+	// Check if any target is inside the container.
+	if idx := sort.SearchInts(r.offs, off); idx == len(r.offs) || uint64(r.offs[idx]) >= it.cur {
+		r.b.Copy(it)
+		return r.b.Err()
+	}
+	if it.t == TagArrayStart {
+		arr, err := it.Array(nil)
+		if err != nil {
+			return err
+		}
+		r.b.BeginArray()
+		elems := arr.Iter()
+		for elems.Advance() != TypeNone {
+			if err := r.value(elems); err != nil {
+				return err
+			}
+		}
+		r.b.EndArray()
+		return r.b.Err()
+	}
+	obj, err := it.Object(nil)
+	if err != nil {
+		return err
+	}
+	r.b.BeginObject()
+	var elem Iter
+	for {
+		name, t, err := obj.NextElementBytes(&elem)
+		if err != nil {
+			return err
+		}
+		if t == TypeNone {
+			break
+		}
+		r.b.Key(string(name))
+		if err := r.value(elem); err != nil {
+			return err
+		}
+	}
+	r.b.EndObject()
+	return r.b.Err()
+}
+
+// findPaths returns the tape offsets of all values matching one of the paths.
+// If filter is non-nil only values with tags accepted by the filter are returned.
+func (pj *ParsedJson) findPaths(paths []Path, filter func(t Tag) bool) (map[int]Path, error) {
+	found := make(map[int]Path)
+	if len(paths) == 0 {
+		return found, nil
+	}
+	depths := make(map[int]struct{}, len(paths))
+	for _, p := range paths {
+		depths[len(p)] = struct{}{}
+	}
+	w := tapeWalker{pj: pj}
+	var buf Path
+	err := w.walk(func(off int, tag Tag, isKey bool) error {
+		if isKey || (filter != nil && !filter(tag)) {
+			return nil
+		}
+		if _, ok := depths[len(w.frames)]; !ok {
+			return nil
+		}
+		var err error
+		buf, err = w.path(buf[:0])
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if p.Equal(buf) {
+				found[off] = p
+				break
+			}
+		}
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,146 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIter_ParseEmbedded(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"msg":"{\"user\":1,\"tags\":[\"a\",\"b\\\"c\"]}","n":1}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := pj.Iter()
+	var e Element
+	if _, err := root.FindElement(&e, "msg"); err != nil {
+		t.Fatal(err)
+	}
+	emb, err := e.Iter.ParseEmbedded(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter := emb.Iter()
+	got, err := iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"user":1,"tags":["a","b\"c"]}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := root.FindElement(&e, "n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Iter.ParseEmbedded(nil); err == nil {
+		t.Error("expected error parsing number")
+	}
+}
+
+func TestExpandEmbedded(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = `{"id":1,"msg":"{\"user\":\"alice\",\"n\":[1,2.5]}","meta":{"raw":"[true,null]"}}
+{"id":2,"msg":"{}","meta":{"raw":5}}
+{"id":3,"other":"{\"x\":1}"}`
+	const expanded = `{"id":1,"msg":{"user":"alice","n":[1,2.5]},"meta":{"raw":[true,null]}}
+{"id":2,"msg":{},"meta":{"raw":5}}
+{"id":3,"other":"{\"x\":1}"}`
+
+	pj, err := ParseND([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []Path{{PathKey("msg")}, {PathKey("meta"), PathKey("raw")}}
+	exp, err := ExpandEmbedded(pj, paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The result must not reference the input.
+	for i := range pj.Message {
+		pj.Message[i] = 'x'
+	}
+	for i := range pj.Strings.B {
+		pj.Strings.B[i] = 'x'
+	}
+	iter := exp.Iter()
+	got, err := iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expanded {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, expanded)
+	}
+
+	// The expanded tape must be navigable.
+	var values []string
+	err = exp.ForEach(func(i Iter) error {
+		var e Element
+		if _, err := i.FindElement(&e, "msg", "user"); err == nil {
+			s, err := e.Iter.String()
+			values = append(values, s)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0] != "alice" {
+		t.Errorf("unexpected values: %v", values)
+	}
+
+	// Stringify should restore the input.
+	str, err := Stringify(exp, paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter = str.Iter()
+	got, err = iter.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(expanded, `"msg":{"user":"alice","n":[1,2.5]}`, `"msg":"{\"user\":\"alice\",\"n\":[1,2.5]}"`, 1)
+	want = strings.Replace(want, `"msg":{}`, `"msg":"{}"`, 1)
+	if string(got) != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExpandEmbeddedInvalid(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"a":["x","{\"b\":"]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Index 0 is not JSON.
+	_, err = ExpandEmbedded(pj, Path{PathKey("a"), PathIndex(0)})
+	if err == nil || !strings.Contains(err.Error(), "a[0]") {
+		t.Errorf("expected error containing path, got %v", err)
+	}
+	_, err = ExpandEmbedded(pj, Path{PathKey("a"), PathIndex(1)})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
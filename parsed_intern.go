@@ -0,0 +1,187 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+const (
+	// internMinEntries is the initial size of the intern table.
+	internMinEntries = 256
+	// internMaxEntries is the maximum size of the intern table.
+	// At most 3/4 of the entries are used, so 49152 strings can be interned.
+	internMaxEntries = 1 << 16
+)
+
+// internEntry is a string in the Strings buffer.
+// An off of 0 indicates an unfilled entry, otherwise it is the offset+1.
+type internEntry struct {
+	off, len int
+}
+
+// internTable contains the strings added while parsing with WithStringInterning.
+// It uses open addressing, so every string has a single entry and
+// equal copied strings of at most maxLen bytes share one offset.
+// When the table is full no more strings are added,
+// and equal strings that are not in the table can have different offsets.
+// The table is not modified once parsing has finished.
+type internTable struct {
+	entries []internEntry
+	n       int
+	maxLen  int
+	full    bool
+}
+
+// newInternTable returns a table for strings of at most maxLen bytes,
+// with an initial size of at least size entries.
+func newInternTable(maxLen, size int) *internTable {
+	n := internMinEntries
+	for n < size && n < internMaxEntries {
+		n <<= 1
+	}
+	return &internTable{entries: make([]internEntry, n), maxLen: maxLen}
+}
+
+// internString will look up the string at pj.Strings.B[start:start+size].
+// If an identical string has already been added the offset of that string is returned
+// and found will be true.
+// Otherwise the string is added to the table and start is returned.
+func (pj *internalParsedJson) internString(start, size int) (offset int, found bool) {
+	t := pj.internTable
+	strs := pj.Strings.B
+	sb := strs[start : start+size]
+	mask := len(t.entries) - 1
+	h := int(memHash(sb)) & mask
+	for ; t.entries[h].off != 0; h = (h + 1) & mask {
+		e := t.entries[h]
+		if e.len == size && bytes.Equal(strs[e.off-1:e.off-1+size], sb) {
+			return e.off - 1, true
+		}
+	}
+	// Keep the load below 3/4.
+	if (t.n+1)*4 > len(t.entries)*3 {
+		if len(t.entries) >= internMaxEntries {
+			t.full = true
+			return start, false
+		}
+		t.grow(strs)
+		return pj.internString(start, size)
+	}
+	t.entries[h] = internEntry{off: start + 1, len: size}
+	t.n++
+	return start, false
+}
+
+// grow doubles the size of the table.
+// strs is the Strings buffer containing the strings.
+func (t *internTable) grow(strs []byte) {
+	old := t.entries
+	t.entries = make([]internEntry, len(old)*2)
+	mask := len(t.entries) - 1
+	for _, e := range old {
+		if e.off == 0 {
+			continue
+		}
+		h := int(memHash(strs[e.off-1:e.off-1+e.len])) & mask
+		for t.entries[h].off != 0 {
+			h = (h + 1) & mask
+		}
+		t.entries[h] = e
+	}
+}
+
+// lookup returns the offset of key in strs, if it is in the table.
+func (t *internTable) lookup(strs []byte, key string) (offset int, found bool) {
+	mask := len(t.entries) - 1
+	for h := int(memHashString(key)) & mask; t.entries[h].off != 0; h = (h + 1) & mask {
+		e := t.entries[h]
+		if e.len == len(key) && string(strs[e.off-1:e.off-1+e.len]) == key {
+			return e.off - 1, true
+		}
+	}
+	return 0, false
+}
+
+// internIndex is the intern table of a tape.
+type internIndex struct {
+	table *internTable
+
+	// strings and strLen identify the buffer the table was built for.
+	// Changing strings on the tape appends to the buffer, which invalidates the index.
+	strings *TStrings
+	strLen  int
+}
+
+// newInternIndex returns an index with table for the Strings buffer strs.
+func newInternIndex(table *internTable, strs *TStrings) internIndex {
+	return internIndex{table: table, strings: strs, strLen: len(strs.B)}
+}
+
+// valid returns whether the index has been built for strs.
+func (x *internIndex) valid(strs *TStrings) bool {
+	return x.table != nil && strs == x.strings && len(strs.B) == x.strLen
+}
+
+// keyMatcher compares object keys to a key.
+// On tapes parsed with WithStringInterning copied keys are compared by offset.
+type keyMatcher struct {
+	key string
+
+	// interned is set if copied keys can be compared by offset.
+	interned bool
+	// off is the offset of the key in the Strings buffer, or -1 if it isn't there.
+	off int
+}
+
+// newKeyMatcher returns a matcher for key on pj.
+func (pj *ParsedJson) newKeyMatcher(key string) keyMatcher {
+	m := keyMatcher{key: key}
+	x := pj.meta.internIndex(pj.Strings)
+	if x == nil || len(key) == 0 || len(key) > x.table.maxLen {
+		return m
+	}
+	off, found := x.table.lookup(pj.Strings.B, key)
+	switch {
+	case found:
+		m.interned, m.off = true, off
+	case !x.table.full:
+		// Every copied string that fits the table is in it.
+		m.interned, m.off = true, -1
+	}
+	return m
+}
+
+// match returns whether the string at i is the key.
+// i must be at a string.
+func (m *keyMatcher) match(i *Iter) (bool, error) {
+	if m.interned && i.t == TagString && i.cur&STRINGBUFBIT != 0 && i.off < len(i.tape.Tape) {
+		return int(i.tape.Tape[i.off]) == len(m.key) && int(i.cur&STRINGBUFMASK) == m.off, nil
+	}
+	name, err := i.StringBytes()
+	if err != nil {
+		return false, err
+	}
+	return string(name) == m.key, nil
+}
+
+// memHashString is memHash for strings.
+func memHashString(s string) uint64 {
+	ss := (*stringStruct)(unsafe.Pointer(&s))
+	return uint64(memhash(ss.str, 0, uintptr(ss.len)))
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"sync"
 )
 
 const JSONVALUEMASK = 0xff_ffff_ffff_ffff
@@ -41,6 +42,27 @@ const (
 	// FloatOverflowedInteger is set when number in JSON was in integer notation,
 	// but under/overflowed both int64 and uint64 and therefore was parsed as float.
 	FloatOverflowedInteger FloatFlag = 1 << iota
+
+	// FloatInexact is set when the number in JSON cannot be represented exactly as a float64.
+	// For example 0.1 or numbers with more than 17 significant digits.
+	// This and the following flags are only set when parsing with WithFloatPrecisionFlags.
+	FloatInexact
+
+	// FloatExceedsSafeInteger is set when the magnitude of the value is above 2^53-1.
+	// Above this not all integers can be represented by a float64.
+	FloatExceedsSafeInteger
+
+	// FloatUnderflowToZero is set when a non-zero number in JSON was too small
+	// to be represented and became zero.
+	// FloatInexact will also be set.
+	FloatUnderflowToZero
+
+	// FloatFromExponent is set when the number in JSON used exponent notation.
+	FloatFromExponent
+
+	// FloatIsFloat32 is set when the value was stored using SetFloat32.
+	// The value is marshaled with the shortest representation that round trips as a float32.
+	FloatIsFloat32
 )
 
 // Contains returns whether f contains the specified flag.
@@ -66,6 +88,10 @@ type ParsedJson struct {
 	Tape    []uint64
 	Strings *TStrings
 
+	// meta contains settings and indexes of the tape.
+	// It is shared by copies and iterators, and replaced when changed.
+	meta *tapeMeta
+
 	// allows to reuse the internal structures without exposing it.
 	internal *internalParsedJson
 }
@@ -90,6 +116,77 @@ type internalParsedJson struct {
 	buffersOffset         uint64
 	ndjson                uint64
 	copyStrings           bool
+	compact               bool
+	floatPrecision        bool
+
+	// Root element offsets collected by stage 2, see WithRecordIndex.
+	recordIndex bool
+	rootOffs    []int
+
+	// String interning, see WithStringInterning.
+	internMaxLen int
+	internTable  *internTable
+
+	// Buffer sizing, see WithSizeHints.
+	hintTape, hintStrings float64
+	sizes                 *sizeHints
+}
+
+const (
+	// Default tape entries and string bytes per input byte.
+	defaultTapeRatio    = 0.15
+	defaultStringsRatio = 0.10
+
+	// minSizeSample is the minimum input size used to learn ratios.
+	minSizeSample = 1 << 10
+)
+
+// sizeHints contains the observed ratio of tape entries and
+// string bytes to input size.
+// It is shared by all parsers of a reuse chain or stream.
+type sizeHints struct {
+	mu            sync.Mutex
+	tape, strings float64
+	observed      bool
+}
+
+// observe will add the sizes of a parse result.
+// Ratios grow immediately, but shrink slowly, so
+// a single smaller input doesn't cause reallocations.
+func (h *sizeHints) observe(input, tape, strings int) {
+	if input < minSizeSample {
+		return
+	}
+	t := float64(tape) / float64(input)
+	s := float64(strings) / float64(input)
+	h.mu.Lock()
+	if h.observed {
+		t = math.Max(t, h.tape*0.75+t*0.25)
+		s = math.Max(s, h.strings*0.75+s*0.25)
+	}
+	h.tape, h.strings, h.observed = t, s, true
+	h.mu.Unlock()
+}
+
+// estimateSizes returns the expected number of tape entries and
+// string bytes when parsing size bytes of input.
+func (pj *internalParsedJson) estimateSizes(size int) (tape, strings int) {
+	t, s := defaultTapeRatio, defaultStringsRatio
+	if h := pj.sizes; h != nil {
+		h.mu.Lock()
+		if h.observed {
+			// Add some headroom for variations.
+			t, s = h.tape*1.05, h.strings*1.05
+		}
+		h.mu.Unlock()
+	}
+	if pj.hintTape > 0 {
+		t = pj.hintTape
+	}
+	if pj.hintStrings > 0 {
+		s = pj.hintStrings
+	}
+	return int(float64(size) * t), int(float64(size) * s)
 }
 
 // Iter returns a new Iter.
@@ -167,6 +264,7 @@ func (pj *ParsedJson) Clone(dst *ParsedJson) *ParsedJson {
 	copy(dst.Message, pj.Message)
 	dst.Strings.B = dst.Strings.B[:len(pj.Strings.B)]
 	copy(dst.Strings.B, pj.Strings.B)
+	dst.meta = pj.meta.clone(pj, dst)
 	return dst
 }
 
@@ -395,15 +493,17 @@ writeloop:
 					return dst, errors.New("root tag, but not at top of stack, got id " + strconv.Itoa(int(l)))
 				}
 			}
-
-			if isOpenRoot {
-				// Always move into root.
-				i.addNext = 0
+			if !isOpenRoot {
+				// End of the root containing the value, as from ForEach.
+				break writeloop
 			}
+
+			// Always move into root.
+			i.addNext = 0
 			i.AdvanceInto()
 			stack = append(stack, stackRoot)
 			continue
-		case TagString:
+		case TagString, TagStringInline:
 			sb, err := i.StringBytes()
 			if err != nil {
 				return nil, err
@@ -412,7 +512,7 @@ writeloop:
 			dst = escapeBytes(dst, sb)
 			dst = append(dst, '"')
 			tmpBuf = tmpBuf[:0]
-		case TagInteger:
+		case TagInteger, TagIntegerInline:
 			v, err := i.Int()
 			if err != nil {
 				return nil, err
@@ -425,11 +525,17 @@ writeloop:
 			}
 			dst = strconv.AppendUint(dst, v, 10)
 		case TagFloat:
-			v, err := i.Float()
+			v, flags, err := i.FloatFlags()
 			if err != nil {
 				return nil, err
 			}
-			dst, err = appendFloat(dst, v)
+			if isNonFinite(v) {
+				dst, err = appendNonFinite(dst, v, i.tape.meta.nonFiniteMode())
+			} else if flags.Contains(FloatIsFloat32) {
+				dst, err = appendFloat32(dst, float32(v))
+			} else {
+				dst, err = appendFloat(dst, v)
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -515,6 +621,8 @@ func (i *Iter) Float() (float64, error) {
 		}
 		v := int64(i.tape.Tape[i.off])
 		return float64(v), nil
+	case TagIntegerInline:
+		return float64(inlineInt(i.cur)), nil
 	case TagUint:
 		if i.off >= len(i.tape.Tape) {
 			return 0, errors.New("corrupt input: expected integer, but no more values on tape")
@@ -543,6 +651,8 @@ func (i *Iter) FloatFlags() (float64, FloatFlags, error) {
 		}
 		v := int64(i.tape.Tape[i.off])
 		return float64(v), 0, nil
+	case TagIntegerInline:
+		return float64(inlineInt(i.cur)), 0, nil
 	case TagUint:
 		if i.off >= len(i.tape.Tape) {
 			return 0, 0, errors.New("corrupt input: expected integer, but no more values on tape")
@@ -556,7 +666,11 @@ func (i *Iter) FloatFlags() (float64, FloatFlags, error) {
 
 // SetFloat can change a float, int, uint or string with the specified value.
 // Attempting to change other types will return an error.
+// NaN and infinite values are rejected if NonFiniteRejectSet is set on the tape.
 func (i *Iter) SetFloat(v float64) error {
+	if i.tape.meta.nonFiniteMode()&NonFiniteRejectSet != 0 && isNonFinite(v) {
+		return fmt.Errorf("cannot set float to %v", v)
+	}
 	switch i.t {
 	case TagFloat, TagInteger, TagUint, TagString:
 		i.tape.Tape[i.off-1] = uint64(TagFloat) << JSONTAGOFFSET
@@ -590,6 +704,8 @@ func (i *Iter) Int() (int64, error) {
 		}
 		v := int64(i.tape.Tape[i.off])
 		return v, nil
+	case TagIntegerInline:
+		return inlineInt(i.cur), nil
 	case TagUint:
 		if i.off >= len(i.tape.Tape) {
 			return 0, errors.New("corrupt input: expected integer, but no more values on tape")
@@ -614,6 +730,8 @@ func (i *Iter) SetInt(v int64) error {
 		i.t = TagInteger
 		i.cur = uint64(v)
 		return nil
+	case TagIntegerInline, TagStringInline:
+		return i.setInline(inlineIntEntry(v), fitsInlineInt(v))
 	}
 	return fmt.Errorf("cannot set tag %s to int", i.t.String())
 }
@@ -643,6 +761,12 @@ func (i *Iter) Uint() (uint64, error) {
 			return 0, errors.New("integer value is negative. cannot convert to uint")
 		}
 
+		return uint64(v), nil
+	case TagIntegerInline:
+		v := inlineInt(i.cur)
+		if v < 0 {
+			return 0, errors.New("integer value is negative. cannot convert to uint")
+		}
 		return uint64(v), nil
 	case TagUint:
 		if i.off >= len(i.tape.Tape) {
@@ -665,12 +789,18 @@ func (i *Iter) SetUInt(v uint64) error {
 		i.t = TagUint
 		i.cur = v
 		return nil
+	case TagIntegerInline, TagStringInline:
+		return i.setInline(inlineIntEntry(int64(v)), v <= math.MaxInt64 && fitsInlineInt(int64(v)))
 	}
 	return fmt.Errorf("cannot set tag %s to uint", i.t.String())
 }
 
 // String() returns a string value.
 func (i *Iter) String() (string, error) {
+	if i.t == TagStringInline {
+		b, err := inlineStringBytes(i.tape.Tape, i.off-1)
+		return string(b), err
+	}
 	if i.t != TagString {
 		return "", errors.New("value is not string")
 	}
@@ -683,6 +813,9 @@ func (i *Iter) String() (string, error) {
 
 // StringBytes returns a string as byte array.
 func (i *Iter) StringBytes() ([]byte, error) {
+	if i.t == TagStringInline {
+		return inlineStringBytes(i.tape.Tape, i.off-1)
+	}
 	if i.t != TagString {
 		return nil, errors.New("value is not string")
 	}
@@ -710,17 +843,34 @@ func (i *Iter) SetStringBytes(v []byte) error {
 		i.t = TagString
 		i.tape.Strings.B = append(i.tape.Strings.B, v...)
 		return nil
+	case TagIntegerInline, TagStringInline:
+		if len(v) > maxInlineString {
+			return i.setInline(0, false)
+		}
+		return i.setInline(inlineStringEntry(v), true)
 	}
 	return fmt.Errorf("cannot set tag %s to string", i.t.String())
 }
 
+// setInline will replace the current inline value with entry.
+// If the new value doesn't fit inline an error is returned.
+func (i *Iter) setInline(entry uint64, fits bool) error {
+	if !fits {
+		return fmt.Errorf("cannot replace inline %s with value that does not fit inline", TagToType[i.t])
+	}
+	i.tape.Tape[i.off-1] = entry
+	i.t = Tag(entry >> JSONTAGOFFSET)
+	i.cur = entry & JSONVALUEMASK
+	return nil
+}
+
 // StringCvt returns a string representation of the value.
 // Root, Object and Arrays are not supported.
 func (i *Iter) StringCvt() (string, error) {
 	switch i.t {
-	case TagString:
+	case TagString, TagStringInline:
 		return i.String()
-	case TagInteger:
+	case TagInteger, TagIntegerInline:
 		v, err := i.Int()
 		return strconv.FormatInt(v, 10), err
 	case TagUint:
@@ -731,6 +881,14 @@ func (i *Iter) StringCvt() (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if mode := i.tape.meta.nonFiniteMode(); isNonFinite(v) && mode&nonFiniteOutputMask != NonFiniteError {
+			// Strings are returned unquoted.
+			if mode&nonFiniteOutputMask == NonFiniteNull {
+				return "null", nil
+			}
+			b, err := appendNonFinite(nil, v, NonFiniteLiteral)
+			return string(b), err
+		}
 		return floatToString(v)
 	case TagBoolFalse:
 		return "false", nil
@@ -761,6 +919,7 @@ func (i *Iter) Root(dst *Iter) (Type, *Iter, error) {
 		dst.t = i.t
 		dst.tape.Strings = i.tape.Strings
 		dst.tape.Message = i.tape.Message
+		dst.tape.meta = i.tape.meta
 	}
 	dst.addNext = 0
 	dst.tape.Tape = i.tape.Tape[:i.cur-1]
@@ -937,6 +1096,7 @@ func (i *Iter) Object(dst *Object) (*Object, error) {
 	dst.tape.Tape = i.tape.Tape[:end]
 	dst.tape.Strings = i.tape.Strings
 	dst.tape.Message = i.tape.Message
+	dst.tape.meta = i.tape.meta
 	dst.off = i.off
 
 	return dst, nil
@@ -958,6 +1118,7 @@ func (i *Iter) Array(dst *Array) (*Array, error) {
 	dst.tape.Tape = i.tape.Tape[:end]
 	dst.tape.Strings = i.tape.Strings
 	dst.tape.Message = i.tape.Message
+	dst.tape.meta = i.tape.meta
 	dst.off = i.off
 
 	return dst, nil
@@ -1015,6 +1176,10 @@ const (
 	TagArrayEnd    = Tag(']')
 	TagRoot        = Tag('r')
 	TagEnd         = Tag(0)
+
+	// Inline values are only used on compact tapes, see WithCompactTape.
+	TagStringInline  = Tag('s')
+	TagIntegerInline = Tag('i')
 )
 
 var tagOpenToClose = [256]Tag{
@@ -1074,16 +1239,18 @@ func (t Type) String() string {
 // For arrays and objects only the start tag will return types.
 // All non-existing tags returns TypeNone.
 var TagToType = [256]Type{
-	TagString:      TypeString,
-	TagInteger:     TypeInt,
-	TagUint:        TypeUint,
-	TagFloat:       TypeFloat,
-	TagNull:        TypeNull,
-	TagBoolTrue:    TypeBool,
-	TagBoolFalse:   TypeBool,
-	TagObjectStart: TypeObject,
-	TagArrayStart:  TypeArray,
-	TagRoot:        TypeRoot,
+	TagString:        TypeString,
+	TagStringInline:  TypeString,
+	TagInteger:       TypeInt,
+	TagIntegerInline: TypeInt,
+	TagUint:          TypeUint,
+	TagFloat:         TypeFloat,
+	TagNull:          TypeNull,
+	TagBoolTrue:      TypeBool,
+	TagBoolFalse:     TypeBool,
+	TagObjectStart:   TypeObject,
+	TagArrayStart:    TypeArray,
+	TagRoot:          TypeRoot,
 }
 
 // Type converts a tag to a type.
@@ -1173,7 +1340,7 @@ func floatToString(f float64) (string, error) {
 // appendFloat converts a float to string similar to Go stdlib and appends it to dst.
 func appendFloat(dst []byte, f float64) ([]byte, error) {
 	if math.IsInf(f, 0) || math.IsNaN(f) {
-		return nil, errors.New("INF or NaN number found")
+		return nil, errNonFinite
 	}
 
 	// Convert as if by ES6 number to string conversion.
@@ -1186,11 +1353,30 @@ func appendFloat(dst []byte, f float64) ([]byte, error) {
 		return appendFloatF(dst, f), nil
 	}
 	dst = strconv.AppendFloat(dst, f, 'e', -1, 64)
-	// clean up e-09 to e-9
+	return cleanExponent(dst), nil
+}
+
+// appendFloat32 converts a float32 to string similar to appendFloat and appends it to dst.
+// The shortest representation that round trips as a float32 is used.
+func appendFloat32(dst []byte, f float32) ([]byte, error) {
+	f64 := float64(f)
+	if math.IsInf(f64, 0) || math.IsNaN(f64) {
+		return nil, errNonFinite
+	}
+	abs := math.Abs(f64)
+	if (abs >= 1e-6 && abs < 1e21) || abs == 0 {
+		return appendFloat32F(dst, f), nil
+	}
+	dst = strconv.AppendFloat(dst, f64, 'e', -1, 32)
+	return cleanExponent(dst), nil
+}
+
+// cleanExponent will clean up e-09 to e-9 at the end of dst.
+func cleanExponent(dst []byte) []byte {
 	n := len(dst)
 	if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
 		dst[n-2] = dst[n-1]
 		dst = dst[:n-1]
 	}
-	return dst, nil
+	return dst
 }
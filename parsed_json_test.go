@@ -187,6 +187,29 @@ func TestPrintJson(t *testing.T) {
 	}
 }
 
+func TestPrintJson_ForEach(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = "{\"a\":[1,{}]}\n[\"b\"]\n{}\n"
+	pj, err := ParseND([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	err = pj.ForEach(func(i Iter) error {
+		got, err = i.MarshalJSONBuffer(got)
+		got = append(got, '\n')
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input {
+		t.Errorf("got: %q want: %q", got, input)
+	}
+}
+
 func TestExchange(t *testing.T) {
 	if !SupportedCPU() {
 		t.SkipNow()
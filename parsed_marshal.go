@@ -0,0 +1,156 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// Ensure that ParsedJson can be used as a field type,
+// similar to json.RawMessage.
+var (
+	_ json.Marshaler             = ParsedJson{}
+	_ json.Unmarshaler           = &ParsedJson{}
+	_ encoding.BinaryMarshaler   = ParsedJson{}
+	_ encoding.BinaryUnmarshaler = &ParsedJson{}
+	_ gob.GobEncoder             = ParsedJson{}
+	_ gob.GobDecoder             = &ParsedJson{}
+)
+
+// serializerPool contains serializers used for binary marshaling.
+var serializerPool = sync.Pool{New: func() interface{} {
+	return NewSerializer()
+}}
+
+// MarshalJSON returns the JSON of the parsed content.
+// An empty ParsedJson is returned as null.
+// Tapes with more than one root element, like NDJSON, cannot be marshaled.
+func (pj ParsedJson) MarshalJSON() ([]byte, error) {
+	if len(pj.Tape) == 0 {
+		return []byte("null"), nil
+	}
+	if Tag(pj.Tape[0]>>JSONTAGOFFSET) == TagRoot && int(pj.Tape[0]&JSONVALUEMASK) < len(pj.Tape) {
+		return nil, errors.New("cannot marshal multiple root elements to json")
+	}
+	iter := pj.Iter()
+	return iter.MarshalJSON()
+}
+
+// UnmarshalJSON parses data and replaces the content of pj.
+// The data is copied, and new buffers are always allocated,
+// so copies of the previous value are unaffected.
+// Like other unmarshalers, null is a no-op.
+// Top level scalars like numbers, strings and booleans are supported.
+func (pj *ParsedJson) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	if len(trimmed) > 0 && trimmed[0] != '{' && trimmed[0] != '[' {
+		return pj.unmarshalScalar(trimmed)
+	}
+	parsed, err := Parse(append([]byte(nil), data...), nil)
+	if err != nil {
+		return err
+	}
+	pj.replace(parsed)
+	return nil
+}
+
+// unmarshalScalar parses a single scalar value and replaces the content of pj.
+// The parser only accepts objects and arrays at the top level,
+// so the value is parsed inside an array and copied to a new tape.
+func (pj *ParsedJson) unmarshalScalar(data []byte) error {
+	wrapped := make([]byte, 0, len(data)+2)
+	wrapped = append(append(append(wrapped, '['), data...), ']')
+	parsed, err := Parse(wrapped, nil)
+	if err != nil {
+		return err
+	}
+	i := parsed.Iter()
+	i.Advance()
+	_, root, err := i.Root(nil)
+	if err != nil {
+		return err
+	}
+	arr, err := root.Array(nil)
+	if err != nil {
+		return err
+	}
+	elems := arr.Iter()
+	if elems.Advance() == TypeNone {
+		return errors.New("no value found")
+	}
+	var b Builder
+	b.Copy(elems)
+	if elems.Advance() != TypeNone {
+		return errors.New("more than one value found")
+	}
+	parsed, err = b.Finish()
+	if err != nil {
+		return err
+	}
+	pj.replace(parsed)
+	return nil
+}
+
+// MarshalBinary serializes the content using a Serializer with default compression.
+func (pj ParsedJson) MarshalBinary() ([]byte, error) {
+	s := serializerPool.Get().(*Serializer)
+	defer serializerPool.Put(s)
+	return s.Serialize(nil, pj), nil
+}
+
+// UnmarshalBinary deserializes data created by MarshalBinary or a Serializer
+// and replaces the content of pj.
+// New buffers are always allocated, so copies of the previous value are unaffected.
+func (pj *ParsedJson) UnmarshalBinary(data []byte) error {
+	s := serializerPool.Get().(*Serializer)
+	defer serializerPool.Put(s)
+	parsed, err := s.Deserialize(data, nil)
+	if err != nil {
+		return err
+	}
+	pj.replace(parsed)
+	return nil
+}
+
+// GobEncode serializes the content using MarshalBinary.
+func (pj ParsedJson) GobEncode() ([]byte, error) {
+	return pj.MarshalBinary()
+}
+
+// GobDecode deserializes the content using UnmarshalBinary.
+func (pj *ParsedJson) GobDecode(data []byte) error {
+	return pj.UnmarshalBinary(data)
+}
+
+// replace the content of pj with parsed.
+// The internal parser state is dropped, since it would be shared
+// between all copies of pj, and reusing it would overwrite their content.
+func (pj *ParsedJson) replace(parsed *ParsedJson) {
+	*pj = ParsedJson{
+		Message: parsed.Message,
+		Tape:    parsed.Tape,
+		Strings: parsed.Strings,
+	}
+}
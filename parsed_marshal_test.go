@@ -0,0 +1,182 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"testing"
+)
+
+type marshalTest struct {
+	Name string
+	Data ParsedJson
+	Ptr  *ParsedJson `json:",omitempty"`
+}
+
+func TestParsedJson_MarshalJSON(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = `{"Name":"a","Data":{"x":[1,2.5,"s"],"y":{"z":null}},"Ptr":[true]}`
+	var v marshalTest
+	if err := json.Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	var e Element
+	iter := v.Data.Iter()
+	if _, err := iter.FindElement(&e, "y", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != TypeNull {
+		t.Errorf("want null, got %v", e.Type)
+	}
+	got, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != input {
+		t.Errorf("got %s, want %s", got, input)
+	}
+
+	// Zero value
+	got, err = json.Marshal(marshalTest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Name":"","Data":null}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// Copies must not be affected by unmarshaling again.
+	cp := v.Data
+	if err := json.Unmarshal([]byte(`{"Data":{"other":"value that is longer"}}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	got, err = cp.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"x":[1,2.5,"s"],"y":{"z":null}}`; string(got) != want {
+		t.Errorf("copy changed: got %s, want %s", got, want)
+	}
+
+	// NDJSON cannot be marshaled.
+	pj, err := ParseND([]byte("{}\n{}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pj.MarshalJSON(); err == nil {
+		t.Error("expected error marshaling multiple roots")
+	}
+}
+
+func TestParsedJson_UnmarshalJSONScalar(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	for _, input := range []string{`1`, `-2.5`, `18446744073709551615`, `"s"`, `"esc\"aped \u0041"`, `true`, `false`} {
+		var v marshalTest
+		if err := json.Unmarshal([]byte(`{"Name":"n","Data":`+input+`}`), &v); err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		got, err := v.Data.MarshalJSON()
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		want := input
+		if input == `"esc\"aped \u0041"` {
+			want = `"esc\"aped A"`
+		}
+		if string(got) != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	// null is a no-op.
+	var pj ParsedJson
+	if err := pj.UnmarshalJSON([]byte(` 1 `)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pj.UnmarshalJSON([]byte(`null`)); err != nil {
+		t.Fatal(err)
+	}
+	iter := pj.Iter()
+	iter.Advance()
+	if _, root, err := iter.Root(nil); err != nil || root.Type() != TypeInt {
+		t.Errorf("want int root, got %v (%v)", root, err)
+	}
+
+	for _, input := range []string{`1,2`, `"unterminated`, `tru`, `1]`, `1],[2`} {
+		if err := pj.UnmarshalJSON([]byte(input)); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestParsedJson_MarshalBinary(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"a":"b","c":[1,-2,3.5,true,false,null,{"d":"e"}]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := pj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := pj.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dst ParsedJson
+	if err := dst.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dst.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("binary: got %s, want %s", got, want)
+	}
+
+	// Gob, as field and pointer
+	var buf bytes.Buffer
+	in := marshalTest{Name: "gob", Data: *pj, Ptr: pj}
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	var out marshalTest
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, dec := range []*ParsedJson{&out.Data, out.Ptr} {
+		got, err := dec.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("gob: got %s, want %s", got, want)
+		}
+	}
+}
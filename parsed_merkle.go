@@ -0,0 +1,503 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math/bits"
+	"sort"
+)
+
+// MerkleHash is the content hash of a value.
+type MerkleHash [16]byte
+
+// MerkleTree contains the content hash of every root element, object and array
+// of a ParsedJson, keyed by tape offset.
+// The hash of a container is computed from its values and the hashes of
+// the containers within it, so equal content has equal hashes, also across documents.
+// Numbers are hashed by their tape representation, so 1 and 1.0 are different.
+// The tree is only valid as long as the ParsedJson is not modified.
+type MerkleTree struct {
+	pj          *ParsedJson
+	ignoreOrder bool
+
+	// offs contains the tape offsets of all opening root, object and array tags
+	// in ascending order. hashes contains the hash of each.
+	offs   []int
+	hashes []MerkleHash
+
+	// roots contains the indexes in offs of the root elements.
+	roots []int
+}
+
+// MerkleOption is an option for ComputeMerkle.
+type MerkleOption func(m *MerkleTree)
+
+// MerkleIgnoreKeyOrder will make object hashes independent of the order of keys.
+func MerkleIgnoreKeyOrder() MerkleOption {
+	return func(m *MerkleTree) {
+		m.ignoreOrder = true
+	}
+}
+
+// ComputeMerkle computes the Merkle tree of pj.
+// The tape is traversed once and every value is hashed once.
+func ComputeMerkle(pj *ParsedJson, opts ...MerkleOption) (*MerkleTree, error) {
+	m := &MerkleTree{pj: pj}
+	for _, opt := range opts {
+		opt(m)
+	}
+	b := merkleBuilder{m: m}
+	tape := pj.Tape
+	for off := 0; off < len(tape); {
+		v := tape[off]
+		tag := Tag(v >> JSONTAGOFFSET)
+		payload := v & JSONVALUEMASK
+		var err error
+		switch tag {
+		case TagRoot:
+			if int(payload) > off {
+				err = b.open(tag, off)
+			} else {
+				err = b.close(tag)
+			}
+			off++
+		case TagObjectStart, TagArrayStart:
+			err = b.open(tag, off)
+			off++
+		case TagObjectEnd, TagArrayEnd:
+			err = b.close(tag)
+			off++
+		case TagString, TagStringInline, TagInteger, TagIntegerInline, TagUint, TagFloat:
+			var n [8]byte
+			var s []byte
+			tag, s, err = merkleScalar(pj, off, &n)
+			if err == nil {
+				err = b.value(tag, s)
+			}
+			off = tapeNext(tape, off)
+		case TagNull, TagBoolTrue, TagBoolFalse:
+			err = b.value(tag, nil)
+			off++
+		case TagEnd:
+			off++
+		default:
+			err = fmt.Errorf("unknown tag %v", tag)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", off, err)
+		}
+	}
+	if len(b.stack) > 0 {
+		return nil, errors.New("corrupt input: unterminated element")
+	}
+	return m, nil
+}
+
+// Hash returns the hash of the root, object or array with the opening tag at tape offset off.
+func (m *MerkleTree) Hash(off int) (MerkleHash, bool) {
+	idx := sort.SearchInts(m.offs, off)
+	if idx == len(m.offs) || m.offs[idx] != off {
+		return MerkleHash{}, false
+	}
+	return m.hashes[idx], true
+}
+
+// HashOf returns the hash of the object or array the iterator points to.
+// The iterator must be from the ParsedJson the tree was computed from.
+func (m *MerkleTree) HashOf(i Iter) (MerkleHash, bool) {
+	switch i.t {
+	case TagRoot, TagObjectStart, TagArrayStart:
+		return m.Hash(i.off - 1)
+	}
+	return MerkleHash{}, false
+}
+
+// Roots returns the hashes of all root elements.
+func (m *MerkleTree) Roots() []MerkleHash {
+	res := make([]MerkleHash, len(m.roots))
+	for i, idx := range m.roots {
+		res[i] = m.hashes[idx]
+	}
+	return res
+}
+
+// merkleFrame is a container being hashed.
+type merkleFrame struct {
+	tag     Tag
+	idx     int
+	wantKey bool
+
+	h hash.Hash
+
+	// When ignoring key order, each object member is hashed separately
+	// and the member hashes are summed.
+	member hash.Hash
+	sum    [2]uint64
+	n      uint64
+}
+
+type merkleBuilder struct {
+	m     *MerkleTree
+	stack []merkleFrame
+	hdr   [9]byte
+	sum   []byte
+}
+
+// open starts a new container.
+func (b *merkleBuilder) open(tag Tag, off int) error {
+	if (tag == TagRoot) != (len(b.stack) == 0) {
+		return errors.New("unexpected root tag")
+	}
+	idx := len(b.m.offs)
+	b.m.offs = append(b.m.offs, off)
+	b.m.hashes = append(b.m.hashes, MerkleHash{})
+	if tag == TagRoot {
+		b.m.roots = append(b.m.roots, idx)
+	}
+
+	// Frames are reused, including their hashers.
+	if len(b.stack) < cap(b.stack) {
+		b.stack = b.stack[:len(b.stack)+1]
+	} else {
+		b.stack = append(b.stack, merkleFrame{})
+	}
+	f := &b.stack[len(b.stack)-1]
+	if f.h == nil {
+		f.h, f.member = sha256.New(), sha256.New()
+	}
+	f.tag, f.idx, f.wantKey = tag, idx, tag == TagObjectStart
+	f.sum, f.n = [2]uint64{}, 0
+	f.h.Reset()
+	b.hdr[0] = byte(tag)
+	f.h.Write(b.hdr[:1])
+	return nil
+}
+
+// close finishes the current container and adds its hash to the parent.
+func (b *merkleBuilder) close(tag Tag) error {
+	if len(b.stack) == 0 || tagOpenToClose[b.stack[len(b.stack)-1].tag] != tag {
+		return fmt.Errorf("unexpected %v", tag)
+	}
+	f := &b.stack[len(b.stack)-1]
+	if f.tag == TagObjectStart && !f.wantKey {
+		return errors.New("object key without value")
+	}
+	if f.tag == TagObjectStart && b.m.ignoreOrder {
+		var tmp [24]byte
+		binary.LittleEndian.PutUint64(tmp[0:], f.sum[0])
+		binary.LittleEndian.PutUint64(tmp[8:], f.sum[1])
+		binary.LittleEndian.PutUint64(tmp[16:], f.n)
+		f.h.Write(tmp[:])
+	}
+	b.sum = f.h.Sum(b.sum[:0])
+	h := &b.m.hashes[f.idx]
+	copy(h[:], b.sum)
+	t := f.tag
+	b.stack = b.stack[:len(b.stack)-1]
+	if len(b.stack) == 0 {
+		return nil
+	}
+	return b.value(t, h[:])
+}
+
+// value adds a scalar, key or the hash of a container to the current container.
+func (b *merkleBuilder) value(tag Tag, v []byte) error {
+	if len(b.stack) == 0 {
+		return errors.New("value outside root")
+	}
+	f := &b.stack[len(b.stack)-1]
+	if f.wantKey && tag != TagString {
+		return fmt.Errorf("expected object key, got %v", tag)
+	}
+	b.hdr[0] = byte(tag)
+	binary.LittleEndian.PutUint64(b.hdr[1:], uint64(len(v)))
+	if f.tag != TagObjectStart || !b.m.ignoreOrder {
+		f.h.Write(b.hdr[:])
+		f.h.Write(v)
+		if f.tag == TagObjectStart {
+			f.wantKey = !f.wantKey
+		}
+		return nil
+	}
+
+	if f.wantKey {
+		f.member.Reset()
+	}
+	f.member.Write(b.hdr[:])
+	f.member.Write(v)
+	if !f.wantKey {
+		b.sum = f.member.Sum(b.sum[:0])
+		var carry uint64
+		f.sum[0], carry = bits.Add64(f.sum[0], binary.LittleEndian.Uint64(b.sum[0:]), 0)
+		f.sum[1], _ = bits.Add64(f.sum[1], binary.LittleEndian.Uint64(b.sum[8:]), carry)
+		f.n++
+	}
+	f.wantKey = !f.wantKey
+	return nil
+}
+
+// MerkleOp is the kind of a difference found by MerkleTree.Diff.
+type MerkleOp uint8
+
+const (
+	// MerkleModified is a value that has changed.
+	MerkleModified MerkleOp = iota
+
+	// MerkleAdded is a value that has been added.
+	MerkleAdded
+
+	// MerkleRemoved is a value that has been removed.
+	MerkleRemoved
+)
+
+// String returns the operation name.
+func (o MerkleOp) String() string {
+	switch o {
+	case MerkleModified:
+		return "modified"
+	case MerkleAdded:
+		return "added"
+	case MerkleRemoved:
+		return "removed"
+	}
+	return "(invalid)"
+}
+
+// MerkleChange is a difference between two documents.
+type MerkleChange struct {
+	// Root is the index of the root element.
+	Root int
+
+	// Path is the location of the value within the root element.
+	Path Path
+
+	Op MerkleOp
+}
+
+// String returns the change in the form "op root:path".
+func (c MerkleChange) String() string {
+	return fmt.Sprintf("%v %d:%v", c.Op, c.Root, c.Path)
+}
+
+// Diff returns the differences from m to other.
+// Root elements are compared by index.
+// Objects and arrays with equal hashes are skipped, so the cost is proportional
+// to the size of the changed objects and arrays rather than the documents.
+// Values only in other are reported as added and values only in m as removed.
+// Array elements are compared by index.
+// If an object only differs by the order of its keys, the object itself is reported as modified.
+// Both trees must be computed with the same options.
+func (m *MerkleTree) Diff(other *MerkleTree) ([]MerkleChange, error) {
+	if m.ignoreOrder != other.ignoreOrder {
+		return nil, errors.New("merkle trees computed with different options")
+	}
+	d := merkleDiff{a: m, b: other}
+	for i := 0; i < len(m.roots) || i < len(other.roots); i++ {
+		d.root = i
+		switch {
+		case i >= len(other.roots):
+			d.add(nil, MerkleRemoved)
+		case i >= len(m.roots):
+			d.add(nil, MerkleAdded)
+		case m.hashes[m.roots[i]] != other.hashes[other.roots[i]]:
+			// Compare the values inside the roots.
+			if err := d.value(m.offs[m.roots[i]]+1, other.offs[other.roots[i]]+1, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d.changes, nil
+}
+
+type merkleDiff struct {
+	a, b    *MerkleTree
+	root    int
+	changes []MerkleChange
+}
+
+func (d *merkleDiff) add(p Path, op MerkleOp) {
+	d.changes = append(d.changes, MerkleChange{Root: d.root, Path: append(Path(nil), p...), Op: op})
+}
+
+// value compares the value at offset a in the first tree to the value at offset b in the second.
+func (d *merkleDiff) value(a, b int, p Path) error {
+	ta, tb := d.a.pj.Tape, d.b.pj.Tape
+	if a >= len(ta) || b >= len(tb) {
+		return errors.New("corrupt input: value beyond tape")
+	}
+	tag := merkleTag[Tag(ta[a]>>JSONTAGOFFSET)]
+	if tag != merkleTag[Tag(tb[b]>>JSONTAGOFFSET)] {
+		d.add(p, MerkleModified)
+		return nil
+	}
+	switch tag {
+	case TagObjectStart, TagArrayStart:
+		ha, _ := d.a.Hash(a)
+		hb, _ := d.b.Hash(b)
+		if ha == hb {
+			return nil
+		}
+		n := len(d.changes)
+		var err error
+		if tag == TagArrayStart {
+			err = d.array(a, b, p)
+		} else {
+			err = d.object(a, b, p)
+		}
+		if err == nil && len(d.changes) == n {
+			// Only key order differs.
+			d.add(p, MerkleModified)
+		}
+		return err
+	case TagString, TagInteger, TagUint, TagFloat:
+		var na, nb [8]byte
+		_, va, err := merkleScalar(d.a.pj, a, &na)
+		if err != nil {
+			return err
+		}
+		_, vb, err := merkleScalar(d.b.pj, b, &nb)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(va, vb) {
+			d.add(p, MerkleModified)
+		}
+	}
+	return nil
+}
+
+func (d *merkleDiff) array(a, b int, p Path) error {
+	ta, tb := d.a.pj.Tape, d.b.pj.Tape
+	a, b = a+1, b+1
+	for i := 0; ; i++ {
+		endA := Tag(ta[a]>>JSONTAGOFFSET) == TagArrayEnd
+		endB := Tag(tb[b]>>JSONTAGOFFSET) == TagArrayEnd
+		if endA && endB {
+			return nil
+		}
+		ep := append(p, PathIndex(i))
+		switch {
+		case endA:
+			d.add(ep, MerkleAdded)
+		case endB:
+			d.add(ep, MerkleRemoved)
+		default:
+			if err := d.value(a, b, ep); err != nil {
+				return err
+			}
+		}
+		if !endA {
+			a = tapeNext(ta, a)
+		}
+		if !endB {
+			b = tapeNext(tb, b)
+		}
+	}
+}
+
+func (d *merkleDiff) object(a, b int, p Path) error {
+	ta, tb := d.a.pj.Tape, d.b.pj.Tape
+
+	// Index the keys of the second object.
+	keys := make(map[string]int)
+	for off := b + 1; Tag(tb[off]>>JSONTAGOFFSET) != TagObjectEnd; off = tapeNext(tb, tapeNext(tb, off)) {
+		k, err := d.b.pj.tapeStringBytes(off)
+		if err != nil {
+			return err
+		}
+		keys[string(k)] = tapeNext(tb, off)
+	}
+	for off := a + 1; Tag(ta[off]>>JSONTAGOFFSET) != TagObjectEnd; off = tapeNext(ta, tapeNext(ta, off)) {
+		k, err := d.a.pj.tapeStringBytes(off)
+		if err != nil {
+			return err
+		}
+		ep := append(p, PathKey(string(k)))
+		vb, ok := keys[string(k)]
+		if !ok {
+			d.add(ep, MerkleRemoved)
+			continue
+		}
+		delete(keys, string(k))
+		if err := d.value(tapeNext(ta, off), vb, ep); err != nil {
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	// Report added keys in order.
+	for off := b + 1; Tag(tb[off]>>JSONTAGOFFSET) != TagObjectEnd; off = tapeNext(tb, tapeNext(tb, off)) {
+		k, _ := d.b.pj.tapeStringBytes(off)
+		if _, ok := keys[string(k)]; ok {
+			d.add(append(p, PathKey(string(k))), MerkleAdded)
+		}
+	}
+	return nil
+}
+
+// merkleTag converts inline tags to the regular tags,
+// so compact and regular tapes have the same hashes.
+var merkleTag = func() (t [256]Tag) {
+	for i := range t {
+		t[i] = Tag(i)
+	}
+	t[TagStringInline] = TagString
+	t[TagIntegerInline] = TagInteger
+	return t
+}()
+
+// merkleScalar returns the tag and the bytes to hash of the string or number at off.
+// Inline values are returned with the regular tag.
+// Numbers are stored in n.
+func merkleScalar(pj *ParsedJson, off int, n *[8]byte) (Tag, []byte, error) {
+	tape := pj.Tape
+	tag := Tag(tape[off] >> JSONTAGOFFSET)
+	switch tag {
+	case TagString, TagStringInline:
+		s, err := pj.tapeStringBytes(off)
+		return TagString, s, err
+	case TagIntegerInline:
+		binary.LittleEndian.PutUint64(n[:], uint64(inlineInt(tape[off]&JSONVALUEMASK)))
+		return TagInteger, n[:], nil
+	case TagInteger, TagUint, TagFloat:
+		if off+1 >= len(tape) {
+			return tag, nil, errors.New("corrupt input: number beyond tape")
+		}
+		binary.LittleEndian.PutUint64(n[:], tape[off+1])
+		return tag, n[:], nil
+	}
+	return tag, nil, nil
+}
+
+// tapeNext returns the offset of the value after the value at off.
+func tapeNext(tape []uint64, off int) int {
+	v := tape[off]
+	switch Tag(v >> JSONTAGOFFSET) {
+	case TagObjectStart, TagArrayStart, TagRoot:
+		return int(v & JSONVALUEMASK)
+	case TagString, TagInteger, TagUint, TagFloat:
+		return off + 2
+	}
+	return off + 1
+}
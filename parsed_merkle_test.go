@@ -0,0 +1,151 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func merkleOf(t *testing.T, input string, opts ...MerkleOption) *MerkleTree {
+	t.Helper()
+	pj, err := ParseND([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ComputeMerkle(pj, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestComputeMerkle(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const doc = `{"a":{"x":1,"y":[1,2]},"b":"s"}`
+	a := merkleOf(t, doc)
+	b := merkleOf(t, `{"b":"s","a":{"y":[1,2],"x":1}}`)
+	c := merkleOf(t, `{"a":{"x":1,"y":[1,2]},"b":"t"}`)
+	if a.Roots()[0] != merkleOf(t, doc).Roots()[0] {
+		t.Error("hash is not stable")
+	}
+	if a.Roots()[0] == b.Roots()[0] {
+		t.Error("key order should change hash")
+	}
+	if a.Roots()[0] == c.Roots()[0] {
+		t.Error("value should change hash")
+	}
+
+	// Unchanged subtrees have equal hashes.
+	var ea, ec Element
+	ia, ic := a.pj.Iter(), c.pj.Iter()
+	if _, err := ia.FindElement(&ea, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ic.FindElement(&ec, "a"); err != nil {
+		t.Fatal(err)
+	}
+	ha, ok := a.HashOf(ea.Iter)
+	hc, ok2 := c.HashOf(ec.Iter)
+	if !ok || !ok2 || ha != hc {
+		t.Errorf("subtree hashes differ: %x %x (%v %v)", ha, hc, ok, ok2)
+	}
+
+	// Ignoring key order.
+	au := merkleOf(t, doc, MerkleIgnoreKeyOrder())
+	bu := merkleOf(t, `{"b":"s","a":{"y":[1,2],"x":1}}`, MerkleIgnoreKeyOrder())
+	if au.Roots()[0] != bu.Roots()[0] {
+		t.Error("key order should not change hash")
+	}
+	if au.Roots()[0] == merkleOf(t, `{"b":"s","a":{"y":[2,1],"x":1}}`, MerkleIgnoreKeyOrder()).Roots()[0] {
+		t.Error("array order should change hash")
+	}
+	if au.Roots()[0] == merkleOf(t, `{"b":"s","a":{"y":[1,2],"x":1},"c":null}`, MerkleIgnoreKeyOrder()).Roots()[0] {
+		t.Error("added key should change hash")
+	}
+	if merkleOf(t, `{"a":"b"}`).Roots()[0] == merkleOf(t, `{"ab":""}`).Roots()[0] {
+		t.Error("strings should be length prefixed")
+	}
+}
+
+func TestMerkleTree_Diff(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const doc = "{\"a\":{\"x\":1,\"y\":[1,2,3]},\"b\":\"s\",\"c\":[{\"d\":true}]}\n{\"z\":0}\n"
+	tests := []struct {
+		name  string
+		other string
+		want  []string
+		opts  []MerkleOption
+	}{
+		{name: "equal", other: doc},
+		{
+			name:  "scalar",
+			other: "{\"a\":{\"x\":1,\"y\":[1,2,3]},\"b\":\"t\",\"c\":[{\"d\":true}]}\n{\"z\":0}\n",
+			want:  []string{"modified 0:b"},
+		},
+		{
+			name:  "nested",
+			other: "{\"a\":{\"x\":1.0,\"y\":[1,5]},\"b\":\"s\",\"c\":[{\"d\":false,\"e\":1}]}\n{\"z\":0}\n",
+			want:  []string{"modified 0:a.x", "modified 0:a.y[1]", "removed 0:a.y[2]", "modified 0:c[0].d", "added 0:c[0].e"},
+		},
+		{
+			name:  "keys",
+			other: "{\"a\":{\"x\":1,\"y\":[1,2,3]},\"n\":1,\"c\":[{\"d\":true}]}\n{\"z\":0}\n{}\n",
+			want:  []string{"removed 0:b", "added 0:n", "added 2:"},
+		},
+		{
+			name:  "order",
+			other: "{\"a\":{\"y\":[1,2,3],\"x\":1},\"b\":\"s\",\"c\":[{\"d\":true}]}\n{\"z\":0}\n",
+			want:  []string{"modified 0:a"},
+		},
+		{
+			name:  "order-ignored",
+			other: "{\"a\":{\"y\":[1,2,3],\"x\":1},\"b\":\"s\",\"c\":[{\"d\":true}]}\n{\"z\":0}\n",
+			opts:  []MerkleOption{MerkleIgnoreKeyOrder()},
+		},
+		{
+			name:  "type",
+			other: "{\"a\":[],\"b\":\"s\",\"c\":[{\"d\":true}]}\n",
+			want:  []string{"modified 0:a", "removed 1:"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := merkleOf(t, doc, test.opts...)
+			b := merkleOf(t, test.other, test.opts...)
+			changes, err := a.Diff(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err := merkleOf(t, doc).Diff(merkleOf(t, doc, MerkleIgnoreKeyOrder())); err == nil {
+		t.Error("expected error for different options")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+// tapeMeta contains settings and indexes that are not stored on the tape.
+// ParsedJson keeps a pointer, so copying iterators stays cheap.
+// A tapeMeta is never modified once it has been set on a ParsedJson,
+// changes are made to a copy, which replaces it.
+// That way copies of the ParsedJson and existing iterators are unaffected,
+// and it can be read concurrently.
+type tapeMeta struct {
+	// nonFinite controls handling of NaN and infinite floats, see SetNonFinite.
+	nonFinite NonFinite
+
+	// records is the index of root elements, see RecordCount.
+	records recordIndex
+
+	// interned is the table of interned strings, see WithStringInterning.
+	interned internIndex
+}
+
+// nonFiniteMode returns the NonFinite setting. m may be nil.
+func (m *tapeMeta) nonFiniteMode() NonFinite {
+	if m == nil {
+		return NonFiniteError
+	}
+	return m.nonFinite
+}
+
+// recordOffsets returns the offsets of the root elements if an index for tape exists.
+// m may be nil.
+func (m *tapeMeta) recordOffsets(tape []uint64) ([]int, bool) {
+	if m == nil || !m.records.valid(tape) {
+		return nil, false
+	}
+	return m.records.offs, true
+}
+
+// internIndex returns the intern table if it has been built for strs.
+// m may be nil.
+func (m *tapeMeta) internIndex(strs *TStrings) *internIndex {
+	if m == nil || !m.interned.valid(strs) {
+		return nil
+	}
+	return &m.interned
+}
+
+// clone returns a copy of m for dst, a copy of src.
+// m may be nil.
+func (m *tapeMeta) clone(src, dst *ParsedJson) *tapeMeta {
+	if m == nil {
+		return nil
+	}
+	c := &tapeMeta{nonFinite: m.nonFinite}
+	if m.records.valid(src.Tape) {
+		c.records = newRecordIndex(append([]int(nil), m.records.offs...), dst.Tape)
+	}
+	if m.interned.valid(src.Strings) {
+		// The table is not modified, so it can be shared.
+		c.interned = newInternIndex(m.interned.table, dst.Strings)
+	}
+	return c
+}
+
+// updateMeta replaces the meta of pj with a copy modified by fn.
+func (pj *ParsedJson) updateMeta(fn func(m *tapeMeta)) {
+	var m tapeMeta
+	if pj.meta != nil {
+		m = *pj.meta
+	}
+	fn(&m)
+	pj.meta = &m
+}
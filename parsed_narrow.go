@@ -0,0 +1,178 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float32 returns the float32 value of the next element.
+// Integers are converted if they can be represented exactly as a float32.
+// Floats are rounded to the nearest float32,
+// but values outside the float32 range and non-zero values
+// that would become zero return an error.
+func (i *Iter) Float32() (float32, error) {
+	switch i.t {
+	case TagInteger, TagIntegerInline:
+		v, err := i.Int()
+		if err != nil {
+			return 0, err
+		}
+		f := float32(v)
+		if float64(f) >= math.MaxInt64 || int64(f) != v {
+			return 0, fmt.Errorf("integer value %d cannot be represented exactly as float32", v)
+		}
+		return f, nil
+	case TagUint:
+		v, err := i.Uint()
+		if err != nil {
+			return 0, err
+		}
+		f := float32(v)
+		if float64(f) >= math.MaxUint64 || uint64(f) != v {
+			return 0, fmt.Errorf("unsigned integer value %d cannot be represented exactly as float32", v)
+		}
+		return f, nil
+	}
+	v, err := i.Float()
+	if err != nil {
+		return 0, err
+	}
+	return toFloat32(v)
+}
+
+// toFloat32 converts v to float32 and checks the range.
+func toFloat32(v float64) (float32, error) {
+	f := float32(v)
+	if math.IsInf(float64(f), 0) && !math.IsInf(v, 0) {
+		return 0, fmt.Errorf("float value %g overflows float32", v)
+	}
+	if f == 0 && v != 0 {
+		return 0, fmt.Errorf("float value %g underflows float32", v)
+	}
+	return f, nil
+}
+
+// SetFloat32 can change a float, int, uint or string with the specified value.
+// The value is stored as a float64 with the FloatIsFloat32 flag,
+// so it is marshaled with the shortest representation that round trips as a float32.
+// Attempting to change other types will return an error.
+func (i *Iter) SetFloat32(v float32) error {
+	if err := i.SetFloat(float64(v)); err != nil {
+		return err
+	}
+	i.tape.Tape[i.off-1] |= uint64(FloatIsFloat32)
+	i.cur = uint64(FloatIsFloat32)
+	return nil
+}
+
+// Int32 returns the integer value of the next element as an int32.
+// Values are converted as by Int, but values outside the int32 range return an error.
+func (i *Iter) Int32() (int32, error) {
+	v, err := i.intN(32)
+	return int32(v), err
+}
+
+// Int16 returns the integer value of the next element as an int16.
+// Values are converted as by Int, but values outside the int16 range return an error.
+func (i *Iter) Int16() (int16, error) {
+	v, err := i.intN(16)
+	return int16(v), err
+}
+
+// Int8 returns the integer value of the next element as an int8.
+// Values are converted as by Int, but values outside the int8 range return an error.
+func (i *Iter) Int8() (int8, error) {
+	v, err := i.intN(8)
+	return int8(v), err
+}
+
+// Uint32 returns the unsigned integer value of the next element as an uint32.
+// Values are converted as by Uint, but values outside the uint32 range return an error.
+func (i *Iter) Uint32() (uint32, error) {
+	v, err := i.uintN(32)
+	return uint32(v), err
+}
+
+// Uint16 returns the unsigned integer value of the next element as an uint16.
+// Values are converted as by Uint, but values outside the uint16 range return an error.
+func (i *Iter) Uint16() (uint16, error) {
+	v, err := i.uintN(16)
+	return uint16(v), err
+}
+
+// Uint8 returns the unsigned integer value of the next element as an uint8.
+// Values are converted as by Uint, but values outside the uint8 range return an error.
+func (i *Iter) Uint8() (uint8, error) {
+	v, err := i.uintN(8)
+	return uint8(v), err
+}
+
+// intN returns the integer value of the next element if it fits in a signed integer with the specified bits.
+func (i *Iter) intN(bits uint) (int64, error) {
+	v, err := i.Int()
+	if err != nil {
+		return 0, err
+	}
+	if min, max := int64(-1)<<(bits-1), int64(1)<<(bits-1)-1; v < min || v > max {
+		return 0, fmt.Errorf("value %d overflows int%d", v, bits)
+	}
+	return v, nil
+}
+
+// uintN returns the unsigned integer value of the next element if it fits in an unsigned integer with the specified bits.
+func (i *Iter) uintN(bits uint) (uint64, error) {
+	v, err := i.Uint()
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(1)<<bits-1 {
+		return 0, fmt.Errorf("value %d overflows uint%d", v, bits)
+	}
+	return v, nil
+}
+
+// AsFloat32 returns the array values as float32, appended to dst.
+// Values are converted as by Iter.Float32.
+// Supply dst[:0] of a previous call to reuse the buffer.
+func (a *Array) AsFloat32(dst []float32) ([]float32, error) {
+	i := a.Iter()
+	for n := 0; i.Advance() != TypeNone; n++ {
+		v, err := i.Float32()
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", n, err)
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
+
+// AsInt32 returns the array values as int32, appended to dst.
+// Values are converted as by Iter.Int32.
+// Supply dst[:0] of a previous call to reuse the buffer.
+func (a *Array) AsInt32(dst []int32) ([]int32, error) {
+	i := a.Iter()
+	for n := 0; i.Advance() != TypeNone; n++ {
+		v, err := i.Int32()
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", n, err)
+		}
+		dst = append(dst, v)
+	}
+	return dst, nil
+}
@@ -0,0 +1,251 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestIter_Narrow(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = `[0.5, 1e39, 1e-50, 16777217, 16777216, 18446744073709551615, -129, 127, 65535, 70000, -1, 3.5]`
+	pj, err := Parse([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := pj.Iter()
+	i.Advance()
+	_, root, err := i.Root(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err := root.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vals []Iter
+	arr.ForEach(func(i Iter) {
+		vals = append(vals, i)
+	})
+
+	type result struct {
+		v  interface{}
+		ok bool
+	}
+	tests := []struct {
+		name string
+		fn   func(i *Iter) (interface{}, error)
+		want []result
+	}{
+		{
+			name: "Float32",
+			fn:   func(i *Iter) (interface{}, error) { return i.Float32() },
+			want: []result{{float32(0.5), true}, {nil, false}, {nil, false}, {nil, false}, {float32(16777216), true}, {nil, false},
+				{float32(-129), true}, {float32(127), true}, {float32(65535), true}, {float32(70000), true}, {float32(-1), true}, {float32(3.5), true}},
+		},
+		{
+			name: "Int32",
+			fn:   func(i *Iter) (interface{}, error) { return i.Int32() },
+			want: []result{{int32(0), true}, {nil, false}, {int32(0), true}, {int32(16777217), true}, {int32(16777216), true}, {nil, false},
+				{int32(-129), true}, {int32(127), true}, {int32(65535), true}, {int32(70000), true}, {int32(-1), true}, {int32(3), true}},
+		},
+		{
+			name: "Int16",
+			fn:   func(i *Iter) (interface{}, error) { return i.Int16() },
+			want: []result{{int16(0), true}, {nil, false}, {int16(0), true}, {nil, false}, {nil, false}, {nil, false},
+				{int16(-129), true}, {int16(127), true}, {nil, false}, {nil, false}, {int16(-1), true}, {int16(3), true}},
+		},
+		{
+			name: "Int8",
+			fn:   func(i *Iter) (interface{}, error) { return i.Int8() },
+			want: []result{{int8(0), true}, {nil, false}, {int8(0), true}, {nil, false}, {nil, false}, {nil, false},
+				{nil, false}, {int8(127), true}, {nil, false}, {nil, false}, {int8(-1), true}, {int8(3), true}},
+		},
+		{
+			name: "Uint16",
+			fn:   func(i *Iter) (interface{}, error) { return i.Uint16() },
+			want: []result{{uint16(0), true}, {nil, false}, {uint16(0), true}, {nil, false}, {nil, false}, {nil, false},
+				{nil, false}, {uint16(127), true}, {uint16(65535), true}, {nil, false}, {nil, false}, {uint16(3), true}},
+		},
+		{
+			name: "Uint32",
+			fn:   func(i *Iter) (interface{}, error) { return i.Uint32() },
+			want: []result{{uint32(0), true}, {nil, false}, {uint32(0), true}, {uint32(16777217), true}, {uint32(16777216), true}, {nil, false},
+				{nil, false}, {uint32(127), true}, {uint32(65535), true}, {uint32(70000), true}, {nil, false}, {uint32(3), true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for j, want := range tt.want {
+				got, err := tt.fn(&vals[j])
+				if !want.ok {
+					if err == nil {
+						t.Errorf("index %d: want error, got %v", j, got)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("index %d: %v", j, err)
+					continue
+				}
+				if got != want.v {
+					t.Errorf("index %d: want %v (%T), got %v (%T)", j, want.v, want.v, got, got)
+				}
+			}
+		})
+	}
+}
+
+func TestArray_AsFloat32(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"f":[1,2.5,-3],"big":[1e39],"i":[1,-2,2147483647],"over":[1,2147483648]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	array := func(key string) *Array {
+		t.Helper()
+		i := pj.Iter()
+		elem, err := i.FindElement(nil, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		arr, err := elem.Iter.Array(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return arr
+	}
+	buf := make([]float32, 0, 10)
+	floats, err := array("f").AsFloat32(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(floats) != 3 || floats[0] != 1 || floats[1] != 2.5 || floats[2] != -3 || &floats[0] != &buf[:1][0] {
+		t.Errorf("unexpected result %v", floats)
+	}
+	if _, err := array("big").AsFloat32(buf[:0]); err == nil {
+		t.Error("want overflow error")
+	}
+	ints, err := array("i").AsInt32(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ints) != 3 || ints[0] != 1 || ints[1] != -2 || ints[2] != math.MaxInt32 {
+		t.Errorf("unexpected result %v", ints)
+	}
+	if _, err := array("over").AsInt32(ints[:0]); err == nil {
+		t.Error("want overflow error")
+	}
+}
+
+func TestIter_SetFloat32(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`[1,2,3,4]`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := pj.Iter()
+	i.Advance()
+	_, root, err := i.Root(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err := root.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := arr.Iter()
+	for _, v := range []float32{0.1, 1e-7, 3.4e38, 16777216} {
+		it.Advance()
+		if err := it.SetFloat32(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := pj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `[0.1,1e-7,3.4e+38,16777216]`
+	if string(got) != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// Flags survive serialization.
+	s := NewSerializer()
+	pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = pj2.MarshalJSON(); err != nil || string(got) != want {
+		t.Errorf("want %s, got %s (%v)", want, got, err)
+	}
+}
+
+func TestAppendFloat32(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for n := 0; n < 100000; n++ {
+		f := math.Float32frombits(rng.Uint32())
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			continue
+		}
+		got, err := appendFloat32(nil, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := strconv.ParseFloat(string(got), 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if float32(parsed) != f {
+			t.Fatalf("%s does not round trip to %v", got, f)
+		}
+		// Must be as short as the strconv representation.
+		if want := strconv.FormatFloat(float64(f), 'g', -1, 32); len(significand(string(got))) != len(significand(want)) {
+			t.Fatalf("%v: got %s, want digits of %s", f, got, want)
+		}
+	}
+}
+
+// significand returns the significant digits of a formatted number.
+func significand(s string) string {
+	var digits []byte
+	for _, c := range []byte(s) {
+		if c == 'e' {
+			break
+		}
+		if c >= '0' && c <= '9' {
+			digits = append(digits, c)
+		}
+	}
+	// Trim leading and trailing zeros.
+	for len(digits) > 0 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	for len(digits) > 0 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+	}
+	return string(digits)
+}
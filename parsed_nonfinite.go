@@ -0,0 +1,93 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"math"
+)
+
+// NonFinite controls how NaN and infinite float values on a tape are handled.
+// JSON input never contains these values, but they can be added with SetFloat.
+type NonFinite uint8
+
+const (
+	// NonFiniteError will return an error when marshaling NaN or infinite values.
+	// This is the default.
+	NonFiniteError NonFinite = iota
+
+	// NonFiniteNull will marshal NaN and infinite values as null.
+	NonFiniteNull
+
+	// NonFiniteString will marshal NaN and infinite values as the strings "NaN", "Infinity" and "-Infinity".
+	NonFiniteString
+
+	// NonFiniteLiteral will marshal NaN and infinite values as the JSON5 literals NaN, Infinity and -Infinity.
+	// Output containing these values is not valid JSON.
+	NonFiniteLiteral
+
+	// NonFiniteRejectSet can be combined with one of the values above.
+	// When set, SetFloat and SetFloat32 will return an error for NaN and infinite values.
+	NonFiniteRejectSet NonFinite = 1 << 7
+
+	nonFiniteOutputMask = NonFiniteRejectSet - 1
+)
+
+// errNonFinite is returned when NaN or infinite values cannot be marshaled.
+var errNonFinite = errors.New("INF or NaN number found")
+
+// SetNonFinite sets how NaN and infinite float values are handled.
+// The setting applies to iterators, objects and arrays obtained from pj after the call,
+// including marshaling and StringCvt.
+// The setting is not serialized.
+func (pj *ParsedJson) SetNonFinite(p NonFinite) {
+	pj.updateMeta(func(m *tapeMeta) { m.nonFinite = p })
+}
+
+// NonFinite returns how NaN and infinite float values are handled.
+func (pj *ParsedJson) NonFinite() NonFinite {
+	return pj.meta.nonFiniteMode()
+}
+
+// isNonFinite returns whether f is NaN or infinite.
+func isNonFinite(f float64) bool {
+	return math.IsInf(f, 0) || math.IsNaN(f)
+}
+
+// appendNonFinite appends the NaN or infinite value f to dst according to p.
+func appendNonFinite(dst []byte, f float64, p NonFinite) ([]byte, error) {
+	var s string
+	switch {
+	case math.IsNaN(f):
+		s = "NaN"
+	case f > 0:
+		s = "Infinity"
+	default:
+		s = "-Infinity"
+	}
+	switch p & nonFiniteOutputMask {
+	case NonFiniteNull:
+		return append(dst, "null"...), nil
+	case NonFiniteString:
+		dst = append(dst, '"')
+		dst = append(dst, s...)
+		return append(dst, '"'), nil
+	case NonFiniteLiteral:
+		return append(dst, s...), nil
+	}
+	return nil, errNonFinite
+}
@@ -0,0 +1,135 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNonFinite(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := Parse([]byte(`{"a":[1,2,3,4.5]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := pj.Iter()
+	elem, err := i.FindElement(nil, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err := elem.Iter.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := arr.Iter()
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		it.Advance()
+		if err := it.SetFloat(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it.Advance()
+	if err := it.SetFloat32(float32(math.Inf(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		p    NonFinite
+		want string
+		cvt  string
+	}{
+		{p: NonFiniteError},
+		{p: NonFiniteNull, want: `{"a":[null,null,null,null]}`, cvt: "null"},
+		{p: NonFiniteString, want: `{"a":["NaN","Infinity","-Infinity","Infinity"]}`, cvt: "NaN"},
+		{p: NonFiniteLiteral | NonFiniteRejectSet, want: `{"a":[NaN,Infinity,-Infinity,Infinity]}`, cvt: "NaN"},
+	}
+	for _, test := range tests {
+		pj.SetNonFinite(test.p)
+		got, err := pj.MarshalJSON()
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%d: want error, got %s", test.p, got)
+			}
+		} else if err != nil || string(got) != test.want {
+			t.Errorf("%d: want %s, got %s (%v)", test.p, test.want, got, err)
+		}
+
+		// Objects and arrays inherit the setting.
+		i := pj.Iter()
+		elem, err := i.FindElement(nil, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		arr, err := elem.Iter.Array(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := arr.Iter()
+		it.Advance()
+		cvt, err := it.StringCvt()
+		if test.cvt == "" {
+			if err == nil {
+				t.Errorf("%d: want error, got %s", test.p, cvt)
+			}
+		} else if err != nil || cvt != test.cvt {
+			t.Errorf("%d: want %s, got %s (%v)", test.p, test.cvt, cvt, err)
+		}
+		err = it.SetFloat(math.NaN())
+		if reject := test.p&NonFiniteRejectSet != 0; reject != (err != nil) {
+			t.Errorf("%d: want reject %v, got %v", test.p, reject, err)
+		}
+		if err := it.SetFloat(1); err != nil {
+			t.Error(err)
+		}
+		if err := it.SetFloat(math.NaN()); err != nil && test.p&NonFiniteRejectSet == 0 {
+			t.Error(err)
+		}
+	}
+
+	// Values survive serialization, the setting does not.
+	pj.SetNonFinite(NonFiniteString)
+	want, err := pj.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSerializer()
+	pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pj2.MarshalJSON(); err == nil {
+		t.Error("want error with default setting")
+	}
+	pj2.SetNonFinite(NonFiniteString)
+	if got, err := pj2.MarshalJSON(); err != nil || string(got) != string(want) {
+		t.Errorf("want %s, got %s (%v)", want, got, err)
+	}
+
+	// Changing the setting must not affect copies and existing iterators.
+	cp := *pj2
+	iter := pj2.Iter()
+	pj2.SetNonFinite(NonFiniteNull)
+	if cp.NonFinite() != NonFiniteString {
+		t.Errorf("copy changed to %v", cp.NonFinite())
+	}
+	if got, err := iter.MarshalJSON(); err != nil || string(got) != string(want) {
+		t.Errorf("iterator: want %s, got %s (%v)", want, got, err)
+	}
+}
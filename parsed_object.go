@@ -97,6 +97,7 @@ func (o *Object) Parse(dst *Elements) (*Elements, error) {
 func (o *Object) FindKey(key string, dst *Element) *Element {
 	tmp := o.tape.Iter()
 	tmp.off = o.off
+	m := o.tape.newKeyMatcher(key)
 	for {
 		typ := tmp.Advance()
 		// We want name and at least one value.
@@ -104,9 +105,11 @@ func (o *Object) FindKey(key string, dst *Element) *Element {
 			return nil
 		}
 		// Advance must be string or end of object
-		offset := tmp.cur
-		length := tmp.tape.Tape[tmp.off]
-		if int(length) != len(key) {
+		found, err := m.match(&tmp)
+		if err != nil {
+			return nil
+		}
+		if !found {
 			// Skip the value.
 			t := tmp.Advance()
 			if t == TypeNone {
@@ -114,17 +117,6 @@ func (o *Object) FindKey(key string, dst *Element) *Element {
 			}
 			continue
 		}
-		// Read name
-		name, err := tmp.tape.stringByteAt(offset, length)
-		if err != nil {
-			return nil
-		}
-
-		if string(name) != key {
-			// Skip the value
-			tmp.Advance()
-			continue
-		}
 		if dst == nil {
 			dst = &Element{}
 		}
@@ -150,10 +142,8 @@ func (o *Object) ForEach(fn func(key []byte, i Iter), onlyKeys map[string]struct
 			return fmt.Errorf("object: unexpected name tag %v", tmp.t)
 		}
 		// Advance must be string or end of object
-		offset := tmp.cur
-		length := tmp.tape.Tape[tmp.off]
 		// Read name
-		name, err := tmp.tape.stringByteAt(offset, length)
+		name, err := tmp.StringBytes()
 		if err != nil {
 			return fmt.Errorf("getting object name: %w", err)
 		}
@@ -196,6 +186,7 @@ func (o *Object) FindPath(dst *Element, path ...string) (*Element, error) {
 	tmp.off = o.off
 	key := path[0]
 	path = path[1:]
+	m := o.tape.newKeyMatcher(key)
 	for {
 		typ := tmp.Advance()
 		// We want name and at least one value.
@@ -203,9 +194,11 @@ func (o *Object) FindPath(dst *Element, path ...string) (*Element, error) {
 			return dst, ErrPathNotFound
 		}
 		// Advance must be string or end of object
-		offset := tmp.cur
-		length := tmp.tape.Tape[tmp.off]
-		if int(length) != len(key) {
+		found, err := m.match(&tmp)
+		if err != nil {
+			return dst, err
+		}
+		if !found {
 			// Skip the value.
 			t := tmp.Advance()
 			if t == TypeNone {
@@ -214,17 +207,6 @@ func (o *Object) FindPath(dst *Element, path ...string) (*Element, error) {
 			}
 			continue
 		}
-		// Read name
-		name, err := tmp.tape.stringByteAt(offset, length)
-		if err != nil {
-			return dst, err
-		}
-
-		if string(name) != key {
-			// Skip the value
-			tmp.Advance()
-			continue
-		}
 		// Done...
 		if len(path) == 0 {
 			if dst == nil {
@@ -247,6 +229,7 @@ func (o *Object) FindPath(dst *Element, path ...string) (*Element, error) {
 		}
 		key = path[0]
 		path = path[1:]
+		m = o.tape.newKeyMatcher(key)
 	}
 }
 
@@ -280,6 +263,15 @@ func (o *Object) NextElementBytes(dst *Iter) (name []byte, t Type, err error) {
 			return nil, TypeNone, fmt.Errorf("parsing object element name: %w", err)
 		}
 		o.off += 2
+	case TagStringInline:
+		if o.off+1 >= len(o.tape.Tape) {
+			return nil, TypeNone, fmt.Errorf("parsing object element name: unexpected end of tape")
+		}
+		name, err = inlineStringBytes(o.tape.Tape, o.off)
+		if err != nil {
+			return nil, TypeNone, fmt.Errorf("parsing object element name: %w", err)
+		}
+		o.off++
 	case TagObjectEnd:
 		return nil, TypeNone, nil
 	default:
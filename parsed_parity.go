@@ -0,0 +1,476 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MismatchKind is the kind of a difference found by Parity.
+type MismatchKind uint8
+
+const (
+	// MismatchError is reported when only one of the parsers returns an error.
+	MismatchError MismatchKind = iota
+
+	// MismatchType is reported when values have different types.
+	// This includes numbers stored as a different type than the literal implies.
+	MismatchType
+
+	// MismatchValue is reported when values of the same type differ.
+	MismatchValue
+
+	// MismatchMissing is reported for values only found by encoding/json.
+	MismatchMissing
+
+	// MismatchExtra is reported for values only found by simdjson-go.
+	MismatchExtra
+
+	// MismatchDuplicateKey is reported for duplicate object keys with different values.
+	// Lookups in simdjson-go return the first value, while encoding/json keeps the last.
+	MismatchDuplicateKey
+)
+
+// String returns the name of the kind.
+func (k MismatchKind) String() string {
+	switch k {
+	case MismatchError:
+		return "error"
+	case MismatchType:
+		return "type"
+	case MismatchValue:
+		return "value"
+	case MismatchMissing:
+		return "missing"
+	case MismatchExtra:
+		return "extra"
+	case MismatchDuplicateKey:
+		return "duplicate key"
+	}
+	return "(invalid)"
+}
+
+// Mismatch is a difference between simdjson-go and encoding/json.
+type Mismatch struct {
+	// Root is the index of the root element.
+	Root int
+
+	// Path is the location of the value within the root element.
+	Path Path
+
+	Kind MismatchKind
+
+	// Got describes the simdjson-go value or error.
+	Got string
+
+	// Want describes the encoding/json value or error.
+	Want string
+}
+
+// String returns a description of the mismatch.
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%v mismatch at %d:%v: simdjson %s, encoding/json %s", m.Kind, m.Root, m.Path, m.Got, m.Want)
+}
+
+// Parity compares the results of parsing with simdjson-go and encoding/json.
+// Values are compared semantically, as they would be decoded into interface{} values,
+// except that the number type chosen by simdjson-go is also checked.
+// It can be used in tests and to shadow a fraction of production traffic using Sample.
+// A Parity can be used concurrently, but must not be copied after first use.
+type Parity struct {
+	// SampleRate is the fraction of inputs checked by Sample, between 0 and 1.
+	SampleRate float64
+
+	// Report is called by Sample when mismatches are found.
+	// The input must not be retained after the call returns.
+	Report func(input []byte, mismatches []Mismatch)
+
+	// Options are used when parsing with simdjson-go.
+	Options []ParserOption
+
+	pool sync.Pool
+}
+
+// Check parses a single JSON value with Parse and encoding/json and returns the differences.
+func (p *Parity) Check(b []byte) []Mismatch {
+	return p.check(b, false)
+}
+
+// CheckND parses NDJSON with ParseND and a stream of values with encoding/json
+// and returns the differences.
+func (p *Parity) CheckND(b []byte) []Mismatch {
+	return p.check(b, true)
+}
+
+// Sample checks the input with the probability set by SampleRate
+// and calls Report if there are any mismatches.
+// Returns whether the input was checked.
+func (p *Parity) Sample(b []byte, nd bool) bool {
+	if p.SampleRate <= 0 || (p.SampleRate < 1 && rand.Float64() >= p.SampleRate) {
+		return false
+	}
+	if m := p.check(b, nd); len(m) > 0 && p.Report != nil {
+		p.Report(b, m)
+	}
+	return true
+}
+
+func (p *Parity) check(b []byte, nd bool) []Mismatch {
+	want, stdErr := parityDecode(b, nd)
+
+	reuse, _ := p.pool.Get().(*ParsedJson)
+	var pj *ParsedJson
+	var err error
+	if nd {
+		pj, err = ParseND(b, reuse, p.Options...)
+	} else {
+		pj, err = Parse(b, reuse, p.Options...)
+	}
+	if pj != nil {
+		defer p.pool.Put(pj)
+	}
+
+	switch {
+	case err != nil && stdErr != nil:
+		return nil
+	case err != nil:
+		return []Mismatch{{Kind: MismatchError, Got: "error: " + err.Error(), Want: "no error"}}
+	case stdErr != nil:
+		return []Mismatch{{Kind: MismatchError, Got: "no error", Want: "error: " + stdErr.Error()}}
+	}
+
+	return parityCompareAll(pj, want)
+}
+
+// parityCompareAll compares all root elements of pj to want.
+func parityCompareAll(pj *ParsedJson, want []parityValue) []Mismatch {
+	c := parityCompare{pj: pj}
+	off := 0
+	for root := 0; off < len(pj.Tape) || root < len(want); root++ {
+		c.root = root
+		for off < len(pj.Tape) && Tag(pj.Tape[off]>>JSONTAGOFFSET) != TagRoot {
+			off++
+		}
+		switch {
+		case off >= len(pj.Tape) && root >= len(want):
+			return c.mismatches
+		case off >= len(pj.Tape):
+			c.add(nil, MismatchMissing, "no value", want[root].String())
+		case root >= len(want):
+			c.add(nil, MismatchExtra, c.describe(off+1), "no value")
+		default:
+			c.value(off+1, &want[root], nil)
+		}
+		if off < len(pj.Tape) {
+			off = tapeNext(pj.Tape, off)
+		}
+	}
+	return c.mismatches
+}
+
+// parityValue is a value decoded by encoding/json.
+// Object members are kept in order, including duplicates.
+type parityValue struct {
+	kind byte // '{', '[', '"', '0', 'n', 't' or 'f'
+	str  string
+	keys []string
+	vals []parityValue
+}
+
+// String returns a short description of the value.
+func (v *parityValue) String() string {
+	switch v.kind {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return strconv.Quote(v.str)
+	case '0':
+		return "number " + v.str
+	case 't':
+		return "true"
+	case 'f':
+		return "false"
+	}
+	return "null"
+}
+
+// parityDecode decodes all values in b using the encoding/json token stream.
+func parityDecode(b []byte, nd bool) ([]parityValue, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var res []parityValue
+	for {
+		v, err := parityDecodeValue(dec)
+		if err == io.EOF && (nd || len(res) == 1) {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !nd && len(res) == 1 {
+			return nil, errors.New("invalid character after top-level value")
+		}
+		res = append(res, v)
+	}
+}
+
+func parityDecodeValue(dec *json.Decoder) (parityValue, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return parityValue{}, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		v := parityValue{kind: byte(t)}
+		if t != '{' && t != '[' {
+			return v, fmt.Errorf("unexpected %v", t)
+		}
+		for dec.More() {
+			if t == '{' {
+				k, err := dec.Token()
+				if err != nil {
+					return v, parityUnexpectedEOF(err)
+				}
+				ks, ok := k.(string)
+				if !ok {
+					return v, fmt.Errorf("unexpected object key %v", k)
+				}
+				v.keys = append(v.keys, ks)
+			}
+			elem, err := parityDecodeValue(dec)
+			if err != nil {
+				return v, parityUnexpectedEOF(err)
+			}
+			v.vals = append(v.vals, elem)
+		}
+		// Consume end delimiter.
+		_, err := dec.Token()
+		return v, parityUnexpectedEOF(err)
+	case string:
+		return parityValue{kind: '"', str: t}, nil
+	case json.Number:
+		// Decoding into interface{} fails for numbers out of float64 range.
+		if _, err := strconv.ParseFloat(string(t), 64); err != nil {
+			return parityValue{}, fmt.Errorf("json: cannot unmarshal number %s into Go value of type float64", t)
+		}
+		return parityValue{kind: '0', str: string(t)}, nil
+	case bool:
+		if t {
+			return parityValue{kind: 't'}, nil
+		}
+		return parityValue{kind: 'f'}, nil
+	case nil:
+		return parityValue{kind: 'n'}, nil
+	}
+	return parityValue{}, fmt.Errorf("unexpected token %v", tok)
+}
+
+// parityUnexpectedEOF converts io.EOF inside a value, so it isn't mistaken for the end of input.
+func parityUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+type parityCompare struct {
+	pj         *ParsedJson
+	root       int
+	mismatches []Mismatch
+}
+
+func (c *parityCompare) add(p Path, kind MismatchKind, got, want string) {
+	c.mismatches = append(c.mismatches, Mismatch{Root: c.root, Path: append(Path(nil), p...), Kind: kind, Got: got, Want: want})
+}
+
+// describe returns a short description of the value at tape offset off.
+func (c *parityCompare) describe(off int) string {
+	tape := c.pj.Tape
+	v := tape[off]
+	switch tag := Tag(v >> JSONTAGOFFSET); tag {
+	case TagObjectStart:
+		return "object"
+	case TagArrayStart:
+		return "array"
+	case TagString, TagStringInline:
+		s, err := c.pj.tapeStringBytes(off)
+		if err != nil {
+			return "invalid string"
+		}
+		return strconv.Quote(string(s))
+	case TagInteger:
+		return "int " + strconv.FormatInt(int64(tape[off+1]), 10)
+	case TagIntegerInline:
+		return "int " + strconv.FormatInt(inlineInt(v&JSONVALUEMASK), 10)
+	case TagUint:
+		return "uint " + strconv.FormatUint(tape[off+1], 10)
+	case TagFloat:
+		return "float " + strconv.FormatFloat(math.Float64frombits(tape[off+1]), 'g', -1, 64)
+	case TagBoolTrue:
+		return "true"
+	case TagBoolFalse:
+		return "false"
+	case TagNull:
+		return "null"
+	default:
+		return tag.String()
+	}
+}
+
+// value compares the value at tape offset off to want.
+func (c *parityCompare) value(off int, want *parityValue, p Path) {
+	tape := c.pj.Tape
+	v := tape[off]
+	tag := Tag(v >> JSONTAGOFFSET)
+	switch {
+	case tag == TagObjectStart && want.kind == '{':
+		c.object(off, want, p)
+	case tag == TagArrayStart && want.kind == '[':
+		c.array(off, want, p)
+	case (tag == TagString || tag == TagStringInline) && want.kind == '"':
+		s, err := c.pj.tapeStringBytes(off)
+		if err != nil || string(s) != want.str {
+			c.add(p, MismatchValue, c.describe(off), want.String())
+		}
+	case (tag == TagInteger || tag == TagIntegerInline || tag == TagUint || tag == TagFloat) && want.kind == '0':
+		c.number(off, want, p)
+	case tag == TagNull && want.kind == 'n',
+		tag == TagBoolTrue && want.kind == 't',
+		tag == TagBoolFalse && want.kind == 'f':
+	case (tag == TagBoolTrue || tag == TagBoolFalse) && (want.kind == 't' || want.kind == 'f'):
+		c.add(p, MismatchValue, c.describe(off), want.String())
+	default:
+		c.add(p, MismatchType, c.describe(off), want.String())
+	}
+}
+
+// number compares a number with the literal decoded by encoding/json.
+// Integer literals are expected to be stored as int64 if possible, then uint64.
+func (c *parityCompare) number(off int, want *parityValue, p Path) {
+	tape := c.pj.Tape
+	tag := Tag(tape[off] >> JSONTAGOFFSET)
+	var val uint64
+	if tag == TagIntegerInline {
+		tag, val = TagInteger, uint64(inlineInt(tape[off]&JSONVALUEMASK))
+	} else {
+		val = tape[off+1]
+	}
+	lit := want.str
+	wantTag := TagFloat
+	var equal bool
+	if !strings.ContainsAny(lit, ".eE") {
+		if i, err := strconv.ParseInt(lit, 10, 64); err == nil {
+			wantTag = TagInteger
+			equal = tag == TagInteger && int64(val) == i
+		} else if u, err := strconv.ParseUint(lit, 10, 64); err == nil {
+			wantTag = TagUint
+			equal = tag == TagUint && val == u
+		}
+	}
+	if wantTag == TagFloat {
+		f, _ := strconv.ParseFloat(lit, 64)
+		equal = tag == TagFloat && math.Float64frombits(val) == f
+	}
+	switch {
+	case tag != wantTag:
+		c.add(p, MismatchType, c.describe(off), want.String())
+	case !equal:
+		c.add(p, MismatchValue, c.describe(off), want.String())
+	}
+}
+
+func (c *parityCompare) array(off int, want *parityValue, p Path) {
+	tape := c.pj.Tape
+	off++
+	for i := 0; ; i++ {
+		end := Tag(tape[off]>>JSONTAGOFFSET) == TagArrayEnd
+		if end && i >= len(want.vals) {
+			return
+		}
+		ep := append(p, PathIndex(i))
+		switch {
+		case end:
+			c.add(ep, MismatchMissing, "no value", want.vals[i].String())
+		case i >= len(want.vals):
+			c.add(ep, MismatchExtra, c.describe(off), "no value")
+		default:
+			c.value(off, &want.vals[i], ep)
+		}
+		if !end {
+			off = tapeNext(tape, off)
+		}
+	}
+}
+
+func (c *parityCompare) object(off int, want *parityValue, p Path) {
+	tape := c.pj.Tape
+
+	// encoding/json keeps the last value of duplicate keys.
+	type member struct{ idx, n int }
+	last := make(map[string]member, len(want.keys))
+	for i, k := range want.keys {
+		last[k] = member{idx: i, n: last[k].n + 1}
+	}
+
+	// Lookups in simdjson-go return the first value of duplicate keys.
+	seen := make(map[string]bool, len(want.keys))
+	for off = off + 1; Tag(tape[off]>>JSONTAGOFFSET) != TagObjectEnd; off = tapeNext(tape, tapeNext(tape, off)) {
+		kb, err := c.pj.tapeStringBytes(off)
+		if err != nil {
+			c.add(p, MismatchValue, "invalid key", "object")
+			return
+		}
+		k := string(kb)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		ep := append(p, PathKey(k))
+		voff := tapeNext(tape, off)
+		m, ok := last[k]
+		if !ok {
+			c.add(ep, MismatchExtra, c.describe(voff), "no value")
+			continue
+		}
+		if m.n == 1 {
+			c.value(voff, &want.vals[m.idx], ep)
+			continue
+		}
+		// Check whether the first and last value are the same.
+		sub := parityCompare{pj: c.pj, root: c.root}
+		sub.value(voff, &want.vals[m.idx], ep)
+		if len(sub.mismatches) > 0 {
+			c.add(ep, MismatchDuplicateKey, c.describe(voff), want.vals[m.idx].String())
+		}
+	}
+	for i, k := range want.keys {
+		if !seen[k] && last[k].idx == i {
+			c.add(append(p, PathKey(k)), MismatchMissing, "no value", want.vals[i].String())
+		}
+	}
+}
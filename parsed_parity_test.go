@@ -0,0 +1,128 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mismatchStrings(m []Mismatch) []string {
+	var res []string
+	for _, mm := range m {
+		res = append(res, mm.String())
+	}
+	return res
+}
+
+func TestParity_Check(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	var p Parity
+	tests := map[string][]string{
+		`{"a":"b\u00e9\n","c":[1,-2,1.5,1e2,18446744073709551615,true,false,null],"d":{}}`: nil,
+		`{"a":1,"a":1}`: nil,
+		`{"a":1,"a":2}`: {"duplicate key mismatch at 0:a: simdjson int 1, encoding/json number 2"},
+		`{"a":`:         nil,
+		`[1] [2]`:       nil,
+	}
+	for input, want := range tests {
+		if got := mismatchStrings(p.Check([]byte(input))); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", input, got, want)
+		}
+	}
+
+	got := mismatchStrings(p.CheckND([]byte("{\"a\":1}\n[true]\n{}\n")))
+	if got != nil {
+		t.Errorf("ndjson: unexpected mismatches %q", got)
+	}
+
+	// Scalar roots are rejected by simdjson-go.
+	m := p.Check([]byte(`"x"`))
+	if len(m) != 1 || m[0].Kind != MismatchError || m[0].Want != "no error" {
+		t.Errorf("scalar root: got %q", mismatchStrings(m))
+	}
+}
+
+func TestParity_Compare(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const doc = "{\"a\":{\"x\":1,\"y\":[1,2,3]},\"b\":\"s\",\"c\":1.5}\n{\"z\":0}"
+	tests := []struct {
+		other string
+		want  []string
+	}{
+		{other: doc},
+		{
+			other: "{\"a\":{\"x\":1.0,\"y\":[1,5]},\"b\":\"t\",\"c\":2.5,\"d\":null}\n{\"z\":0}",
+			want: []string{
+				"type mismatch at 0:a.x: simdjson int 1, encoding/json number 1.0",
+				"value mismatch at 0:a.y[1]: simdjson int 2, encoding/json number 5",
+				"extra mismatch at 0:a.y[2]: simdjson int 3, encoding/json no value",
+				`value mismatch at 0:b: simdjson "s", encoding/json "t"`,
+				"value mismatch at 0:c: simdjson float 1.5, encoding/json number 2.5",
+				"missing mismatch at 0:d: simdjson no value, encoding/json null",
+			},
+		},
+		{
+			other: "{\"a\":[],\"c\":1.5}",
+			want: []string{
+				"type mismatch at 0:a: simdjson object, encoding/json array",
+				`extra mismatch at 0:b: simdjson "s", encoding/json no value`,
+				"extra mismatch at 1:: simdjson object, encoding/json no value",
+			},
+		},
+	}
+	pj, err := ParseND([]byte(doc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		want, err := parityDecode([]byte(test.other), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mismatchStrings(parityCompareAll(pj, want)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.other, got, test.want)
+		}
+	}
+}
+
+func TestParity_Sample(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	var reported []Mismatch
+	p := Parity{
+		SampleRate: 1,
+		Report: func(input []byte, m []Mismatch) {
+			reported = append(reported, m...)
+		},
+	}
+	if !p.Sample([]byte(`{"a":1,"a":2}`), false) {
+		t.Fatal("input not sampled")
+	}
+	if len(reported) != 1 || reported[0].Kind != MismatchDuplicateKey {
+		t.Errorf("unexpected report %v", reported)
+	}
+	p.SampleRate = 0
+	if p.Sample([]byte(`{}`), false) {
+		t.Error("input sampled with zero rate")
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathElement is a single step in a Path.
+type PathElement struct {
+	// Key is the object key. Only used if Index is negative.
+	Key string
+
+	// Index is the array index or -1 if the element is an object key.
+	Index int
+}
+
+// PathKey returns a path element for the object key k.
+func PathKey(k string) PathElement {
+	return PathElement{Key: k, Index: -1}
+}
+
+// PathIndex returns a path element for the array index i.
+func PathIndex(i int) PathElement {
+	return PathElement{Index: i}
+}
+
+// IsIndex returns whether the element is an array index.
+func (e PathElement) IsIndex() bool {
+	return e.Index >= 0
+}
+
+// Path is the location of a value within a root element.
+// An empty path is the root element itself.
+type Path []PathElement
+
+// String returns the path in the form accepted by ParsePath, for example `Image.IDs[2]`.
+// Keys that cannot be represented unquoted are written as `["key"]`.
+func (p Path) String() string {
+	var sb strings.Builder
+	for i, e := range p {
+		if e.IsIndex() {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(e.Index))
+			sb.WriteByte(']')
+			continue
+		}
+		if e.Key == "" || strings.ContainsAny(e.Key, `.[]"\`) {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Quote(e.Key))
+			sb.WriteByte(']')
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(e.Key)
+	}
+	return sb.String()
+}
+
+// Equal returns whether p and other are the same path.
+func (p Path) Equal(other Path) bool {
+	if len(p) != len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePath parses a path in the format returned by Path.String.
+// Keys are separated by '.', array indexes are written as `[n]`
+// and keys can be quoted as `["key"]`.
+// For example `Image.Thumbnail["Url"]` or `IDs[2]`.
+// An empty string returns an empty path.
+func ParsePath(s string) (Path, error) {
+	var p Path
+	for len(s) > 0 {
+		switch s[0] {
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if len(s) > 1 && s[1] == '"' {
+				// Find the closing quote, skipping escaped characters.
+				end = -1
+				for i := 2; i < len(s); i++ {
+					if s[i] == '\\' {
+						i++
+						continue
+					}
+					if s[i] == '"' {
+						if i+1 < len(s) && s[i+1] == ']' {
+							end = i + 1
+						}
+						break
+					}
+				}
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quoted key in path %q", s)
+				}
+				k, err := strconv.Unquote(s[1:end])
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted key in path %q: %w", s[1:end], err)
+				}
+				p = append(p, PathKey(k))
+			} else {
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated index in path %q", s)
+				}
+				idx, err := strconv.Atoi(s[1:end])
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index %q in path", s[1:end])
+				}
+				p = append(p, PathIndex(idx))
+			}
+			s = s[end+1:]
+		case '.':
+			if len(p) == 0 {
+				return nil, errors.New("path cannot start with '.'")
+			}
+			s = s[1:]
+			fallthrough
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in path")
+			}
+			p = append(p, PathKey(s[:end]))
+			s = s[end:]
+		}
+	}
+	return p, nil
+}
+
+// walkFrame is a container being walked by tapeWalker.
+type walkFrame struct {
+	tag     Tag  // TagObjectStart or TagArrayStart
+	wantKey bool // next entry in object is a key
+	index   int  // current array index
+	keyOff  int  // tape offset of the current object key
+}
+
+// tapeWalker walks a tape linearly and keeps track of the path of every entry.
+type tapeWalker struct {
+	pj     *ParsedJson
+	frames []walkFrame
+
+	// root is the offset of the root tag of the current element.
+	root int
+}
+
+// walk calls fn for every key and value on the tape in order.
+// isKey is set for object keys. Root and end tags are not visited.
+// If fn returns an error walking stops and the error is returned.
+func (w *tapeWalker) walk(fn func(off int, tag Tag, isKey bool) error) error {
+	tape := w.pj.Tape
+	w.frames = w.frames[:0]
+	w.root = 0
+	for off := 0; off < len(tape); {
+		v := tape[off]
+		tag := Tag(v >> JSONTAGOFFSET)
+		switch tag {
+		case TagRoot:
+			if int(v&JSONVALUEMASK) > off {
+				// Opening root
+				w.root = off
+				w.frames = w.frames[:0]
+			}
+			off++
+			continue
+		case TagObjectEnd, TagArrayEnd:
+			if len(w.frames) == 0 {
+				return fmt.Errorf("unexpected %v at offset %d", tag, off)
+			}
+			w.frames = w.frames[:len(w.frames)-1]
+			off++
+			continue
+		case TagEnd:
+			off++
+			continue
+		}
+
+		isKey := false
+		if len(w.frames) > 0 {
+			f := &w.frames[len(w.frames)-1]
+			switch {
+			case f.tag == TagArrayStart:
+				f.index++
+			case f.wantKey:
+				if tag != TagString && tag != TagStringInline {
+					return fmt.Errorf("expected object key at offset %d, got %v", off, tag)
+				}
+				f.keyOff = off
+				f.wantKey = false
+				isKey = true
+			default:
+				f.wantKey = true
+			}
+		}
+		if err := fn(off, tag, isKey); err != nil {
+			return err
+		}
+		switch tag {
+		case TagObjectStart:
+			w.frames = append(w.frames, walkFrame{tag: tag, wantKey: true})
+			off++
+		case TagArrayStart:
+			w.frames = append(w.frames, walkFrame{tag: tag, index: -1})
+			off++
+		case TagString, TagInteger, TagUint, TagFloat:
+			off += 2
+		default:
+			off++
+		}
+	}
+	return nil
+}
+
+// path returns the path of the entry currently visited.
+// For keys the path includes the key itself.
+// The path is appended to dst.
+func (w *tapeWalker) path(dst Path) (Path, error) {
+	for _, f := range w.frames {
+		if f.tag == TagArrayStart {
+			dst = append(dst, PathIndex(f.index))
+			continue
+		}
+		k, err := w.pj.tapeStringBytes(f.keyOff)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, PathKey(string(k)))
+	}
+	return dst, nil
+}
+
+// iterAt returns an iterator containing only the value at tape offset off.
+func (pj *ParsedJson) iterAt(off int) (Iter, error) {
+	i := Iter{tape: *pj, off: off}
+	var dst Iter
+	if _, err := i.AdvanceIter(&dst); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+// rootIterAt returns the iterator of the root element at offset off,
+// similar to the iterators returned by ForEach.
+func (pj *ParsedJson) rootIterAt(off int) (Iter, error) {
+	i, err := pj.iterAt(off)
+	if err != nil {
+		return i, err
+	}
+	if i.t != TagRoot {
+		return i, fmt.Errorf("expected root at offset %d, got %v", off, i.t)
+	}
+	i.AdvanceInto()
+	return i, nil
+}
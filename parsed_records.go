@@ -0,0 +1,198 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// recordIndex contains the tape offsets of all root elements.
+type recordIndex struct {
+	offs []int
+
+	// first and tapeLen identify the tape the index was built for.
+	first   *uint64
+	tapeLen int
+}
+
+// newRecordIndex returns an index with the root offsets offs of tape.
+func newRecordIndex(offs []int, tape []uint64) recordIndex {
+	r := recordIndex{offs: offs, tapeLen: len(tape)}
+	if len(tape) > 0 {
+		r.first = &tape[0]
+	}
+	return r
+}
+
+// valid returns whether the index has been built for tape.
+// The tape must be the same slice, not only have the same length.
+func (r *recordIndex) valid(tape []uint64) bool {
+	return r.first != nil && len(tape) == r.tapeLen && &tape[0] == r.first
+}
+
+// RecordCount returns the number of root elements on the tape.
+// For NDJSON this is the number of records.
+// If the tape has an index of the root elements, see WithRecordIndex
+// and BuildRecordIndex, RecordCount and Record are O(1).
+// Otherwise the root elements are located on every call.
+func (pj *ParsedJson) RecordCount() (int, error) {
+	offs, err := pj.recordOffsets()
+	return len(offs), err
+}
+
+// Record returns an iterator of root element n, similar to the iterators returned by ForEach.
+// See RecordCount for the use of the index.
+func (pj *ParsedJson) Record(n int) (Iter, error) {
+	offs, err := pj.recordOffsets()
+	if err != nil {
+		return Iter{}, err
+	}
+	if n < 0 || n >= len(offs) {
+		return Iter{}, fmt.Errorf("record %d out of range, have %d records", n, len(offs))
+	}
+	return pj.rootIterAt(offs[n])
+}
+
+// SearchRecords uses binary search to find the smallest record index n for which fn returns true.
+// Records must be sorted so fn returns false for a prefix of the records and true for the remaining.
+// If fn returns true for no record, the record count is returned.
+// If fn returns an error searching stops and the error is returned.
+// If the tape has no index, the root elements are located once per call.
+func (pj *ParsedJson) SearchRecords(fn func(i Iter) (bool, error)) (int, error) {
+	offs, err := pj.recordOffsets()
+	if err != nil {
+		return 0, err
+	}
+	lo, hi := 0, len(offs)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		i, err := pj.rootIterAt(offs[mid])
+		if err != nil {
+			return 0, err
+		}
+		ok, err := fn(i)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo, nil
+}
+
+// BuildRecordIndex builds an index of the root elements, if the tape doesn't have one.
+// The index is dropped when the tape is replaced, for example when parsing into pj again.
+// Use WithRecordIndex to build it while parsing.
+// BuildRecordIndex modifies pj, so it must not be called concurrently with other use of pj.
+func (pj *ParsedJson) BuildRecordIndex() error {
+	if _, ok := pj.meta.recordOffsets(pj.Tape); ok {
+		return nil
+	}
+	offs, err := appendRootOffsets(nil, pj.Tape)
+	if err != nil {
+		return err
+	}
+	pj.setRecordIndex(offs)
+	return nil
+}
+
+// setRecordIndex sets the index of root elements to offs.
+func (pj *ParsedJson) setRecordIndex(offs []int) {
+	pj.updateMeta(func(m *tapeMeta) { m.records = newRecordIndex(offs, pj.Tape) })
+}
+
+// recordOffsets returns the offsets of the root elements,
+// from the index if there is one.
+func (pj *ParsedJson) recordOffsets() ([]int, error) {
+	if offs, ok := pj.meta.recordOffsets(pj.Tape); ok {
+		return offs, nil
+	}
+	return appendRootOffsets(nil, pj.Tape)
+}
+
+// appendRootOffsets appends the offsets of all root elements on tape to dst.
+func appendRootOffsets(dst []int, tape []uint64) ([]int, error) {
+	for off := 0; off < len(tape); {
+		v := tape[off]
+		switch Tag(v >> JSONTAGOFFSET) {
+		case TagRoot:
+			// The opening root points to the entry after the closing root.
+			next := int(v & JSONVALUEMASK)
+			if next <= off+1 || next > len(tape) {
+				return dst, fmt.Errorf("corrupt input: root at offset %d ends at %d", off, next)
+			}
+			dst = append(dst, off)
+			off = next
+		case TagEnd:
+			off++
+		default:
+			return dst, fmt.Errorf("corrupt input: expected root at offset %d, got %v", off, Tag(v>>JSONTAGOFFSET))
+		}
+	}
+	return dst, nil
+}
+
+// appendRecordIndex appends the record index section payload to dst.
+// The payload is the number of records followed by
+// the offset of each record relative to the previous (varuint).
+func appendRecordIndex(dst []byte, offs []int) []byte {
+	dst = appendUvarint(dst, uint64(len(offs)))
+	prev := 0
+	for _, off := range offs {
+		dst = appendUvarint(dst, uint64(off-prev))
+		prev = off
+	}
+	return dst
+}
+
+// readRecordIndex reads a record index section for tape.
+// The offsets must point to root tags on tape.
+func readRecordIndex(payload []byte, tape []uint64) (recordIndex, error) {
+	br := bytes.NewBuffer(payload)
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return recordIndex{}, err
+	}
+	// Each record is at least 1 byte.
+	if n > uint64(br.Len()) {
+		return recordIndex{}, fmt.Errorf("invalid record count %d", n)
+	}
+	offs := make([]int, 0, n)
+	prev := uint64(0)
+	for i := uint64(0); i < n; i++ {
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return recordIndex{}, err
+		}
+		if i > 0 && delta == 0 {
+			return recordIndex{}, errors.New("record offsets not increasing")
+		}
+		off := prev + delta
+		if off < prev || off >= uint64(len(tape)) || Tag(tape[off]>>JSONTAGOFFSET) != TagRoot {
+			return recordIndex{}, fmt.Errorf("record %d at offset %d is not a root", i, off)
+		}
+		offs = append(offs, int(off))
+		prev = off
+	}
+	return newRecordIndex(offs, tape), nil
+}
@@ -0,0 +1,263 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestParsedJson_Record(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	var buf bytes.Buffer
+	const records = 100
+	for i := 0; i < records; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"name":"record %d","tags":[%d,"x"]}`+"\n", i*2, i, i)
+	}
+	recordID := func(i Iter) int64 {
+		t.Helper()
+		elem, err := i.FindElement(nil, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := elem.Iter.Int()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	check := func(t *testing.T, pj *ParsedJson) {
+		t.Helper()
+		n, err := pj.RecordCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != records {
+			t.Fatalf("want %d records, got %d", records, n)
+		}
+		for _, j := range []int{0, 1, 50, records - 1} {
+			i, err := pj.Record(j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id := recordID(i); id != int64(j*2) {
+				t.Errorf("record %d: want id %d, got %d", j, j*2, id)
+			}
+		}
+		if _, err := pj.Record(records); err == nil {
+			t.Error("want out of range error")
+		}
+		for _, id := range []int64{-1, 0, 41, 42, 1000} {
+			got, err := pj.SearchRecords(func(i Iter) (bool, error) {
+				return recordID(i) >= id, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := int((id + 1) / 2)
+			if id < 0 {
+				want = 0
+			}
+			if want > records {
+				want = records
+			}
+			if got != want {
+				t.Errorf("search %d: want %d, got %d", id, want, got)
+			}
+		}
+	}
+
+	pj, err := ParseND(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasIndex := func(pj *ParsedJson) bool {
+		_, ok := pj.meta.recordOffsets(pj.Tape)
+		return ok
+	}
+	// Without an index the roots are located on every call.
+	check(t, pj)
+	if hasIndex(pj) {
+		t.Fatal("index should only be built on request")
+	}
+	if err := pj.BuildRecordIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if !hasIndex(pj) {
+		t.Fatal("index not built")
+	}
+	check(t, pj)
+
+	// Records must match ForEach.
+	n := 0
+	err = pj.ForEach(func(i Iter) error {
+		if id := recordID(i); id != int64(n*2) {
+			t.Errorf("record %d: want id %d, got %d", n, n*2, id)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("option", func(t *testing.T) {
+		pj, err := ParseND(buf.Bytes(), nil, WithRecordIndex(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasIndex(pj) {
+			t.Fatal("index not built while parsing")
+		}
+		check(t, pj)
+
+		// Copies of the tape must not use the index.
+		cp := *pj
+		cp.Tape = append([]uint64(nil), pj.Tape...)
+		if hasIndex(&cp) {
+			t.Fatal("index used for copied tape")
+		}
+
+		// Reusing must not keep the index.
+		pj, err = Parse([]byte(`{"id":1}`), pj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasIndex(pj) {
+			t.Error("index kept when reusing")
+		}
+		if n, err := pj.RecordCount(); err != nil || n != 1 {
+			t.Errorf("want 1 record, got %d (%v)", n, err)
+		}
+		pj, err = ParseND([]byte("{\"id\":1}\n\n{\"id\":2}\n"), pj, WithRecordIndex(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := pj.RecordCount(); err != nil || n != 2 || !hasIndex(pj) {
+			t.Errorf("want 2 indexed records, got %d (%v)", n, err)
+		}
+		offs, err := appendRootOffsets(nil, pj.Tape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := pj.meta.recordOffsets(pj.Tape); fmt.Sprint(got) != fmt.Sprint(offs) {
+			t.Errorf("stage 2 index %v, want %v", got, offs)
+		}
+	})
+	t.Run("clone", func(t *testing.T) {
+		cl := pj.Clone(nil)
+		if !hasIndex(cl) {
+			t.Fatal("index not cloned")
+		}
+		check(t, cl)
+	})
+	t.Run("serialize", func(t *testing.T) {
+		s := NewSerializer()
+		pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasIndex(pj2) {
+			t.Fatal("index not serialized")
+		}
+		check(t, pj2)
+
+		// Without an index none is stored.
+		pj3, err := ParseND(buf.Bytes(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pj2, err = s.Deserialize(s.Serialize(nil, *pj3), pj2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasIndex(pj2) {
+			t.Fatal("unexpected index")
+		}
+		check(t, pj2)
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		// Reading records must not modify pj, with or without an index.
+		pj, err := ParseND(buf.Bytes(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if n, err := pj.RecordCount(); err != nil || n != records {
+					t.Errorf("want %d records, got %d (%v)", records, n, err)
+				}
+				if _, err := pj.Record(records / 2); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("builder", func(t *testing.T) {
+		var b Builder
+		for i := 0; i < records; i++ {
+			b.BeginObject()
+			b.Key("id")
+			b.Int(int64(i * 2))
+			b.EndObject()
+		}
+		pj, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, pj)
+	})
+}
+
+func TestReadRecordIndex(t *testing.T) {
+	var b Builder
+	b.Int(1)
+	b.Int(2)
+	pj, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offs, err := appendRootOffsets(nil, pj.Tape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := appendRecordIndex(nil, offs)
+	r, err := readRecordIndex(valid, pj.Tape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.offs) != 2 || !r.valid(pj.Tape) {
+		t.Fatalf("unexpected index %+v", r)
+	}
+	for _, offs := range [][]int{{1}, {0, 0}, {0, len(pj.Tape)}} {
+		r, err := readRecordIndex(appendRecordIndex(nil, offs), pj.Tape)
+		if err == nil {
+			t.Errorf("%v: want error", offs)
+		}
+		if r.valid(pj.Tape) {
+			t.Errorf("%v: index should be invalid", offs)
+		}
+	}
+}
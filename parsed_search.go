@@ -0,0 +1,239 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// SearchMode controls which strings are searched by SearchStrings.
+type SearchMode uint8
+
+const (
+	// SearchValues will search string values.
+	SearchValues SearchMode = 1 << iota
+
+	// SearchKeys will search object keys.
+	SearchKeys
+
+	// SearchIgnoreCase will match ASCII letters regardless of case.
+	SearchIgnoreCase
+
+	// SearchAll will search both keys and values.
+	SearchAll = SearchValues | SearchKeys
+)
+
+// SearchStrings will search all strings on the tape for needle and
+// call fn for each string containing it.
+// The root element, the iterator of the matching string and the path
+// of the string within the root element is returned.
+// For keys the path includes the key itself and value contains the key.
+// The path is only valid until fn returns.
+// If neither SearchValues nor SearchKeys is set, both are searched.
+// An empty needle matches all strings.
+//
+// Strings are matched on their unescaped values.
+// The string buffers are scanned for the needle first,
+// and the tape is only traversed if there are any potential matches.
+func (pj *ParsedJson) SearchStrings(needle []byte, mode SearchMode, fn func(root, value Iter, path Path)) error {
+	if mode&SearchAll == 0 {
+		mode |= SearchAll
+	}
+	fold := mode&SearchIgnoreCase != 0
+	if fold {
+		needle = asciiLower(nil, needle)
+	}
+
+	var strHits, msgHits []int
+	if len(needle) > 0 {
+		// Strings.B contains unescaped values.
+		// Strings that reference the message never contain escapes,
+		// since the parser always unescapes those into Strings.B.
+		if pj.Strings != nil {
+			strHits = findAll(pj.Strings.B, needle, fold)
+		}
+		msgHits = findAll(pj.Message, needle, fold)
+		// Inline strings are not in the buffers, but cannot be longer than maxInlineString.
+		if len(strHits) == 0 && len(msgHits) == 0 && (len(needle) > maxInlineString || !hasInlineStrings(pj.Tape)) {
+			return nil
+		}
+	}
+
+	w := tapeWalker{pj: pj}
+	var path Path
+	rootOff := -1
+	var root Iter
+	return w.walk(func(off int, tag Tag, isKey bool) error {
+		if tag != TagString && tag != TagStringInline {
+			return nil
+		}
+		if isKey && mode&SearchKeys == 0 || !isKey && mode&SearchValues == 0 {
+			return nil
+		}
+		switch {
+		case tag == TagStringInline:
+			b, err := inlineStringBytes(pj.Tape, off)
+			if err != nil {
+				return err
+			}
+			if indexFold(b, needle, fold) < 0 {
+				return nil
+			}
+		case off+1 >= len(pj.Tape):
+			return errors.New("corrupt input: no string length on tape")
+		case len(needle) > 0:
+			start := pj.Tape[off] & JSONVALUEMASK
+			end := start + pj.Tape[off+1]
+			hits := msgHits
+			if start&STRINGBUFBIT != 0 {
+				hits = strHits
+				start &= STRINGBUFMASK
+				end &= STRINGBUFMASK
+			}
+			idx := sort.SearchInts(hits, int(start))
+			if idx == len(hits) || uint64(hits[idx]+len(needle)) > end {
+				return nil
+			}
+		}
+
+		// We have a match.
+		var err error
+		if rootOff != w.root {
+			root, err = pj.rootIterAt(w.root)
+			if err != nil {
+				return err
+			}
+			rootOff = w.root
+		}
+		value, err := pj.iterAt(off)
+		if err != nil {
+			return err
+		}
+		path, err = w.path(path[:0])
+		if err != nil {
+			return err
+		}
+		fn(root, value, path)
+		return nil
+	})
+}
+
+// hasInlineStrings returns whether the tape may contain inline strings.
+// Only tags are checked, so payload entries can give false positives.
+func hasInlineStrings(tape []uint64) bool {
+	for _, v := range tape {
+		if Tag(v>>JSONTAGOFFSET) == TagStringInline {
+			return true
+		}
+	}
+	return false
+}
+
+// findAll returns the offsets of all occurrences of needle in b in increasing order.
+// If fold is set, needle must be lowercase.
+func findAll(b, needle []byte, fold bool) []int {
+	var hits []int
+	for pos := 0; len(b)-pos >= len(needle); {
+		i := indexFold(b[pos:], needle, fold)
+		if i < 0 {
+			return hits
+		}
+		hits = append(hits, pos+i)
+		pos += i + 1
+	}
+	return hits
+}
+
+// indexFold returns the index of the first occurrence of needle in b, or -1.
+// If fold is set, ASCII letters in b match regardless of case and needle must be lowercase.
+func indexFold(b, needle []byte, fold bool) int {
+	if !fold {
+		return bytes.Index(b, needle)
+	}
+	if len(needle) == 0 {
+		return 0
+	}
+	lo, up := needle[0], needle[0]
+	if lo >= 'a' && lo <= 'z' {
+		up -= 'a' - 'A'
+	}
+	// Next offsets of the first needle byte in each case, -1 if none remain.
+	nextLo, nextUp := -2, -2
+	for pos := 0; len(b)-pos >= len(needle); pos++ {
+		nextLo = nextIndexByte(b, lo, pos, nextLo)
+		if up != lo {
+			nextUp = nextIndexByte(b, up, pos, nextUp)
+		} else {
+			nextUp = nextLo
+		}
+		switch {
+		case nextLo < 0 && nextUp < 0:
+			return -1
+		case nextUp < 0 || nextLo >= 0 && nextLo < nextUp:
+			pos = nextLo
+		default:
+			pos = nextUp
+		}
+		if len(b)-pos < len(needle) {
+			return -1
+		}
+		if equalFoldLower(b[pos+1:pos+len(needle)], needle[1:]) {
+			return pos
+		}
+	}
+	return -1
+}
+
+// nextIndexByte returns the index of the first c in b at or after pos, or -1.
+// prev is the previous result, which is reused if it is -1 or still at or after pos.
+func nextIndexByte(b []byte, c byte, pos, prev int) int {
+	if prev == -1 || prev >= pos {
+		return prev
+	}
+	i := bytes.IndexByte(b[pos:], c)
+	if i < 0 {
+		return -1
+	}
+	return pos + i
+}
+
+// equalFoldLower returns whether b is equal to lower with ASCII letters compared regardless of case.
+// lower must be lowercase and have the same length as b.
+func equalFoldLower(b, lower []byte) bool {
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != lower[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiLower appends b with ASCII letters converted to lower case to dst.
+func asciiLower(dst, b []byte) []byte {
+	for _, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
@@ -0,0 +1,237 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Path
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "a", want: Path{PathKey("a")}},
+		{in: "a.b", want: Path{PathKey("a"), PathKey("b")}},
+		{in: "a[2].b", want: Path{PathKey("a"), PathIndex(2), PathKey("b")}},
+		{in: "[0][1]", want: Path{PathIndex(0), PathIndex(1)}},
+		{in: `a["b.c"]`, want: Path{PathKey("a"), PathKey("b.c")}},
+		{in: `["a\"]"].b`, want: Path{PathKey(`a"]`), PathKey("b")}},
+		{in: `[""]`, want: Path{PathKey("")}},
+		{in: ".a", wantErr: true},
+		{in: "a..b", wantErr: true},
+		{in: "a[", wantErr: true},
+		{in: "a[-1]", wantErr: true},
+		{in: `a["b]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePath(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("ParsePath() got = %v, want %v", got, tt.want)
+			}
+			// Must round trip
+			again, err := ParsePath(got.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !again.Equal(got) {
+				t.Fatalf("round trip of %q got = %v, want %v", got.String(), again, got)
+			}
+		})
+	}
+}
+
+func TestParsedJson_SearchStrings(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	input := `{"ip":"10.0.0.1","user":{"name":"Alice","ids":[1,"x-10.0.0.1-y"]}}
+{"ip":"192.168.0.1","note":"esc\"aped 10.0.0.1"}
+{"10.0.0.1":true,"list":[{"v":"10.0.0"}]}`
+
+	type hit struct {
+		path  string
+		value string
+		root  string
+	}
+	search := func(t *testing.T, pj *ParsedJson, needle string, mode SearchMode) []hit {
+		var hits []hit
+		err := pj.SearchStrings([]byte(needle), mode, func(root, value Iter, path Path) {
+			v, err := value.String()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := root.FindElement(nil, "ip")
+			rs := ""
+			if err == nil {
+				rs, _ = r.Iter.String()
+			}
+			hits = append(hits, hit{path: path.String(), value: v, root: rs})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hits
+	}
+
+	for _, copyStrings := range []bool{true, false} {
+		t.Run(fmt.Sprint("copy-", copyStrings), func(t *testing.T) {
+			pj, err := ParseND([]byte(input), nil, WithCopyStrings(copyStrings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := search(t, pj, "10.0.0.1", 0)
+			want := []hit{
+				{path: "ip", value: "10.0.0.1", root: "10.0.0.1"},
+				{path: "user.ids[1]", value: "x-10.0.0.1-y", root: "10.0.0.1"},
+				{path: "note", value: `esc"aped 10.0.0.1`, root: "192.168.0.1"},
+				{path: `["10.0.0.1"]`, value: "10.0.0.1"},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+
+			got = search(t, pj, "10.0.0.1", SearchKeys)
+			if len(got) != 1 || got[0].value != "10.0.0.1" {
+				t.Errorf("keys only: got %+v", got)
+			}
+			got = search(t, pj, "10.0.0.1", SearchValues)
+			if len(got) != 3 {
+				t.Errorf("values only: got %+v", got)
+			}
+			got = search(t, pj, "ALICE", SearchValues)
+			if len(got) != 0 {
+				t.Errorf("case sensitive: got %+v", got)
+			}
+			got = search(t, pj, "ALICE", SearchValues|SearchIgnoreCase)
+			if len(got) != 1 || got[0].path != "user.name" {
+				t.Errorf("ignore case: got %+v", got)
+			}
+			got = search(t, pj, "ip", SearchKeys)
+			if len(got) != 2 {
+				t.Errorf("keys: got %+v", got)
+			}
+			got = search(t, pj, `"ip"`, 0)
+			if len(got) != 0 {
+				t.Errorf("quotes should not match: got %+v", got)
+			}
+			got = search(t, pj, "", SearchValues)
+			if len(got) != 6 {
+				t.Errorf("empty needle: got %d values", len(got))
+			}
+		})
+	}
+
+	// Escaped strings must match on their unescaped values.
+	escaped := `{"a":"\u0041bc","b":"x\"y","c":"\\u0041","d":"no match here"}`
+	for _, copyStrings := range []bool{true, false} {
+		for _, compact := range []bool{false, true} {
+			t.Run(fmt.Sprint("escaped-copy-", copyStrings, "-compact-", compact), func(t *testing.T) {
+				pj, err := Parse([]byte(escaped), nil, WithCopyStrings(copyStrings), WithCompactTape(compact))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, tc := range []struct {
+					needle string
+					mode   SearchMode
+					want   []string
+				}{
+					{needle: "Abc", mode: SearchValues, want: []string{"a"}},
+					{needle: "aBC", mode: SearchValues | SearchIgnoreCase, want: []string{"a"}},
+					{needle: `x"y`, mode: SearchValues, want: []string{"b"}},
+					{needle: `\u0041`, mode: SearchValues, want: []string{"c"}},
+					{needle: `u0041`, mode: SearchValues, want: []string{"c"}},
+					{needle: `"`, mode: SearchValues, want: []string{"b"}},
+					{needle: `\`, mode: SearchValues, want: []string{"c"}},
+					{needle: "NO MATCH", mode: SearchValues | SearchIgnoreCase, want: []string{"d"}},
+					{needle: "nomatch", mode: SearchAll | SearchIgnoreCase},
+				} {
+					var got []string
+					err := pj.SearchStrings([]byte(tc.needle), tc.mode, func(root, value Iter, path Path) {
+						got = append(got, path.String())
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(got, tc.want) {
+						t.Errorf("%q: got %v, want %v", tc.needle, got, tc.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestIndexFold(t *testing.T) {
+	for _, tc := range []struct {
+		b, needle string
+		want      int
+	}{
+		{b: "", needle: "", want: 0},
+		{b: "abc", needle: "", want: 0},
+		{b: "", needle: "a", want: -1},
+		{b: "xxABC", needle: "abc", want: 2},
+		{b: "aBaBAbc", needle: "abc", want: 4},
+		{b: "AAAAAb", needle: "ab", want: 4},
+		{b: "aaaaaB", needle: "ab", want: 4},
+		{b: "AAAAA", needle: "ab", want: -1},
+		{b: "x1-A", needle: "1-a", want: 1},
+		{b: "[\\]", needle: "{|}", want: -1},
+		{b: "ab", needle: "abc", want: -1},
+	} {
+		if got := indexFold([]byte(tc.b), []byte(tc.needle), true); got != tc.want {
+			t.Errorf("indexFold(%q, %q) = %d, want %d", tc.b, tc.needle, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkParsedJson_SearchStrings(b *testing.B) {
+	if !SupportedCPU() {
+		b.SkipNow()
+	}
+	msg := loadCompressed(b, "twitter")
+	pj, err := Parse(msg, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(msg)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		err := pj.SearchStrings([]byte("HTTP"), SearchValues|SearchIgnoreCase, func(root, value Iter, path Path) {
+			n++
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n == 0 {
+			b.Fatal("no matches")
+		}
+	}
+}
@@ -36,7 +36,7 @@ const (
 	stringBits        = 14
 	stringSize        = 1 << stringBits
 	stringmask        = stringSize - 1
-	serializedVersion = 2
+	serializedVersion = 3
 )
 
 // Serializer allows to serialize parsed json and read it back.
@@ -62,6 +62,18 @@ type Serializer struct {
 	stringBuf    []byte
 
 	maxBlockSize uint64
+
+	// Optional sections
+	sectionsBuf  []byte
+	summaryPaths [][]string
+	summaries    []summaryBuilder
+
+	// Parallel operation
+	parallel    int
+	segmentSize int
+	segStarts   []int
+	segs        []tapeSegment
+	segEncoders []*Serializer
 }
 
 // NewSerializer will create and initialize a Serializer.
@@ -70,6 +82,7 @@ func NewSerializer() *Serializer {
 	var s Serializer
 	s.CompressMode(CompressDefault)
 	s.maxBlockSize = 1 << 31
+	s.segmentSize = defaultSegmentSize
 	return &s
 }
 
@@ -209,6 +222,10 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 	// Serialized format:
 	// - Header: Version (byte)
 	// - Compressed size of remaining data (varuint). Excludes previous and size of this.
+	// - Optional sections (v3): Count (varuint), followed by each section:
+	//     - Section type (byte). 1: Block summary. 2: Tape segments. 3: Record index.
+	//     - Section size (varuint)
+	//     - Section data.
 	// - Tape size, uncompressed (varuint)
 	// - Strings size, uncompressed (varuint)
 	// - Strings Block: Compressed block. See above.
@@ -233,27 +250,160 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 	// If there are any values left as tag or value, it is considered invalid.
 
 	var wg sync.WaitGroup
+	var rawTags, rawValues, msgSize int
+	var segments []byte
+	if s.parallel > 1 && len(pj.Tape) >= 2*s.segmentSize {
+		rawTags, rawValues, msgSize, segments = s.encodeSegments(&pj)
+	} else {
+		// Reset lookup table.
+		// Offsets are offset by 1, so 0 indicates an unfilled entry.
+		for i := range s.stringsTable[:] {
+			s.stringsTable[i] = 0
+		}
+		if len(s.stringBuf) > 0 {
+			s.stringBuf = s.stringBuf[:0]
+		}
+		if len(s.sMsg) > 0 {
+			s.sMsg = s.sMsg[:0]
+		}
+
+		msgWr, msgDone := encBlock(s.compStrings, s.sMsg, s.fasterComp)
+		s.stringWr = msgWr
+		valWr, valDone := encBlock(s.compValues, s.valuesCompBuf, s.fasterComp)
+		tagWr, tagDone := encBlock(s.compTags, s.tagsCompBuf, s.fasterComp)
+		rawTags, rawValues = s.encodeTape(&pj, 0, len(pj.Tape), tagWr, valWr)
+		msgSize = len(s.stringBuf)
 
-	// Reset lookup table.
-	// Offsets are offset by 1, so 0 indicates an unfilled entry.
-	for i := range s.stringsTable[:] {
-		s.stringsTable[i] = 0
+		wg.Add(3)
+		go func() {
+			var err error
+			s.tagsCompBuf, err = tagDone()
+			if err != nil {
+				panic(err)
+			}
+			wg.Done()
+		}()
+		go func() {
+			var err error
+			s.valuesCompBuf, err = valDone()
+			if err != nil {
+				panic(err)
+			}
+			wg.Done()
+		}()
+		go func() {
+			var err error
+			s.sMsg, err = msgDone()
+			if err != nil {
+				panic(err)
+			}
+			wg.Done()
+		}()
+	}
+
+	// Build optional sections while compressors finish.
+	nSections := 0
+	if len(s.summaryPaths) > 0 {
+		nSections++
 	}
-	if len(s.stringBuf) > 0 {
-		s.stringBuf = s.stringBuf[:0]
+	if segments != nil {
+		nSections++
 	}
-	if len(s.sMsg) > 0 {
-		s.sMsg = s.sMsg[:0]
+	recordOffs, records := pj.meta.recordOffsets(pj.Tape)
+	if records {
+		nSections++
 	}
+	sections := appendUvarint(s.sectionsBuf[:0], uint64(nSections))
+	if len(s.summaryPaths) > 0 {
+		sum, err := s.appendSummary(nil, &pj)
+		if err != nil {
+			wg.Wait()
+			panic(err)
+		}
+		sections = append(sections, sectionSummary)
+		sections = appendUvarint(sections, uint64(len(sum)))
+		sections = append(sections, sum...)
+	}
+	if segments != nil {
+		sections = append(sections, sectionSegments)
+		sections = appendUvarint(sections, uint64(len(segments)))
+		sections = append(sections, segments...)
+	}
+	if records {
+		idx := appendRecordIndex(nil, recordOffs)
+		sections = append(sections, sectionRecords)
+		sections = appendUvarint(sections, uint64(len(idx)))
+		sections = append(sections, idx...)
+	}
+	s.sectionsBuf = sections
+
+	// Wait for compressors
+	wg.Wait()
+
+	// Version
+	dst = append(dst, serializedVersion)
+	var tmp [8]byte
 
-	msgWr, msgDone := encBlock(s.compStrings, s.sMsg, s.fasterComp)
-	s.stringWr = msgWr
+	// Size of varints...
+	varInts := binary.PutUvarint(tmp[:], uint64(0)) +
+		binary.PutUvarint(tmp[:], uint64(len(s.sMsg))) +
+		binary.PutUvarint(tmp[:], uint64(rawTags)) +
+		binary.PutUvarint(tmp[:], uint64(len(s.tagsCompBuf))) +
+		binary.PutUvarint(tmp[:], uint64(rawValues)) +
+		binary.PutUvarint(tmp[:], uint64(len(s.valuesCompBuf))) +
+		binary.PutUvarint(tmp[:], uint64(msgSize)) +
+		binary.PutUvarint(tmp[:], uint64(len(pj.Tape)))
+
+	n := binary.PutUvarint(tmp[:], uint64(1+len(sections)+len(s.sMsg)+len(s.tagsCompBuf)+len(s.valuesCompBuf)+varInts))
+	dst = append(dst, tmp[:n]...)
+
+	// Optional sections
+	dst = append(dst, sections...)
 
+	// Tape elements, uncompressed.
+	n = binary.PutUvarint(tmp[:], uint64(len(pj.Tape)))
+	dst = append(dst, tmp[:n]...)
+
+	// Strings uncompressed size
+	dst = append(dst, 0)
+	// Strings
+	dst = append(dst, 0)
+
+	// Messages uncompressed size
+	n = binary.PutUvarint(tmp[:], uint64(msgSize))
+	dst = append(dst, tmp[:n]...)
+	// Message
+	n = binary.PutUvarint(tmp[:], uint64(len(s.sMsg)))
+	dst = append(dst, tmp[:n]...)
+	dst = append(dst, s.sMsg...)
+
+	// Tags
+	n = binary.PutUvarint(tmp[:], uint64(rawTags))
+	dst = append(dst, tmp[:n]...)
+	n = binary.PutUvarint(tmp[:], uint64(len(s.tagsCompBuf)))
+	dst = append(dst, tmp[:n]...)
+	dst = append(dst, s.tagsCompBuf...)
+
+	// Values
+	n = binary.PutUvarint(tmp[:], uint64(rawValues))
+	dst = append(dst, tmp[:n]...)
+	n = binary.PutUvarint(tmp[:], uint64(len(s.valuesCompBuf)))
+	dst = append(dst, tmp[:n]...)
+	dst = append(dst, s.valuesCompBuf...)
+	if false {
+		fmt.Println("strings:", len(pj.Strings.B)+len(pj.Message), "->", len(s.sMsg), "tags:", rawTags, "->", len(s.tagsCompBuf), "values:", rawValues, "->", len(s.valuesCompBuf), "Total:", len(pj.Message)+len(pj.Strings.B)+len(pj.Tape)*8, "->", len(dst))
+	}
+
+	return dst
+}
+
+// encodeTape will write the tags and values of pj.Tape[start:end] to tagWr and valWr.
+// Strings are added with indexString.
+// The number of tag and value bytes written is returned.
+func (s *Serializer) encodeTape(pj *ParsedJson, start, end int, tagWr, valWr io.Writer) (rawTags, rawValues int) {
 	const tagBufSize = 64 << 10
 	const valBufSize = 64 << 10
 
-	valWr, valDone := encBlock(s.compValues, s.valuesCompBuf, s.fasterComp)
-	tagWr, tagDone := encBlock(s.compTags, s.tagsCompBuf, s.fasterComp)
 	// Pessimistically allocate for maximum possible size.
 	if cap(s.tagsBuf) <= tagBufSize {
 		s.tagsBuf = make([]byte, tagBufSize)
@@ -266,12 +416,10 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 	}
 
 	s.valuesBuf = s.valuesBuf[:0]
-	off := 0
+	off := start
 	tagsOff := 0
 	var tmp [8]byte
-	rawValues := 0
-	rawTags := 0
-	for off < len(pj.Tape) {
+	for off < end {
 		if tagsOff >= tagBufSize {
 			rawTags += tagsOff
 			tagWr.Write(s.tagsBuf[:tagsOff])
@@ -320,6 +468,10 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 				s.valuesBuf = append(s.valuesBuf, tmp[:]...)
 				off++
 			}
+		case TagStringInline, TagIntegerInline:
+			// Value is stored in the entry.
+			binary.LittleEndian.PutUint64(tmp[:], payload)
+			s.valuesBuf = append(s.valuesBuf, tmp[:]...)
 		case TagNull, TagBoolTrue, TagBoolFalse:
 			// No value.
 		case TagObjectStart, TagArrayStart, TagRoot:
@@ -330,7 +482,6 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 		case TagObjectEnd, TagArrayEnd, TagEnd:
 			// Value can be deducted from start tag or no value.
 		default:
-			wg.Wait()
 			panic(fmt.Errorf("unknown tag: %d", int(ntype)))
 		}
 		s.tagsBuf[tagsOff] = uint8(ntype)
@@ -345,86 +496,7 @@ func (s *Serializer) Serialize(dst []byte, pj ParsedJson) []byte {
 		rawValues += len(s.valuesBuf)
 		valWr.Write(s.valuesBuf)
 	}
-	wg.Add(3)
-	go func() {
-		var err error
-		s.tagsCompBuf, err = tagDone()
-		if err != nil {
-			panic(err)
-		}
-		wg.Done()
-	}()
-	go func() {
-		var err error
-		s.valuesCompBuf, err = valDone()
-		if err != nil {
-			panic(err)
-		}
-		wg.Done()
-	}()
-	go func() {
-		var err error
-		s.sMsg, err = msgDone()
-		if err != nil {
-			panic(err)
-		}
-		wg.Done()
-	}()
-
-	// Wait for compressors
-	wg.Wait()
-
-	// Version
-	dst = append(dst, serializedVersion)
-
-	// Size of varints...
-	varInts := binary.PutUvarint(tmp[:], uint64(0)) +
-		binary.PutUvarint(tmp[:], uint64(len(s.sMsg))) +
-		binary.PutUvarint(tmp[:], uint64(rawTags)) +
-		binary.PutUvarint(tmp[:], uint64(len(s.tagsCompBuf))) +
-		binary.PutUvarint(tmp[:], uint64(rawValues)) +
-		binary.PutUvarint(tmp[:], uint64(len(s.valuesCompBuf))) +
-		binary.PutUvarint(tmp[:], uint64(len(s.stringBuf))) +
-		binary.PutUvarint(tmp[:], uint64(len(pj.Tape)))
-
-	n := binary.PutUvarint(tmp[:], uint64(1+len(s.sMsg)+len(s.tagsCompBuf)+len(s.valuesCompBuf)+varInts))
-	dst = append(dst, tmp[:n]...)
-
-	// Tape elements, uncompressed.
-	n = binary.PutUvarint(tmp[:], uint64(len(pj.Tape)))
-	dst = append(dst, tmp[:n]...)
-
-	// Strings uncompressed size
-	dst = append(dst, 0)
-	// Strings
-	dst = append(dst, 0)
-
-	// Messages uncompressed size
-	n = binary.PutUvarint(tmp[:], uint64(len(s.stringBuf)))
-	dst = append(dst, tmp[:n]...)
-	// Message
-	n = binary.PutUvarint(tmp[:], uint64(len(s.sMsg)))
-	dst = append(dst, tmp[:n]...)
-	dst = append(dst, s.sMsg...)
-
-	// Tags
-	n = binary.PutUvarint(tmp[:], uint64(rawTags))
-	dst = append(dst, tmp[:n]...)
-	n = binary.PutUvarint(tmp[:], uint64(len(s.tagsCompBuf)))
-	dst = append(dst, tmp[:n]...)
-	dst = append(dst, s.tagsCompBuf...)
-
-	// Values
-	n = binary.PutUvarint(tmp[:], uint64(rawValues))
-	dst = append(dst, tmp[:n]...)
-	n = binary.PutUvarint(tmp[:], uint64(len(s.valuesCompBuf)))
-	dst = append(dst, tmp[:n]...)
-	dst = append(dst, s.valuesCompBuf...)
-	if false {
-		fmt.Println("strings:", len(pj.Strings.B)+len(pj.Message), "->", len(s.sMsg), "tags:", rawTags, "->", len(s.tagsCompBuf), "values:", rawValues, "->", len(s.valuesCompBuf), "Total:", len(pj.Message)+len(pj.Strings.B)+len(pj.Tape)*8, "->", len(dst))
-	}
-
-	return dst
+	return rawTags, rawValues
 }
 
 func (s *Serializer) splitBlocks(r io.Reader, out chan []byte) error {
@@ -433,7 +505,7 @@ func (s *Serializer) splitBlocks(r io.Reader, out chan []byte) error {
 	for {
 		if v, err := br.ReadByte(); err != nil {
 			return err
-		} else if v != 1 {
+		} else if v > serializedVersion {
 			return errors.New("unknown version")
 		}
 
@@ -463,10 +535,11 @@ func (s *Serializer) splitBlocks(r io.Reader, out chan []byte) error {
 func (s *Serializer) Deserialize(src []byte, dst *ParsedJson) (*ParsedJson, error) {
 	br := bytes.NewBuffer(src)
 
-	if v, err := br.ReadByte(); err != nil {
+	v, err := br.ReadByte()
+	if err != nil {
 		return dst, err
 	} else if v > serializedVersion {
-		// v2 reads v1.
+		// v3 reads v1 and v2.
 		return dst, errors.New("unknown version")
 	}
 
@@ -486,6 +559,23 @@ func (s *Serializer) Deserialize(src []byte, dst *ParsedJson) (*ParsedJson, erro
 		}
 	}
 
+	// Optional sections, only segments and the record index are needed.
+	var segments, records []byte
+	if v >= 3 {
+		err := readSections(br, func(typ byte, payload []byte) error {
+			switch typ {
+			case sectionSegments:
+				segments = payload
+			case sectionRecords:
+				records = payload
+			}
+			return nil
+		})
+		if err != nil {
+			return dst, fmt.Errorf("reading sections: %w", err)
+		}
+	}
+
 	// Tape size
 	if ts, err := binary.ReadUvarint(br); err != nil {
 		return dst, err
@@ -509,7 +599,7 @@ func (s *Serializer) Deserialize(src []byte, dst *ParsedJson) (*ParsedJson, erro
 	// Decompress strings
 	var sWG sync.WaitGroup
 	var stringsErr, msgErr error
-	err := s.decBlock(br, dst.Strings.B, &sWG, &stringsErr)
+	err = s.decBlock(br, dst.Strings.B, &sWG, &stringsErr)
 	if err != nil {
 		return dst, err
 	}
@@ -575,11 +665,43 @@ func (s *Serializer) Deserialize(src []byte, dst *ParsedJson) (*ParsedJson, erro
 	}
 
 	// Reconstruct tape:
-	var off int
-	values := s.valuesBuf
-	for _, t := range s.tagsBuf {
-		if off == len(dst.Tape) {
-			return dst, errors.New("tags extended beyond tape")
+	if segments != nil {
+		err = s.decodeSegments(dst.Tape, segments)
+	} else {
+		err = decodeTape(dst.Tape, 0, len(dst.Tape), s.tagsBuf, s.valuesBuf, nil)
+	}
+	sWG.Wait()
+	if err != nil {
+		return dst, err
+	}
+	if stringsErr != nil {
+		return dst, fmt.Errorf("reading strings: %w", stringsErr)
+	}
+	if dst.meta != nil {
+		// Drop the index of the previous tape.
+		dst.updateMeta(func(m *tapeMeta) { m.records = recordIndex{} })
+	}
+	if records != nil {
+		idx, err := readRecordIndex(records, dst.Tape)
+		if err != nil {
+			return dst, fmt.Errorf("reading record index: %w", err)
+		}
+		dst.updateMeta(func(m *tapeMeta) { m.records = idx })
+	}
+	return dst, nil
+}
+
+// decodeTape will reconstruct tape[start:end] from tags and values.
+// Containers closing beyond end are added to seg.fixups and containers
+// closing in the segment, but opened before start, are added to seg.checks.
+// seg may be nil if the entire tape is decoded.
+func decodeTape(tape []uint64, start, end int, tags, values []byte, seg *tapeSegment) error {
+	off := start
+	// Containers opened in this segment and not yet closed.
+	depth := 0
+	for _, t := range tags {
+		if off == end {
+			return errors.New("tags extended beyond tape")
 		}
 		tag := Tag(t)
 
@@ -587,88 +709,119 @@ func (s *Serializer) Deserialize(src []byte, dst *ParsedJson) (*ParsedJson, erro
 		switch tag {
 		case TagString:
 			if len(values) < 16 {
-				return dst, fmt.Errorf("reading %v: no values left", tag)
+				return fmt.Errorf("reading %v: no values left", tag)
+			}
+			if off+2 > end {
+				return fmt.Errorf("reading %v: value extends beyond tape", tag)
 			}
 			sOffset := binary.LittleEndian.Uint64(values[:8])
 			sLen := binary.LittleEndian.Uint64(values[8:16])
 			values = values[16:]
 
-			dst.Tape[off] = tagDst | sOffset
-			dst.Tape[off+1] = sLen
+			tape[off] = tagDst | sOffset
+			tape[off+1] = sLen
 			off += 2
 		case TagFloat, TagInteger, TagUint:
 			if len(values) < 8 {
-				return dst, fmt.Errorf("reading %v: no values left", tag)
+				return fmt.Errorf("reading %v: no values left", tag)
 			}
-			dst.Tape[off] = tagDst
-			dst.Tape[off+1] = binary.LittleEndian.Uint64(values[:8])
+			if off+2 > end {
+				return fmt.Errorf("reading %v: value extends beyond tape", tag)
+			}
+			tape[off] = tagDst
+			tape[off+1] = binary.LittleEndian.Uint64(values[:8])
 			values = values[8:]
 			off += 2
 		case tagFloatWithFlag:
 			// Tape contains full value
 			if len(values) < 16 {
-				return dst, fmt.Errorf("reading %v: no values left", tag)
+				return fmt.Errorf("reading %v: no values left", tag)
+			}
+			if off+2 > end {
+				return fmt.Errorf("reading %v: value extends beyond tape", tag)
 			}
-			dst.Tape[off] = binary.LittleEndian.Uint64(values[:8])
-			dst.Tape[off+1] = binary.LittleEndian.Uint64(values[8:16])
+			tape[off] = binary.LittleEndian.Uint64(values[:8])
+			tape[off+1] = binary.LittleEndian.Uint64(values[8:16])
 			values = values[16:]
 			off += 2
+		case TagStringInline, TagIntegerInline:
+			if len(values) < 8 {
+				return fmt.Errorf("reading %v: no values left", tag)
+			}
+			tape[off] = tagDst | binary.LittleEndian.Uint64(values[:8])&JSONVALUEMASK
+			values = values[8:]
+			off++
 		case TagNull, TagBoolTrue, TagBoolFalse, TagEnd:
-			dst.Tape[off] = tagDst
+			tape[off] = tagDst
 			off++
 		case TagObjectStart, TagArrayStart:
 			if len(values) < 8 {
-				return dst, fmt.Errorf("reading %v: no values left", tag)
+				return fmt.Errorf("reading %v: no values left", tag)
 			}
 			// Always forward
 			val := binary.LittleEndian.Uint64(values[:8])
 			values = values[8:]
 			val += uint64(off)
-			if val > uint64(len(dst.Tape)) {
-				return dst, fmt.Errorf("%v extends beyond tape (%d). offset:%d", tag, len(dst.Tape), val)
+			if val > uint64(len(tape)) {
+				return fmt.Errorf("%v extends beyond tape (%d). offset:%d", tag, len(tape), val)
+			}
+			if val <= uint64(off)+1 {
+				return fmt.Errorf("%v ends before it starts. offset:%d", tag, val)
 			}
 
-			dst.Tape[off] = tagDst | val
+			tape[off] = tagDst | val
 			// Write closing...
-			dst.Tape[val-1] = uint64(tagOpenToClose[tag])<<56 | uint64(off)
+			closing := uint64(tagOpenToClose[tag])<<56 | uint64(off)
+			if val <= uint64(end) {
+				tape[val-1] = closing
+				depth++
+			} else {
+				// Written when all segments are done.
+				seg.fixups = append(seg.fixups, tapeFixup{off: int(val - 1), v: closing})
+			}
 
 			off++
 		case TagRoot:
 			if len(values) < 8 {
-				return dst, fmt.Errorf("reading %v: no values left", tag)
+				return fmt.Errorf("reading %v: no values left", tag)
 			}
 			// Always forward
 			val := binary.LittleEndian.Uint64(values[:8])
 			values = values[8:]
 			val += uint64(off)
-			if val > uint64(len(dst.Tape)) {
-				return dst, fmt.Errorf("%v extends beyond tape (%d). offset:%d", tag, len(dst.Tape), val)
+			if val > uint64(len(tape)) {
+				return fmt.Errorf("%v extends beyond tape (%d). offset:%d", tag, len(tape), val)
 			}
 
-			dst.Tape[off] = tagDst | val
+			tape[off] = tagDst | val
 
 			off++
 		case TagObjectEnd, TagArrayEnd:
+			if depth == 0 && start > 0 {
+				// Opened in a previous segment, check when all segments are done.
+				seg.checks = append(seg.checks, tapeFixup{off: off, v: tagDst})
+				off++
+				continue
+			}
+			if depth > 0 {
+				depth--
+			}
 			// This should already have been written.
-			if dst.Tape[off]&JSONTAGMASK != tagDst {
-				return dst, fmt.Errorf("reading %v, offset:%d, start tag did not match %x != %x", tag, off, dst.Tape[off]>>56, uint8(tag))
+			if tape[off]&JSONTAGMASK != tagDst {
+				return fmt.Errorf("reading %v, offset:%d, start tag did not match %x != %x", tag, off, tape[off]>>56, uint8(tag))
 			}
 			off++
 		default:
-			return nil, fmt.Errorf("unknown tag: %v", tag)
+			return fmt.Errorf("unknown tag: %v", tag)
 		}
 	}
-	sWG.Wait()
-	if off != len(dst.Tape) {
-		return dst, fmt.Errorf("tags did not fill tape, want %d, got %d", len(dst.Tape), off)
+	if off != end {
+		return fmt.Errorf("tags did not fill tape, want %d, got %d", end, off)
 	}
 	if len(values) > 0 {
-		return dst, fmt.Errorf("values did not fill tape, want %d, got %d", len(dst.Tape), off)
-	}
-	if stringsErr != nil {
-		return dst, fmt.Errorf("reading strings: %w", stringsErr)
+		return fmt.Errorf("values did not fill tape, want %d, got %d", end, off)
 	}
-	return dst, nil
+	return nil
 }
 
 func (s *Serializer) decBlock(br *bytes.Buffer, dst []byte, wg *sync.WaitGroup, dstErr *error) error {
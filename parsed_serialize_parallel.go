@@ -0,0 +1,300 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// defaultSegmentSize is the minimum number of tape entries in a segment.
+const defaultSegmentSize = 1 << 20
+
+// tapeSegment is a part of a tape that is encoded and decoded independently.
+type tapeSegment struct {
+	// Offset of the first tape entry, tag and value byte.
+	tapeOff, tagsOff, valuesOff int
+
+	// Number of tape entries, tag and value bytes.
+	tape, tags, values int
+
+	// Encoded tags, values and strings.
+	tagsBuf, valuesBuf bytes.Buffer
+	strings            []byte
+
+	// Closing tags to write and verify when all segments are decoded.
+	fixups, checks []tapeFixup
+	err            error
+}
+
+// tapeFixup is a tape entry that is outside the segment being decoded.
+type tapeFixup struct {
+	off int
+	v   uint64
+}
+
+// Parallel sets the number of goroutines used to serialize and deserialize a single tape.
+// With n > 1, tapes with at least 2M entries are split into segments at
+// root and container boundaries, which are encoded concurrently.
+// The segment offsets are stored in the serialized block,
+// so Deserialize can reconstruct the segments concurrently.
+// Blocks with segments can be deserialized by any Serializer,
+// but only with n > 1 will the segments be decoded concurrently.
+// Strings are only deduplicated within each segment.
+// n <= 1 disables parallel operation, which is the default.
+func (s *Serializer) Parallel(n int) {
+	s.parallel = n
+}
+
+// encodeSegments will split pj into segments and encode them concurrently.
+// When done the compressed tags, values and strings are stored in s.
+// The payload of the segments section is returned.
+func (s *Serializer) encodeSegments(pj *ParsedJson) (rawTags, rawValues, msgSize int, section []byte) {
+	s.segStarts = splitTape(s.segStarts[:0], pj.Tape, s.segmentSize)
+	segs := s.resizeSegments(len(s.segStarts))
+	workers := s.parallel
+	if workers > len(segs) {
+		workers = len(segs)
+	}
+	for len(s.segEncoders) < workers {
+		s.segEncoders = append(s.segEncoders, &Serializer{stringWr: ioutil.Discard})
+	}
+	parallelDo(len(segs), workers, func(worker, i int) {
+		enc := s.segEncoders[worker]
+		seg := &segs[i]
+		seg.tapeOff = s.segStarts[i]
+		end := len(pj.Tape)
+		if i+1 < len(segs) {
+			end = s.segStarts[i+1]
+		}
+		seg.tape = end - seg.tapeOff
+		enc.stringsTable = [stringSize]uint32{}
+		enc.stringBuf = seg.strings[:0]
+		seg.tagsBuf.Reset()
+		seg.valuesBuf.Reset()
+		seg.tags, seg.values = enc.encodeTape(pj, seg.tapeOff, end, &seg.tagsBuf, &seg.valuesBuf)
+		seg.strings = enc.stringBuf
+		enc.stringBuf = nil
+	})
+
+	// String offsets are relative to each segment, add the size of previous segments.
+	bases := make([]uint64, len(segs))
+	for i := range segs {
+		bases[i] = uint64(msgSize)
+		msgSize += len(segs[i].strings)
+		rawTags += segs[i].tags
+		rawValues += segs[i].values
+	}
+	parallelDo(len(segs), workers, func(_, i int) {
+		if bases[i] > 0 {
+			patchStrings(segs[i].tagsBuf.Bytes(), segs[i].valuesBuf.Bytes(), bases[i])
+		}
+	})
+
+	var wg sync.WaitGroup
+	compress := func(mode byte, dst *[]byte, get func(seg *tapeSegment) []byte) {
+		defer wg.Done()
+		wr, done := encBlock(mode, *dst, s.fasterComp)
+		for i := range segs {
+			wr.Write(get(&segs[i]))
+		}
+		var err error
+		*dst, err = done()
+		if err != nil {
+			panic(err)
+		}
+	}
+	wg.Add(3)
+	go compress(s.compTags, &s.tagsCompBuf, func(seg *tapeSegment) []byte { return seg.tagsBuf.Bytes() })
+	go compress(s.compValues, &s.valuesCompBuf, func(seg *tapeSegment) []byte { return seg.valuesBuf.Bytes() })
+	go compress(s.compStrings, &s.sMsg, func(seg *tapeSegment) []byte { return seg.strings })
+	wg.Wait()
+
+	// Segments section:
+	// - Number of segments (varuint)
+	// - For each segment: Tape entries, tags and values size (varuint).
+	section = appendUvarint(nil, uint64(len(segs)))
+	for i := range segs {
+		section = appendUvarint(section, uint64(segs[i].tape))
+		section = appendUvarint(section, uint64(segs[i].tags))
+		section = appendUvarint(section, uint64(segs[i].values))
+	}
+	return rawTags, rawValues, msgSize, section
+}
+
+// decodeSegments will reconstruct the tape from s.tagsBuf and s.valuesBuf
+// using the segments section.
+func (s *Serializer) decodeSegments(tape []uint64, section []byte) error {
+	br := bytes.NewBuffer(section)
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("reading segments: %w", err)
+	}
+	// Each segment is at least 3 bytes.
+	if n == 0 || n > uint64(br.Len()/3) {
+		return fmt.Errorf("invalid segment count %d", n)
+	}
+	segs := s.resizeSegments(int(n))
+	var tapeOff, tagsOff, valuesOff uint64
+	for i := range segs {
+		var v [3]uint64
+		for j := range v {
+			if v[j], err = binary.ReadUvarint(br); err != nil {
+				return fmt.Errorf("reading segments: %w", err)
+			}
+		}
+		seg := &segs[i]
+		seg.tapeOff, seg.tagsOff, seg.valuesOff = int(tapeOff), int(tagsOff), int(valuesOff)
+		tapeOff += v[0]
+		tagsOff += v[1]
+		valuesOff += v[2]
+		if tapeOff > uint64(len(tape)) || tagsOff > uint64(len(s.tagsBuf)) || valuesOff > uint64(len(s.valuesBuf)) {
+			return errors.New("segments extend beyond tape")
+		}
+		seg.tape, seg.tags, seg.values = int(v[0]), int(v[1]), int(v[2])
+	}
+	if tapeOff != uint64(len(tape)) || tagsOff != uint64(len(s.tagsBuf)) || valuesOff != uint64(len(s.valuesBuf)) {
+		return errors.New("segments did not fill tape")
+	}
+
+	workers := s.parallel
+	if workers < 1 {
+		workers = 1
+	}
+	parallelDo(len(segs), workers, func(_, i int) {
+		seg := &segs[i]
+		seg.fixups = seg.fixups[:0]
+		seg.checks = seg.checks[:0]
+		seg.err = decodeTape(tape, seg.tapeOff, seg.tapeOff+seg.tape,
+			s.tagsBuf[seg.tagsOff:seg.tagsOff+seg.tags],
+			s.valuesBuf[seg.valuesOff:seg.valuesOff+seg.values], seg)
+	})
+
+	// Write closing tags of containers spanning segments.
+	fixups, checks := 0, 0
+	for i := range segs {
+		if segs[i].err != nil {
+			return segs[i].err
+		}
+		for _, f := range segs[i].fixups {
+			tape[f.off] = f.v
+		}
+		fixups += len(segs[i].fixups)
+	}
+	for i := range segs {
+		for _, c := range segs[i].checks {
+			if tape[c.off]&JSONTAGMASK != c.v {
+				return fmt.Errorf("reading %v, offset:%d, start tag did not match %x != %x", Tag(c.v>>56), c.off, tape[c.off]>>56, c.v>>56)
+			}
+		}
+		checks += len(segs[i].checks)
+	}
+	if fixups != checks {
+		return fmt.Errorf("segments have %d containers spanning segments, but %d closing tags", fixups, checks)
+	}
+	return nil
+}
+
+// resizeSegments will return s.segs with n entries.
+func (s *Serializer) resizeSegments(n int) []tapeSegment {
+	if cap(s.segs) < n {
+		s.segs = append(s.segs[:cap(s.segs)], make([]tapeSegment, n-cap(s.segs))...)
+	}
+	s.segs = s.segs[:n]
+	return s.segs
+}
+
+// splitTape will append the start offsets of segments of tape to dst.
+// Segments are cut before values, so they have at least size entries,
+// unless a single value is bigger.
+// Values bigger than size are split between their children.
+func splitTape(dst []int, tape []uint64, size int) []int {
+	dst = append(dst, 0)
+	last := 0
+	var walk func(off, end int)
+	walk = func(off, end int) {
+		for off < end {
+			next := tapeNext(tape, off)
+			if next <= off || next > end {
+				// Invalid tape, don't split.
+				return
+			}
+			if next-last > size {
+				if off > last && off-last >= size {
+					dst = append(dst, off)
+					last = off
+				}
+				if next-off > size {
+					switch Tag(tape[off] >> JSONTAGOFFSET) {
+					case TagRoot, TagObjectStart, TagArrayStart:
+						// Split content, the closing tag stays in the last segment.
+						walk(off+1, next-1)
+					}
+				}
+			}
+			off = next
+		}
+	}
+	walk(0, len(tape))
+	return dst
+}
+
+// patchStrings will add base to all string offsets in values.
+func patchStrings(tags, values []byte, base uint64) {
+	for _, t := range tags {
+		switch Tag(t) {
+		case TagString:
+			binary.LittleEndian.PutUint64(values, binary.LittleEndian.Uint64(values)+base)
+			values = values[16:]
+		case tagFloatWithFlag:
+			values = values[16:]
+		case TagFloat, TagInteger, TagUint, TagObjectStart, TagArrayStart, TagRoot, TagStringInline, TagIntegerInline:
+			values = values[8:]
+		}
+	}
+}
+
+// parallelDo will call fn for 0 to n-1 using the specified number of workers.
+// The index of the worker calling is supplied to fn.
+func parallelDo(n, workers int, fn func(worker, i int)) {
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(0, i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := range jobs {
+				fn(w, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,643 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Optional sections stored in serialized blocks (v3+).
+const (
+	sectionSummary  byte = 1
+	sectionSegments byte = 2
+	sectionRecords  byte = 3
+)
+
+const (
+	// summaryMaxString is the maximum length of stored min/max strings.
+	summaryMaxString = 256
+
+	// bloomBitsPerValue is the number of filter bits per distinct value.
+	// With bloomHashes probes this gives ~1% false positives.
+	bloomBitsPerValue = 10
+	bloomHashes       = 7
+
+	// bloomMaxBits is the maximum size of a single filter.
+	bloomMaxBits = 1 << 23
+)
+
+// Value types stored in PathSummary.
+const (
+	summaryNumbers = 1 << iota
+	summaryStrings
+	summaryOther
+	summaryMaxTruncated
+)
+
+// Summarize will add a summary of the values found at each of the supplied
+// paths to every serialized block.
+// The summary contains a Bloom filter of all scalar values and the range
+// of numbers and strings found at the path.
+// Paths are object keys from the root of each record, similar to FindElement.
+// Objects and arrays at the paths are counted, but their content is not summarized.
+// Summaries allow ReadBlocks to skip blocks that cannot contain wanted values.
+// Calling Summarize with no paths disables summaries.
+func (s *Serializer) Summarize(paths ...[]string) {
+	s.summaryPaths = s.summaryPaths[:0]
+	for _, p := range paths {
+		s.summaryPaths = append(s.summaryPaths, append([]string{}, p...))
+	}
+}
+
+// BlockSummary contains summaries of a serialized block.
+type BlockSummary struct {
+	// Records is the number of root elements in the block.
+	Records int
+
+	// Paths contains the summary of each path.
+	Paths []PathSummary
+}
+
+// Path returns the summary of the specified path.
+// If the path was not summarized nil is returned.
+func (b *BlockSummary) Path(path ...string) *PathSummary {
+	for i := range b.Paths {
+		p := &b.Paths[i]
+		if len(p.Path) != len(path) {
+			continue
+		}
+		match := true
+		for j := range path {
+			if p.Path[j] != path[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return p
+		}
+	}
+	return nil
+}
+
+// PathSummary contains a summary of the values found at a path in a block.
+type PathSummary struct {
+	// Path is the path of the values.
+	Path []string
+
+	// Values is the number of records that contained a value at the path.
+	Values int
+
+	// HasNumbers is set if any numbers were found.
+	// MinNumber and MaxNumber contain the range of numbers.
+	// Integers are converted to float64.
+	// NaN values, which can be set on a tape, are not part of the range.
+	HasNumbers           bool
+	MinNumber, MaxNumber float64
+
+	// HasStrings is set if any strings were found.
+	// MinString and MaxString contain the range of strings compared bytewise.
+	// If the maximum string was too long to be stored, MaxStringTruncated is set
+	// and there is no upper limit.
+	HasStrings           bool
+	MinString, MaxString string
+	MaxStringTruncated   bool
+
+	// HasOther is set if any objects or arrays were found.
+	HasOther bool
+
+	bloom []uint64
+}
+
+// MayContainString returns false if the string s is definitely not found at the path.
+func (p *PathSummary) MayContainString(s string) bool {
+	if !p.StringRangeOverlaps(s, s) {
+		return false
+	}
+	return p.bloomTest(hashSummaryString([]byte(s)))
+}
+
+// MayContainNumber returns false if the number f is definitely not found at the path.
+func (p *PathSummary) MayContainNumber(f float64) bool {
+	if !p.NumberRangeOverlaps(f, f) {
+		return false
+	}
+	return p.bloomTest(hashSummaryNumber(f))
+}
+
+// MayContainBool returns false if the bool b is definitely not found at the path.
+func (p *PathSummary) MayContainBool(b bool) bool {
+	if b {
+		return p.bloomTest(hashSummaryBytes('t', nil))
+	}
+	return p.bloomTest(hashSummaryBytes('f', nil))
+}
+
+// MayContainNull returns false if null is definitely not found at the path.
+func (p *PathSummary) MayContainNull() bool {
+	return p.bloomTest(hashSummaryBytes('n', nil))
+}
+
+// NumberRangeOverlaps returns whether any number in the range min to max (inclusive)
+// may be found at the path.
+func (p *PathSummary) NumberRangeOverlaps(min, max float64) bool {
+	if math.IsNaN(p.MinNumber) || math.IsNaN(p.MaxNumber) {
+		// Older summaries could contain NaN, so the range is unknown.
+		return p.HasNumbers
+	}
+	return p.HasNumbers && min <= p.MaxNumber && max >= p.MinNumber
+}
+
+// StringRangeOverlaps returns whether any string in the range min to max (inclusive)
+// may be found at the path.
+func (p *PathSummary) StringRangeOverlaps(min, max string) bool {
+	if !p.HasStrings || max < p.MinString {
+		return false
+	}
+	return p.MaxStringTruncated || min <= p.MaxString
+}
+
+func (p *PathSummary) bloomTest(h uint64) bool {
+	if len(p.bloom) == 0 {
+		return false
+	}
+	bits := uint64(len(p.bloom)) * 64
+	h1, h2 := h, h>>32|1
+	for i := 0; i < bloomHashes; i++ {
+		bit := h1 & (bits - 1)
+		if p.bloom[bit>>6]&(1<<(bit&63)) == 0 {
+			return false
+		}
+		h1 += h2
+	}
+	return true
+}
+
+// hashSummaryBytes returns the FNV-1a hash of typ followed by b.
+func hashSummaryBytes(typ byte, b []byte) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	h ^= uint64(typ)
+	h *= prime64
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= prime64
+	}
+	return h
+}
+
+func hashSummaryString(b []byte) uint64 {
+	return hashSummaryBytes('s', b)
+}
+
+// hashSummaryNumber hashes f. All numbers are hashed as float64,
+// so integers and floats with the same value hash the same.
+func hashSummaryNumber(f float64) uint64 {
+	if f == 0 {
+		// Remove sign of negative zero.
+		f = 0
+	}
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(f))
+	return hashSummaryBytes('d', tmp[:])
+}
+
+// summaryBuilder collects values for a single path.
+type summaryBuilder struct {
+	PathSummary
+	maxString []byte
+	hashes    []uint64
+}
+
+func (b *summaryBuilder) reset(path []string) {
+	*b = summaryBuilder{
+		PathSummary: PathSummary{Path: path},
+		hashes:      b.hashes[:0],
+		maxString:   b.maxString[:0],
+	}
+}
+
+func (b *summaryBuilder) add(i *Iter) error {
+	b.Values++
+	switch i.Type() {
+	case TypeString:
+		sb, err := i.StringBytes()
+		if err != nil {
+			return err
+		}
+		b.hashes = append(b.hashes, hashSummaryString(sb))
+		if !b.HasStrings {
+			b.HasStrings = true
+			b.MinString = string(sb)
+			b.maxString = append(b.maxString[:0], sb...)
+			return nil
+		}
+		if string(sb) < b.MinString {
+			b.MinString = string(sb)
+		}
+		if bytes.Compare(sb, b.maxString) > 0 {
+			b.maxString = append(b.maxString[:0], sb...)
+		}
+	case TypeInt, TypeUint, TypeFloat:
+		f, err := i.Float()
+		if err != nil {
+			return err
+		}
+		b.hashes = append(b.hashes, hashSummaryNumber(f))
+		if math.IsNaN(f) {
+			// NaN would make the range unusable.
+			return nil
+		}
+		if !b.HasNumbers {
+			b.HasNumbers = true
+			b.MinNumber, b.MaxNumber = f, f
+			return nil
+		}
+		b.MinNumber = math.Min(b.MinNumber, f)
+		b.MaxNumber = math.Max(b.MaxNumber, f)
+	case TypeBool:
+		v, err := i.Bool()
+		if err != nil {
+			return err
+		}
+		if v {
+			b.hashes = append(b.hashes, hashSummaryBytes('t', nil))
+		} else {
+			b.hashes = append(b.hashes, hashSummaryBytes('f', nil))
+		}
+	case TypeNull:
+		b.hashes = append(b.hashes, hashSummaryBytes('n', nil))
+	default:
+		b.HasOther = true
+	}
+	return nil
+}
+
+// appendTo will finish the summary and append it to dst.
+func (b *summaryBuilder) appendTo(dst []byte) []byte {
+	// Deduplicate hashes to size the filter.
+	sort.Slice(b.hashes, func(i, j int) bool { return b.hashes[i] < b.hashes[j] })
+	n := 0
+	for i, h := range b.hashes {
+		if i == 0 || h != b.hashes[n-1] {
+			b.hashes[n] = h
+			n++
+		}
+	}
+	b.hashes = b.hashes[:n]
+	bits := 64
+	for bits < n*bloomBitsPerValue && bits < bloomMaxBits {
+		bits <<= 1
+	}
+	if n == 0 {
+		bits = 0
+	}
+	b.bloom = make([]uint64, bits/64)
+	for _, h := range b.hashes {
+		h1, h2 := h, h>>32|1
+		for i := 0; i < bloomHashes; i++ {
+			bit := h1 & uint64(bits-1)
+			b.bloom[bit>>6] |= 1 << (bit & 63)
+			h1 += h2
+		}
+	}
+
+	var flags byte
+	if b.HasNumbers {
+		flags |= summaryNumbers
+	}
+	if b.HasStrings {
+		flags |= summaryStrings
+		if len(b.MinString) > summaryMaxString {
+			// A prefix is still a lower bound.
+			b.MinString = b.MinString[:summaryMaxString]
+		}
+		if len(b.maxString) > summaryMaxString {
+			flags |= summaryMaxTruncated
+			b.maxString = b.maxString[:0]
+		}
+	}
+	if b.HasOther {
+		flags |= summaryOther
+	}
+
+	dst = appendUvarint(dst, uint64(len(b.Path)))
+	for _, k := range b.Path {
+		dst = appendUvarint(dst, uint64(len(k)))
+		dst = append(dst, k...)
+	}
+	dst = appendUvarint(dst, uint64(b.Values))
+	dst = append(dst, flags)
+	var tmp [8]byte
+	if b.HasNumbers {
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(b.MinNumber))
+		dst = append(dst, tmp[:]...)
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(b.MaxNumber))
+		dst = append(dst, tmp[:]...)
+	}
+	if b.HasStrings {
+		dst = appendUvarint(dst, uint64(len(b.MinString)))
+		dst = append(dst, b.MinString...)
+		dst = appendUvarint(dst, uint64(len(b.maxString)))
+		dst = append(dst, b.maxString...)
+	}
+	dst = appendUvarint(dst, uint64(len(b.bloom)))
+	for _, v := range b.bloom {
+		binary.LittleEndian.PutUint64(tmp[:], v)
+		dst = append(dst, tmp[:]...)
+	}
+	return dst
+}
+
+// appendSummary will append the summary section payload of pj to dst.
+func (s *Serializer) appendSummary(dst []byte, pj *ParsedJson) ([]byte, error) {
+	if cap(s.summaries) < len(s.summaryPaths) {
+		s.summaries = make([]summaryBuilder, len(s.summaryPaths))
+	}
+	s.summaries = s.summaries[:len(s.summaryPaths)]
+	for i, p := range s.summaryPaths {
+		s.summaries[i].reset(p)
+	}
+	records := 0
+	var elem Element
+	err := pj.ForEach(func(i Iter) error {
+		records++
+		if i.Type() != TypeObject {
+			return nil
+		}
+		for j := range s.summaries {
+			b := &s.summaries[j]
+			e, err := i.FindElement(&elem, b.Path...)
+			if err != nil {
+				if err == ErrPathNotFound {
+					continue
+				}
+				return err
+			}
+			if err := b.add(&e.Iter); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return dst, err
+	}
+	dst = appendUvarint(dst, uint64(records))
+	dst = appendUvarint(dst, uint64(len(s.summaries)))
+	for i := range s.summaries {
+		dst = s.summaries[i].appendTo(dst)
+	}
+	return dst, nil
+}
+
+// parseSummary parses a summary section payload.
+func parseSummary(b []byte) (*BlockSummary, error) {
+	br := bytes.NewBuffer(b)
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(br.Len()) {
+			return nil, errors.New("summary string extends beyond input")
+		}
+		return br.Next(int(n)), nil
+	}
+	readFloat := func() (float64, error) {
+		if br.Len() < 8 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(br.Next(8))), nil
+	}
+
+	var res BlockSummary
+	records, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	res.Records = int(records)
+	paths, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if paths > uint64(br.Len()) {
+		return nil, errors.New("summary path count extends beyond input")
+	}
+	res.Paths = make([]PathSummary, paths)
+	for i := range res.Paths {
+		p := &res.Paths[i]
+		keys, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if keys > uint64(br.Len()) {
+			return nil, errors.New("summary key count extends beyond input")
+		}
+		p.Path = make([]string, keys)
+		for j := range p.Path {
+			k, err := readBytes()
+			if err != nil {
+				return nil, err
+			}
+			p.Path[j] = string(k)
+		}
+		values, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		p.Values = int(values)
+		flags, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		p.HasNumbers = flags&summaryNumbers != 0
+		p.HasStrings = flags&summaryStrings != 0
+		p.HasOther = flags&summaryOther != 0
+		p.MaxStringTruncated = flags&summaryMaxTruncated != 0
+		if p.HasNumbers {
+			if p.MinNumber, err = readFloat(); err != nil {
+				return nil, err
+			}
+			if p.MaxNumber, err = readFloat(); err != nil {
+				return nil, err
+			}
+		}
+		if p.HasStrings {
+			v, err := readBytes()
+			if err != nil {
+				return nil, err
+			}
+			p.MinString = string(v)
+			if v, err = readBytes(); err != nil {
+				return nil, err
+			}
+			p.MaxString = string(v)
+		}
+		words, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if words > uint64(br.Len()/8) {
+			return nil, errors.New("summary filter extends beyond input")
+		}
+		if words&(words-1) != 0 {
+			return nil, errors.New("summary filter size not power of two")
+		}
+		p.bloom = make([]uint64, words)
+		for j := range p.bloom {
+			p.bloom[j] = binary.LittleEndian.Uint64(br.Next(8))
+		}
+	}
+	if br.Len() > 0 {
+		return nil, errors.New("extra data after summary")
+	}
+	return &res, nil
+}
+
+// ReadSummary returns the summary of a single serialized block
+// without decompressing it.
+// If the block has no summary, nil is returned.
+func (s *Serializer) ReadSummary(src []byte) (*BlockSummary, error) {
+	br := bytes.NewBuffer(src)
+	if v, err := br.ReadByte(); err != nil {
+		return nil, err
+	} else if v > serializedVersion {
+		return nil, errors.New("unknown version")
+	} else if v < 3 {
+		return nil, nil
+	}
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return nil, err
+	}
+	var res *BlockSummary
+	err := readSections(br, func(typ byte, payload []byte) error {
+		if typ != sectionSummary {
+			return nil
+		}
+		var err error
+		res, err = parseSummary(payload)
+		return err
+	})
+	return res, err
+}
+
+// ReadBlocks will read serialized blocks written back-to-back from r.
+// For each block with a summary pred is called and if it returns false,
+// the block is skipped without being decompressed.
+// Blocks without a summary are always deserialized.
+// fn is called with the content of each block that is not skipped.
+// The ParsedJson is reused, so it is only valid until fn returns.
+// If fn returns an error, reading stops and the error is returned.
+// When r returns io.EOF between blocks nil is returned.
+func (s *Serializer) ReadBlocks(r io.Reader, pred func(b *BlockSummary) bool, fn func(pj *ParsedJson) error) error {
+	br := bufio.NewReader(r)
+	var block []byte
+	var pj *ParsedJson
+	var tmp [binary.MaxVarintLen64]byte
+	for {
+		v, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		c, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		if c > s.maxBlockSize {
+			return errors.New("compressed block too big")
+		}
+		n := binary.PutUvarint(tmp[:], c)
+		size := 1 + n + int(c)
+		if cap(block) < size {
+			block = make([]byte, size)
+		}
+		block = block[:size]
+		block[0] = v
+		copy(block[1:], tmp[:n])
+		if _, err := io.ReadFull(br, block[1+n:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if pred != nil {
+			sum, err := s.ReadSummary(block)
+			if err != nil {
+				return fmt.Errorf("reading summary: %w", err)
+			}
+			if sum != nil && !pred(sum) {
+				continue
+			}
+		}
+		pj, err = s.Deserialize(block, pj)
+		if err != nil {
+			return err
+		}
+		if err := fn(pj); err != nil {
+			return err
+		}
+	}
+}
+
+// readSections will read optional sections and call fn with each.
+// fn may be nil to skip all sections.
+func readSections(br *bytes.Buffer, fn func(typ byte, payload []byte) error) error {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		typ, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		if size > uint64(br.Len()) {
+			return fmt.Errorf("section size (%d) extends beyond input %d", size, br.Len())
+		}
+		payload := br.Next(int(size))
+		if fn != nil {
+			if err := fn(typ, payload); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendUvarint(dst []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(dst, tmp[:n]...)
+}
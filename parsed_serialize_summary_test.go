@@ -0,0 +1,236 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSerializer_Summarize(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const blocks = 10
+	const perBlock = 100
+	var stream []byte
+	s := NewSerializer()
+	s.Summarize([]string{"user_id"}, []string{"user", "name"}, []string{"tags"})
+	for blk := 0; blk < blocks; blk++ {
+		var sb strings.Builder
+		for i := 0; i < perBlock; i++ {
+			id := blk*perBlock + i
+			fmt.Fprintf(&sb, `{"user_id":%d,"user":{"name":"name-%05d"},"tags":["a"],"active":%v}`+"\n", id, id, id%2 == 0)
+		}
+		// Records without the fields.
+		sb.WriteString(`{"other":1}` + "\n" + `[1,2,3]` + "\n")
+		pj, err := ParseND([]byte(sb.String()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = s.Serialize(stream, *pj)
+	}
+
+	// Check first block summary.
+	sum, err := s.ReadSummary(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum == nil {
+		t.Fatal("no summary")
+	}
+	if sum.Records != perBlock+2 {
+		t.Errorf("want %d records, got %d", perBlock+2, sum.Records)
+	}
+	id := sum.Path("user_id")
+	if id == nil {
+		t.Fatal("user_id not summarized")
+	}
+	if id.Values != perBlock || !id.HasNumbers || id.HasStrings || id.HasOther {
+		t.Errorf("unexpected summary: %+v", id)
+	}
+	if id.MinNumber != 0 || id.MaxNumber != perBlock-1 {
+		t.Errorf("unexpected range: %v -> %v", id.MinNumber, id.MaxNumber)
+	}
+	for i := 0; i < perBlock; i++ {
+		if !id.MayContainNumber(float64(i)) {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+	if id.MayContainNumber(perBlock) || id.MayContainString("0") || id.MayContainNull() {
+		t.Error("expected value to be excluded")
+	}
+	name := sum.Path("user", "name")
+	if name == nil || !name.HasStrings || name.MinString != "name-00000" || name.MaxString != "name-00099" {
+		t.Fatalf("unexpected summary: %+v", name)
+	}
+	if !name.MayContainString("name-00042") {
+		t.Error("false negative")
+	}
+	if !sum.Path("tags").HasOther {
+		t.Error("expected tags to contain other")
+	}
+	if sum.Path("active") != nil {
+		t.Error("active should not be summarized")
+	}
+
+	// Bloom filter should reject most values inside the range.
+	falsePositive := 0
+	for i := 0; i < 1000; i++ {
+		if name.MayContainString(fmt.Sprintf("name-%05d-x", i)) {
+			falsePositive++
+		}
+	}
+	if falsePositive > 50 {
+		t.Errorf("too many false positives: %d", falsePositive)
+	}
+
+	// Read blocks, only one should match.
+	var found, read int
+	err = s.ReadBlocks(bytes.NewReader(stream), func(b *BlockSummary) bool {
+		p := b.Path("user_id")
+		return p == nil || p.MayContainNumber(555)
+	}, func(pj *ParsedJson) error {
+		read++
+		return pj.ForEach(func(i Iter) error {
+			e, err := i.FindElement(nil, "user_id")
+			if err != nil {
+				return nil
+			}
+			v, err := e.Iter.Int()
+			if err != nil {
+				return err
+			}
+			if v == 555 {
+				found++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != 1 {
+		t.Errorf("want 1 match, got %d", found)
+	}
+	if read != 1 {
+		t.Errorf("want 1 block read, got %d", read)
+	}
+
+	// All blocks should deserialize without predicate.
+	read = 0
+	err = s.ReadBlocks(bytes.NewReader(stream), nil, func(pj *ParsedJson) error {
+		read++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != blocks {
+		t.Errorf("want %d blocks, got %d", blocks, read)
+	}
+
+	// Truncated stream.
+	err = s.ReadBlocks(bytes.NewReader(stream[:len(stream)-1]), nil, func(pj *ParsedJson) error { return nil })
+	if err == nil {
+		t.Error("expected error on truncated stream")
+	}
+}
+
+func TestSerializer_SummarizeNaN(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := ParseND([]byte(`{"v":1.5}`+"\n"+`{"v":2}`+"\n"+`{"v":7}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := pj.Iter()
+	elem, err := i.FindElement(nil, "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := elem.Iter.SetFloat(math.NaN()); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSerializer()
+	s.Summarize([]string{"v"})
+	sum, err := s.ReadSummary(s.Serialize(nil, *pj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sum.Path("v")
+	if v == nil || !v.HasNumbers || v.MinNumber != 2 || v.MaxNumber != 7 {
+		t.Fatalf("unexpected summary: %+v", v)
+	}
+	if !v.MayContainNumber(7) || !v.NumberRangeOverlaps(3, 10) {
+		t.Error("false negative")
+	}
+	if v.MayContainNumber(1.5) {
+		t.Error("replaced value should be excluded")
+	}
+
+	// Summaries with NaN in the range may match anything.
+	v.MinNumber = math.NaN()
+	if !v.NumberRangeOverlaps(3, 10) {
+		t.Error("false negative with NaN range")
+	}
+}
+
+func TestSerializer_SummarizeLongStrings(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	long := strings.Repeat("z", summaryMaxString+10)
+	input := fmt.Sprintf(`{"s":"%s"}`+"\n"+`{"s":"b"}`+"\n"+`{"s":true}`, long)
+	pj, err := ParseND([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSerializer()
+	s.Summarize([]string{"s"})
+	b := s.Serialize(nil, *pj)
+	sum, err := s.ReadSummary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := sum.Path("s")
+	if !p.MaxStringTruncated || p.MinString != "b" {
+		t.Fatalf("unexpected summary: %+v", p)
+	}
+	if !p.MayContainString(long) || !p.MayContainBool(true) || p.MayContainBool(false) {
+		t.Error("unexpected result")
+	}
+	if p.StringRangeOverlaps("a", "a") || !p.StringRangeOverlaps("a", "c") {
+		t.Error("unexpected range result")
+	}
+
+	// Must still deserialize.
+	got, err := s.Deserialize(b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter, gotIter := pj.Iter(), got.Iter()
+	want, _ := iter.MarshalJSON()
+	gotJSON, _ := gotIter.MarshalJSON()
+	if !bytes.Equal(want, gotJSON) {
+		t.Errorf("mismatch\n%s\n%s", want, gotJSON)
+	}
+}
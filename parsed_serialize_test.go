@@ -333,3 +333,193 @@ func TestDeSerializeJSON(t *testing.T) {
 		test(b, s)
 	})
 }
+
+func TestSerializeFloatFlags(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	input := `[0.1, 0.5, 1e23, 1e-400, 18446744073709551616, 9007199254740993.0, 42]`
+	want := []FloatFlags{
+		FloatInexact.Flags(),
+		0,
+		FloatInexact.Flags(FloatExceedsSafeInteger, FloatFromExponent),
+		FloatInexact.Flags(FloatUnderflowToZero, FloatFromExponent),
+		FloatOverflowedInteger.Flags(FloatExceedsSafeInteger),
+		FloatInexact.Flags(FloatExceedsSafeInteger),
+		0,
+	}
+	pj, err := Parse([]byte(input), nil, WithFloatPrecisionFlags(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(t *testing.T, pj *ParsedJson) {
+		t.Helper()
+		i := pj.Iter()
+		// Move into root and array.
+		i.AdvanceInto()
+		i.AdvanceInto()
+		arr, err := i.Array(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ai := arr.Iter()
+		for n, w := range want {
+			if ai.Advance() == TypeNone {
+				t.Fatal("array too short")
+			}
+			_, flags, err := ai.FloatFlags()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flags != w {
+				t.Errorf("element %d: want flags %b, got %b", n, w, flags)
+			}
+		}
+	}
+	check(t, pj)
+	for _, mode := range []CompressMode{CompressNone, CompressFast, CompressDefault, CompressBest} {
+		s := NewSerializer()
+		s.CompressMode(mode)
+		pj2, err := s.Deserialize(s.Serialize(nil, *pj), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, pj2)
+	}
+}
+
+func TestSerializeFloatFlagsDefault(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	input := []byte(`[0.1, 0.2, 1.5e10, 3.25, 9007199254740993.0, 18446744073709551616]`)
+	pj, err := Parse(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the option only FloatOverflowedInteger is set.
+	i := pj.Iter()
+	i.AdvanceInto()
+	i.AdvanceInto()
+	arr, err := i.Array(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := arr.Iter()
+	for n := 0; ai.Advance() != TypeNone; n++ {
+		_, flags, err := ai.FloatFlags()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := FloatFlags(0)
+		if n == 5 {
+			want = FloatOverflowedInteger.Flags()
+		}
+		if flags != want {
+			t.Errorf("element %d: want flags %b, got %b", n, want, flags)
+		}
+	}
+
+	// Floats without flags are serialized without the flag value.
+	withFlags, err := Parse(input, nil, WithFloatPrecisionFlags(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSerializer()
+	s.CompressMode(CompressNone)
+	plain := len(s.Serialize(nil, *pj))
+	flagged := len(s.Serialize(nil, *withFlags))
+	if plain >= flagged {
+		t.Errorf("want default (%d bytes) smaller than with flags (%d bytes)", plain, flagged)
+	}
+}
+
+func TestSerializeParallel(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	for _, tt := range testCases {
+		org := loadCompressed(t, tt.name)
+		pj, err := Parse(org, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			i := pj.Iter()
+			want, err := i.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewSerializer()
+			s.Parallel(4)
+			s.segmentSize = 64
+			output := s.Serialize(nil, *pj)
+			if len(pj.Tape) >= 2*s.segmentSize && len(s.segs) < 2 {
+				t.Errorf("tape with %d entries was not split", len(pj.Tape))
+			}
+			// Segmented output must be readable both in parallel and serially.
+			serial := NewSerializer()
+			for _, d := range []*Serializer{s, serial} {
+				pj2, err := d.Deserialize(output, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				i = pj2.Iter()
+				got, err := i.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(want, got) {
+					t.Fatal("output mismatch")
+				}
+			}
+		})
+	}
+}
+
+func TestSplitTape(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := ParseND([]byte(`{"a":[1,2,3,4,5,6,7,8,9,10],"b":"str"}
+[[1,2],[3,4],[5,6],[7,8]]
+{"c":null}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size := 1; size < len(pj.Tape); size++ {
+		starts := splitTape(nil, pj.Tape, size)
+		if starts[0] != 0 {
+			t.Fatalf("size %d: first segment starts at %d", size, starts[0])
+		}
+		for i, off := range starts {
+			if i > 0 && off <= starts[i-1] {
+				t.Fatalf("size %d: segments not increasing: %v", size, starts)
+			}
+			// Segments must start at a value, not in the middle of one.
+			if i > 0 && off-starts[i-1] < size {
+				t.Fatalf("size %d: segment %d has %d entries", size, i-1, off-starts[i-1])
+			}
+		}
+		// Check that no value is split, by walking the tape.
+		valueStarts := map[int]bool{}
+		var walk func(off, end int)
+		walk = func(off, end int) {
+			for off < end {
+				valueStarts[off] = true
+				next := tapeNext(pj.Tape, off)
+				switch Tag(pj.Tape[off] >> JSONTAGOFFSET) {
+				case TagRoot, TagObjectStart, TagArrayStart:
+					walk(off+1, next-1)
+				}
+				off = next
+			}
+		}
+		walk(0, len(pj.Tape))
+		for _, off := range starts {
+			if !valueStarts[off] {
+				t.Fatalf("size %d: segment starts inside value at %d", size, off)
+			}
+		}
+	}
+}
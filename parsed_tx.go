@@ -0,0 +1,252 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrTxDone is returned when a transaction is used after Commit or Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx is an edit transaction on a ParsedJson.
+// Edits made through the transaction are recorded in a journal,
+// so they can be undone exactly by Rollback.
+// A Tx is not safe for concurrent use and edits made to the
+// document outside the transaction are not recorded.
+type Tx struct {
+	pj      *ParsedJson
+	journal []txEntry
+
+	// strings is the length of the string buffer when the transaction began.
+	strings int
+	done    bool
+}
+
+// txEntry is the previous content of an edited value.
+type txEntry struct {
+	off   int // tape offset of the value tag
+	words int // number of tape entries of the value
+	old   [2]uint64
+}
+
+// Begin starts an edit transaction on pj.
+// Values are edited with the Set methods of the transaction,
+// using iterators obtained from pj.
+// Call Commit to keep the edits or Rollback to restore the document.
+func (pj *ParsedJson) Begin() *Tx {
+	tx := &Tx{pj: pj}
+	if pj.Strings != nil {
+		tx.strings = len(pj.Strings.B)
+	}
+	return tx
+}
+
+// SetNull changes the value of i to null as Iter.SetNull.
+func (tx *Tx) SetNull(i *Iter) error {
+	return tx.edit(i, func() error { return i.SetNull() })
+}
+
+// SetBool changes the value of i as Iter.SetBool.
+func (tx *Tx) SetBool(i *Iter, v bool) error {
+	return tx.edit(i, func() error { return i.SetBool(v) })
+}
+
+// SetFloat changes the value of i as Iter.SetFloat.
+func (tx *Tx) SetFloat(i *Iter, v float64) error {
+	return tx.edit(i, func() error { return i.SetFloat(v) })
+}
+
+// SetFloat32 changes the value of i as Iter.SetFloat32.
+func (tx *Tx) SetFloat32(i *Iter, v float32) error {
+	return tx.edit(i, func() error { return i.SetFloat32(v) })
+}
+
+// SetInt changes the value of i as Iter.SetInt.
+func (tx *Tx) SetInt(i *Iter, v int64) error {
+	return tx.edit(i, func() error { return i.SetInt(v) })
+}
+
+// SetUInt changes the value of i as Iter.SetUInt.
+func (tx *Tx) SetUInt(i *Iter, v uint64) error {
+	return tx.edit(i, func() error { return i.SetUInt(v) })
+}
+
+// SetString changes the value of i as Iter.SetString.
+func (tx *Tx) SetString(i *Iter, v string) error {
+	return tx.edit(i, func() error { return i.SetString(v) })
+}
+
+// SetStringBytes changes the value of i as Iter.SetStringBytes.
+func (tx *Tx) SetStringBytes(i *Iter, v []byte) error {
+	return tx.edit(i, func() error { return i.SetStringBytes(v) })
+}
+
+// edit records the current value of i and calls fn to change it.
+// Set methods do not modify the tape when they fail, so nothing is recorded on errors.
+func (tx *Tx) edit(i *Iter, fn func() error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tape := tx.pj.Tape
+	off := i.off - 1
+	if len(i.tape.Tape) == 0 || len(tape) == 0 || &i.tape.Tape[0] != &tape[0] || i.tape.Strings != tx.pj.Strings {
+		return errors.New("iterator does not belong to the transaction document")
+	}
+	if off < 0 || off >= len(i.tape.Tape) {
+		return errors.New("iterator is not at a value")
+	}
+	e := txEntry{off: off, words: 1, old: [2]uint64{tape[off]}}
+	switch Tag(tape[off] >> JSONTAGOFFSET) {
+	case TagString, TagInteger, TagUint, TagFloat:
+		if off+1 >= len(tape) {
+			return errors.New("corrupt input: value extends beyond tape")
+		}
+		e.words = 2
+		e.old[1] = tape[off+1]
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	tx.journal = append(tx.journal, e)
+	return nil
+}
+
+// Len returns the number of edits recorded in the transaction.
+func (tx *Tx) Len() int {
+	return len(tx.journal)
+}
+
+// Commit keeps the edits made in the transaction.
+// The journal is kept, so Patch can be called after Commit.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	return nil
+}
+
+// Rollback restores all values edited in the transaction
+// and truncates the string buffer to the length it had when the transaction began.
+// Iterators pointing to edited values must be re-read after Rollback,
+// since they cache the edited value.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tape := tx.pj.Tape
+	for j := len(tx.journal) - 1; j >= 0; j-- {
+		e := &tx.journal[j]
+		copy(tape[e.off:e.off+e.words], e.old[:e.words])
+	}
+	if tx.pj.Strings != nil && len(tx.pj.Strings.B) > tx.strings {
+		tx.pj.Strings.B = tx.pj.Strings.B[:tx.strings]
+	}
+	tx.journal = tx.journal[:0]
+	tx.done = true
+	return nil
+}
+
+// Patch appends the edits of the transaction to dst as a JSON Patch (RFC 6902).
+// Every edited value is written as a "replace" operation with its current value,
+// in the order the values were first edited.
+// Paths are relative to the root element containing the values,
+// so an error is returned if values in more than one root element were edited.
+// Edited object keys cannot be expressed as a patch and also return an error.
+func (tx *Tx) Patch(dst []byte) ([]byte, error) {
+	// Order of first edit of every offset.
+	order := make(map[int]int, len(tx.journal))
+	for _, e := range tx.journal {
+		if _, ok := order[e.off]; !ok {
+			order[e.off] = len(order)
+		}
+	}
+	paths := make([]string, len(order))
+	if len(order) > 0 {
+		w := tapeWalker{pj: tx.pj}
+		root := -1
+		var p Path
+		err := w.walk(func(off int, tag Tag, isKey bool) error {
+			idx, ok := order[off]
+			if !ok {
+				return nil
+			}
+			if isKey {
+				return fmt.Errorf("edited object key at offset %d cannot be expressed as a patch", off)
+			}
+			if root >= 0 && w.root != root {
+				return errors.New("edits span multiple root elements")
+			}
+			root = w.root
+			var err error
+			p, err = w.path(p[:0])
+			if err != nil {
+				return err
+			}
+			paths[idx] = jsonPointer(p)
+			return nil
+		})
+		if err != nil {
+			return dst, err
+		}
+	}
+
+	offs := make([]int, len(order))
+	for off, idx := range order {
+		offs[idx] = off
+	}
+	dst = append(dst, '[')
+	for n, off := range offs {
+		if n > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, `{"op":"replace","path":"`...)
+		dst = escapeBytes(dst, []byte(paths[n]))
+		dst = append(dst, `","value":`...)
+		i, err := tx.pj.iterAt(off)
+		if err != nil {
+			return dst, err
+		}
+		dst, err = i.MarshalJSONBuffer(dst)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, '}')
+	}
+	return append(dst, ']'), nil
+}
+
+// jsonPointerEscaper escapes reference tokens of a JSON Pointer (RFC 6901).
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns p as a JSON Pointer.
+func jsonPointer(p Path) string {
+	var sb strings.Builder
+	for _, e := range p {
+		sb.WriteByte('/')
+		if e.IsIndex() {
+			sb.WriteString(strconv.Itoa(e.Index))
+			continue
+		}
+		jsonPointerEscaper.WriteString(&sb, e.Key)
+	}
+	return sb.String()
+}
@@ -0,0 +1,183 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjson
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	const input = `{"a":[1,"x",true],"b/c":{"d~":2.5},"e":null}`
+	for _, compact := range []bool{false, true} {
+		pj, err := Parse([]byte(input), nil, WithCompactTape(compact))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantTape := append([]uint64{}, pj.Tape...)
+		wantStrings := len(pj.Strings.B)
+		find := func(path ...string) *Iter {
+			t.Helper()
+			i := pj.Iter()
+			elem, err := i.FindElement(nil, path...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &elem.Iter
+		}
+		arr, err := find("a").Array(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vals []Iter
+		arr.ForEach(func(i Iter) {
+			vals = append(vals, i)
+		})
+
+		tx := pj.Begin()
+		if err := tx.SetInt(&vals[0], 10); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.SetString(&vals[1], "yz"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.SetBool(&vals[2], false); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.SetFloat(find("b/c", "d~"), 1.5); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.SetBool(find("e"), true); err != nil {
+			t.Fatal(err)
+		}
+		// Failed edits are not recorded.
+		if err := tx.SetNull(&vals[0]); err == nil {
+			t.Fatal("want error")
+		}
+		if err := tx.SetInt(&vals[0], 11); err != nil {
+			t.Fatal(err)
+		}
+		if tx.Len() != 6 {
+			t.Errorf("want 6 edits, got %d", tx.Len())
+		}
+		got, err := pj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		const want = `{"a":[11,"yz",false],"b/c":{"d~":1.5},"e":true}`
+		if string(got) != want {
+			t.Errorf("want %s, got %s", want, got)
+		}
+		patch, err := tx.Patch(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const wantPatch = `[{"op":"replace","path":"/a/0","value":11},{"op":"replace","path":"/a/1","value":"yz"},` +
+			`{"op":"replace","path":"/a/2","value":false},{"op":"replace","path":"/b~1c/d~0","value":1.5},{"op":"replace","path":"/e","value":true}]`
+		if string(patch) != wantPatch {
+			t.Errorf("want %s, got %s", wantPatch, patch)
+		}
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		got, err = pj.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != input {
+			t.Errorf("want %s, got %s", input, got)
+		}
+		for j := range wantTape {
+			if pj.Tape[j] != wantTape[j] {
+				t.Fatalf("tape entry %d: want %x, got %x", j, wantTape[j], pj.Tape[j])
+			}
+		}
+		if len(pj.Strings.B) != wantStrings {
+			t.Errorf("want %d string bytes, got %d", wantStrings, len(pj.Strings.B))
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("want ErrTxDone, got %v", err)
+		}
+		if err := tx.SetInt(&vals[0], 1); !errors.Is(err, ErrTxDone) {
+			t.Errorf("want ErrTxDone, got %v", err)
+		}
+	}
+}
+
+func TestTx_Errors(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	pj, err := ParseND([]byte("{\"a\":1}\n{\"a\":2}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Parse([]byte(`{"a":1}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := pj.Begin()
+	i := other.Iter()
+	elem, err := i.FindElement(nil, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.SetInt(&elem.Iter, 2); err == nil {
+		t.Error("want error editing other document")
+	}
+
+	n := 0
+	err = pj.ForEach(func(i Iter) error {
+		n++
+		elem, err := i.FindElement(nil, "a")
+		if err != nil {
+			return err
+		}
+		return tx.SetInt(&elem.Iter, int64(n*10))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Patch(nil); err == nil {
+		t.Error("want error for edits in multiple roots")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+		t.Errorf("want ErrTxDone, got %v", err)
+	}
+	n = 0
+	err = pj.ForEach(func(i Iter) error {
+		n++
+		elem, err := i.FindElement(nil, "a")
+		if err != nil {
+			return err
+		}
+		if v, err := elem.Iter.Int(); err != nil || v != int64(n*10) {
+			t.Errorf("root %d: want %d, got %d (%v)", n, n*10, v, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
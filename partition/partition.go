@@ -0,0 +1,372 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package partition routes parsed records to per-key sinks,
+// for example to split NDJSON by tenant, date or event type.
+package partition
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/simdjson-go"
+)
+
+// KeyFunc returns the partition key of a record appended to dst.
+type KeyFunc func(dst []byte, record simdjson.Iter) ([]byte, error)
+
+// PathKey returns a KeyFunc that uses the value at the given object path.
+// Strings are used as-is and other values as their JSON representation.
+// Records where the path is missing or null get an empty key.
+func PathKey(path ...string) KeyFunc {
+	return func(dst []byte, record simdjson.Iter) ([]byte, error) {
+		var e simdjson.Element
+		if _, err := record.FindElement(&e, path...); err != nil {
+			if err == simdjson.ErrPathNotFound {
+				return dst, nil
+			}
+			return dst, err
+		}
+		switch e.Type {
+		case simdjson.TypeNull:
+			return dst, nil
+		case simdjson.TypeString:
+			b, err := e.Iter.StringBytes()
+			if err != nil {
+				return dst, err
+			}
+			return append(dst, b...), nil
+		}
+		return e.Iter.MarshalJSONBuffer(dst)
+	}
+}
+
+// SinkFactory opens the sink of a partition.
+// It is called the first time a partition is written with reopen false.
+// If the sink was closed to stay below the open sink limit it is
+// called again with reopen true, and the sink should then append.
+type SinkFactory func(key string, reopen bool) (io.WriteCloser, error)
+
+// FileSinks returns a SinkFactory that writes each partition to a file in dir.
+// Keys are escaped with FileName and suffix is appended to form the file name.
+// Existing files are truncated when a partition is first opened.
+func FileSinks(dir, suffix string) SinkFactory {
+	return func(key string, reopen bool) (io.WriteCloser, error) {
+		flag := os.O_CREATE | os.O_WRONLY
+		if reopen {
+			flag |= os.O_APPEND
+		} else {
+			flag |= os.O_TRUNC
+		}
+		return os.OpenFile(filepath.Join(dir, FileName(key)+suffix), flag, 0666)
+	}
+}
+
+// emptyKeyName is the file name of the empty key.
+// Path escaping never produces '%' followed by non-hex characters,
+// so it cannot be the name of another key.
+const emptyKeyName = "%empty"
+
+// FileName returns the key as a file name.
+// The key is path escaped and leading dots are escaped as %2E,
+// so names never refer to the directory itself or its parent.
+// The empty key, used by PathKey for missing values, is named "%empty".
+// Different keys always give different names.
+func FileName(key string) string {
+	if key == "" {
+		return emptyKeyName
+	}
+	name := url.PathEscape(key)
+	dots := 0
+	for dots < len(name) && name[dots] == '.' {
+		dots++
+	}
+	if dots == 0 {
+		return name
+	}
+	return strings.Repeat("%2E", dots) + name[dots:]
+}
+
+// Format is the format records are written in.
+type Format uint8
+
+const (
+	// FormatJSON writes each record as a line of JSON.
+	FormatJSON Format = iota
+
+	// FormatSerialized writes blocks of records produced by simdjson.Serializer.
+	// The blocks can be read back with Serializer.ReadBlocks.
+	FormatSerialized
+)
+
+// Writer routes records to per-partition sinks.
+// Output is buffered per partition and written when the buffer is full,
+// when the sink is closed to stay below the open sink limit, or on Flush.
+// A Writer cannot be used concurrently.
+type Writer struct {
+	key  KeyFunc
+	open SinkFactory
+
+	format  Format
+	maxOpen int
+	bufSize int
+
+	parts  map[string]*part
+	lru    list.List // open partitions, most recently used first
+	keyBuf []byte
+
+	ser *simdjson.Serializer
+	out []byte
+	err error
+}
+
+type part struct {
+	key  string
+	sink io.WriteCloser
+	elem *list.Element
+	buf  []byte // FormatJSON
+
+	// bld contains the records of the next block with FormatSerialized.
+	bld    *simdjson.Builder
+	opened bool
+}
+
+// Option is an option for NewWriter.
+type Option func(w *Writer) error
+
+// WithFormat sets the output format. The default is FormatJSON.
+func WithFormat(f Format) Option {
+	return func(w *Writer) error {
+		if f > FormatSerialized {
+			return fmt.Errorf("partition: unknown format %d", f)
+		}
+		w.format = f
+		return nil
+	}
+}
+
+// WithMaxOpen sets the maximum number of open sinks.
+// When the limit is reached the least recently used sink is flushed and closed.
+// The default is 64.
+func WithMaxOpen(n int) Option {
+	return func(w *Writer) error {
+		if n <= 0 {
+			return errors.New("partition: max open sinks must be positive")
+		}
+		w.maxOpen = n
+		return nil
+	}
+}
+
+// WithBufferSize sets the size at which a partition buffer is written to its sink.
+// With FormatSerialized the size of the tape and strings of buffered records is used.
+// The default is 64KB.
+func WithBufferSize(n int) Option {
+	return func(w *Writer) error {
+		if n <= 0 {
+			return errors.New("partition: buffer size must be positive")
+		}
+		w.bufSize = n
+		return nil
+	}
+}
+
+// NewWriter returns a Writer that partitions records by key
+// and opens sinks using open.
+func NewWriter(key KeyFunc, open SinkFactory, opts ...Option) (*Writer, error) {
+	if key == nil || open == nil {
+		return nil, errors.New("partition: key function and sink factory must be set")
+	}
+	w := &Writer{
+		key:     key,
+		open:    open,
+		maxOpen: 64,
+		bufSize: 64 << 10,
+		parts:   make(map[string]*part),
+	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	if w.format == FormatSerialized {
+		w.ser = simdjson.NewSerializer()
+	}
+	return w, nil
+}
+
+// Write adds a record, as returned by ParsedJson.ForEach, to its partition.
+// If the key cannot be determined or the record cannot be marshaled
+// an error is returned and the record is skipped, so writing can continue.
+// Errors from sinks are permanent.
+// With FormatSerialized records are copied to the tape of the next block,
+// and errors copying a record are also permanent.
+func (w *Writer) Write(record simdjson.Iter) error {
+	if w.err != nil {
+		return w.err
+	}
+	var err error
+	w.keyBuf, err = w.key(w.keyBuf[:0], record)
+	if err != nil {
+		return err
+	}
+	p := w.parts[string(w.keyBuf)]
+	if p == nil {
+		p = &part{key: string(w.keyBuf)}
+		w.parts[p.key] = p
+	}
+	if err := w.acquire(p); err != nil {
+		return err
+	}
+	if w.format == FormatSerialized {
+		if p.bld == nil {
+			p.bld = simdjson.NewBuilder()
+		}
+		p.bld.Copy(record)
+		pj, err := p.bld.Finish()
+		if err != nil {
+			w.err = fmt.Errorf("partition: %q: %w", p.key, err)
+			return w.err
+		}
+		if len(pj.Tape)*8+len(pj.Strings.B) >= w.bufSize {
+			return w.flush(p)
+		}
+		return nil
+	}
+	n := len(p.buf)
+	p.buf, err = record.MarshalJSONBuffer(p.buf)
+	if err != nil {
+		p.buf = p.buf[:n]
+		return err
+	}
+	p.buf = append(p.buf, '\n')
+	if len(p.buf) >= w.bufSize {
+		return w.flush(p)
+	}
+	return nil
+}
+
+// WriteParsed writes all records in pj.
+func (w *Writer) WriteParsed(pj *simdjson.ParsedJson) error {
+	return pj.ForEach(w.Write)
+}
+
+// Keys returns the keys of all partitions written so far, sorted.
+func (w *Writer) Keys() []string {
+	keys := make([]string, 0, len(w.parts))
+	for k := range w.parts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Flush writes all buffered records to their sinks.
+// Sinks are not closed.
+func (w *Writer) Flush() error {
+	for e := w.lru.Front(); e != nil && w.err == nil; e = e.Next() {
+		w.flush(e.Value.(*part))
+	}
+	return w.err
+}
+
+// Close flushes and closes all open sinks.
+// The first error encountered is returned.
+func (w *Writer) Close() error {
+	for w.lru.Len() > 0 {
+		w.release(w.lru.Front().Value.(*part))
+	}
+	if w.err == nil {
+		w.err = errors.New("partition: writer closed")
+		return nil
+	}
+	return w.err
+}
+
+// acquire makes sure the sink of p is open and marks it as most recently used.
+func (w *Writer) acquire(p *part) error {
+	if p.sink != nil {
+		w.lru.MoveToFront(p.elem)
+		return nil
+	}
+	for w.lru.Len() >= w.maxOpen {
+		if err := w.release(w.lru.Back().Value.(*part)); err != nil {
+			return err
+		}
+	}
+	sink, err := w.open(p.key, p.opened)
+	if err != nil {
+		w.err = fmt.Errorf("partition: opening %q: %w", p.key, err)
+		return w.err
+	}
+	p.sink, p.opened = sink, true
+	p.elem = w.lru.PushFront(p)
+	return nil
+}
+
+// release flushes and closes the sink of p.
+// Its buffer is dropped, so only open partitions hold memory.
+func (w *Writer) release(p *part) error {
+	w.flush(p)
+	if err := p.sink.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("partition: closing %q: %w", p.key, err)
+	}
+	w.lru.Remove(p.elem)
+	p.sink, p.elem, p.buf, p.bld = nil, nil, nil, nil
+	return w.err
+}
+
+// flush writes the buffer of p to its sink.
+func (w *Writer) flush(p *part) error {
+	if w.err != nil {
+		return w.err
+	}
+	data := p.buf
+	if w.format == FormatSerialized {
+		if p.bld == nil {
+			return nil
+		}
+		pj, err := p.bld.Finish()
+		if err != nil {
+			w.err = fmt.Errorf("partition: %q: %w", p.key, err)
+			return w.err
+		}
+		if len(pj.Tape) == 0 {
+			return nil
+		}
+		w.out = w.ser.Serialize(w.out[:0], *pj)
+		data = w.out
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := p.sink.Write(data); err != nil {
+		w.err = fmt.Errorf("partition: writing %q: %w", p.key, err)
+		return w.err
+	}
+	p.buf = p.buf[:0]
+	if p.bld != nil {
+		p.bld.Reset()
+	}
+	return nil
+}
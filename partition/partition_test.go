@@ -0,0 +1,323 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package partition
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+type memSink struct {
+	buf    *bytes.Buffer
+	closed bool
+}
+
+func (m *memSink) Write(b []byte) (int, error) {
+	if m.closed {
+		return 0, errors.New("write to closed sink")
+	}
+	return m.buf.Write(b)
+}
+
+func (m *memSink) Close() error {
+	m.closed = true
+	return nil
+}
+
+type memSinks struct {
+	data  map[string]*bytes.Buffer
+	opens int
+}
+
+func (s *memSinks) factory(key string, reopen bool) (io.WriteCloser, error) {
+	if _, ok := s.data[key]; ok != reopen {
+		return nil, fmt.Errorf("%q: unexpected reopen %v", key, reopen)
+	}
+	if !reopen {
+		s.data[key] = &bytes.Buffer{}
+	}
+	s.opens++
+	return &memSink{buf: s.data[key]}, nil
+}
+
+func testInput(n int) []byte {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		switch i % 4 {
+		case 3:
+			fmt.Fprintf(&b, `{"i":%d}`+"\n", i)
+		default:
+			fmt.Fprintf(&b, `{"tenant":"t%d","i":%d}`+"\n", i%3, i)
+		}
+	}
+	return []byte(b.String())
+}
+
+// wantPartitions splits the input by the tenant field.
+func wantPartitions(input []byte) map[string]string {
+	want := map[string]string{}
+	for _, line := range strings.SplitAfter(string(input), "\n") {
+		if line == "" {
+			continue
+		}
+		key := ""
+		if idx := strings.Index(line, `"tenant":"`); idx >= 0 {
+			key = line[idx+10 : idx+12]
+		}
+		want[key] += line
+	}
+	return want
+}
+
+func TestWriter(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	input := testInput(1000)
+	pj, err := simdjson.ParseND(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := wantPartitions(input)
+
+	for _, maxOpen := range []int{1, 2, 10} {
+		t.Run(fmt.Sprint("open-", maxOpen), func(t *testing.T) {
+			sinks := &memSinks{data: map[string]*bytes.Buffer{}}
+			w, err := NewWriter(PathKey("tenant"), sinks.factory, WithMaxOpen(maxOpen), WithBufferSize(100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteParsed(pj); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Keys(); !reflect.DeepEqual(got, []string{"", "t0", "t1", "t2"}) {
+				t.Errorf("unexpected keys %q", got)
+			}
+			for key, data := range want {
+				if got := sinks.data[key].String(); got != data {
+					t.Errorf("partition %q: got %d bytes, want %d", key, len(got), len(data))
+				}
+			}
+			if maxOpen >= 4 && sinks.opens != 4 {
+				t.Errorf("expected 4 opens, got %d", sinks.opens)
+			}
+			if maxOpen == 1 && sinks.opens < 100 {
+				t.Errorf("expected sinks to be reopened, got %d opens", sinks.opens)
+			}
+			if err := w.Write(pj.Iter()); err == nil {
+				t.Error("expected error writing to closed writer")
+			}
+		})
+	}
+}
+
+func TestWriter_Serialized(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	input := testInput(500)
+	pj, err := simdjson.ParseND(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := wantPartitions(input)
+
+	sinks := &memSinks{data: map[string]*bytes.Buffer{}}
+	w, err := NewWriter(PathKey("tenant"), sinks.factory, WithFormat(FormatSerialized), WithMaxOpen(2), WithBufferSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteParsed(pj); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s := simdjson.NewSerializer()
+	for key, data := range want {
+		var got []byte
+		err := s.ReadBlocks(bytes.NewReader(sinks.data[key].Bytes()), nil, func(pj *simdjson.ParsedJson) error {
+			return pj.ForEach(func(i simdjson.Iter) error {
+				got, err = i.MarshalJSONBuffer(got)
+				got = append(got, '\n')
+				return err
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("partition %q: got %d bytes, want %d", key, len(got), len(data))
+		}
+	}
+}
+
+func TestPathKey(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	tests := map[string]string{
+		`{"a":{"b":"x/y"}}`: "x/y",
+		`{"a":{"b":12}}`:    "12",
+		`{"a":{"b":[1,2]}}`: "[1,2]",
+		`{"a":{"b":null}}`:  "",
+		`{"a":{}}`:          "",
+	}
+	key := PathKey("a", "b")
+	for input, want := range tests {
+		pj, err := simdjson.Parse([]byte(input), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = pj.ForEach(func(i simdjson.Iter) error {
+			got, err := key(nil, i)
+			if err != nil {
+				return err
+			}
+			if string(got) != want {
+				t.Errorf("%s: got key %q, want %q", input, got, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileSinks(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := []byte("{\"k\":\"a/b\",\"v\":1}\n{\"k\":\"c\",\"v\":2}\n{\"k\":\"a/b\",\"v\":3}\n")
+	pj, err := simdjson.ParseND(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(PathKey("k"), FileSinks(dir, ".json"), WithMaxOpen(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteParsed(pj); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "a%2Fb.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"k\":\"a/b\",\"v\":1}\n{\"k\":\"a/b\",\"v\":3}\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"":       "%empty",
+		".":      "%2E",
+		"..":     "%2E%2E",
+		"../x":   "%2E%2E%2Fx",
+		".a.b":   "%2Ea.b",
+		"a.b":    "a.b",
+		"a/b":    "a%2Fb",
+		"%empty": "%25empty",
+		"%2E":    "%252E",
+	}
+	for key, want := range tests {
+		if got := FileName(key); got != want {
+			t.Errorf("%q: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestFileSinksSpecialKeys(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	dir, err := ioutil.TempDir("", "partition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing, null and dot keys with an empty suffix.
+	input := []byte("{\"v\":1}\n{\"k\":null,\"v\":2}\n{\"k\":\".\",\"v\":3}\n{\"k\":\"..\",\"v\":4}\n")
+	pj, err := simdjson.ParseND(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(PathKey("k"), FileSinks(sub, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteParsed(pj); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"%empty": "{\"v\":1}\n{\"k\":null,\"v\":2}\n",
+		"%2E":    "{\"k\":\".\",\"v\":3}\n",
+		"%2E%2E": "{\"k\":\"..\",\"v\":4}\n",
+	}
+	files, err := ioutil.ReadDir(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Errorf("got %d files, want %d", len(files), len(want))
+	}
+	for name, content := range want {
+		got, err := ioutil.ReadFile(filepath.Join(sub, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: got %q, want %q", name, got, content)
+		}
+	}
+	// Nothing may be written outside the directory.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("got %d entries in parent, want 1 (%v)", len(files), err)
+	}
+}
@@ -0,0 +1,800 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/minio/simdjson-go"
+)
+
+// evalCtx contains the state for evaluating a single record.
+type evalCtx struct {
+	root  simdjson.Iter
+	elem  simdjson.Element
+	obj   simdjson.Object
+	arr   simdjson.Array
+	group *group
+
+	// vals is a stack of function arguments.
+	vals []Value
+}
+
+// expr is a compiled expression.
+type expr interface {
+	eval(c *evalCtx) (Value, error)
+
+	// String returns a canonical representation of the expression.
+	String() string
+}
+
+// walkExpr calls fn for e and all sub-expressions.
+// If fn returns a replacement, it is used instead and not walked further.
+func walkExpr(e expr, fn func(e expr) (expr, error)) (expr, error) {
+	if r, err := fn(e); r != nil || err != nil {
+		return r, err
+	}
+	var err error
+	walk := func(e *expr) {
+		if err == nil && *e != nil {
+			*e, err = walkExpr(*e, fn)
+		}
+	}
+	switch e := e.(type) {
+	case *unaryExpr:
+		walk(&e.x)
+	case *binaryExpr:
+		walk(&e.l)
+		walk(&e.r)
+	case *isNullExpr:
+		walk(&e.x)
+	case *likeExpr:
+		walk(&e.x)
+	case *betweenExpr:
+		walk(&e.x)
+		walk(&e.lo)
+		walk(&e.hi)
+	case *inExpr:
+		walk(&e.x)
+		for i := range e.list {
+			walk(&e.list[i])
+		}
+	case *callExpr:
+		for i := range e.args {
+			walk(&e.args[i])
+		}
+	case *castExpr:
+		walk(&e.x)
+	case *aggExpr:
+		walk(&e.arg)
+	}
+	return e, err
+}
+
+// literalExpr is a constant.
+type literalExpr struct {
+	v Value
+}
+
+func (e *literalExpr) eval(c *evalCtx) (Value, error) {
+	return e.v, nil
+}
+
+func (e *literalExpr) String() string {
+	if e.v.kind == KindString {
+		return "'" + strings.Replace(string(e.v.s), "'", "''", -1) + "'"
+	}
+	b, _ := e.v.AppendJSON(nil)
+	return string(b)
+}
+
+// pathStep is a single step of a path.
+type pathStep struct {
+	key   string
+	index int // -1 for keys
+}
+
+// pathExpr selects a value from the record.
+type pathExpr struct {
+	steps []pathStep
+}
+
+func (e *pathExpr) eval(c *evalCtx) (Value, error) {
+	it := c.root
+	for _, s := range e.steps {
+		if s.index < 0 {
+			if it.Type() != simdjson.TypeObject {
+				return missingValue, nil
+			}
+			obj, err := it.Object(&c.obj)
+			if err != nil {
+				return missingValue, err
+			}
+			elem := obj.FindKey(s.key, &c.elem)
+			if elem == nil {
+				return missingValue, nil
+			}
+			it = elem.Iter
+			continue
+		}
+		if it.Type() != simdjson.TypeArray {
+			return missingValue, nil
+		}
+		arr, err := it.Array(&c.arr)
+		if err != nil {
+			return missingValue, err
+		}
+		ai := arr.Iter()
+		for n := 0; n <= s.index; n++ {
+			if ai.Advance() == simdjson.TypeNone {
+				return missingValue, nil
+			}
+		}
+		it = ai
+	}
+	return valueFromIter(&it)
+}
+
+func (e *pathExpr) String() string {
+	var sb strings.Builder
+	for i, s := range e.steps {
+		if s.index >= 0 {
+			fmt.Fprintf(&sb, "[%d]", s.index)
+			continue
+		}
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		if isPlainIdent(s.key) {
+			sb.WriteString(s.key)
+		} else {
+			sb.WriteString(`"` + strings.Replace(s.key, `"`, `""`, -1) + `"`)
+		}
+	}
+	return sb.String()
+}
+
+// name returns the default column name of the path.
+func (e *pathExpr) name() string {
+	for i := len(e.steps) - 1; i >= 0; i-- {
+		if e.steps[i].index < 0 {
+			return e.steps[i].key
+		}
+	}
+	return ""
+}
+
+func isPlainIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := range s {
+		if !isIdentChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unaryExpr is NOT or unary minus.
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (e *unaryExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil || v.IsNull() {
+		return nullValue, err
+	}
+	switch e.op {
+	case "NOT":
+		if v.kind != KindBool {
+			return nullValue, fmt.Errorf("NOT applied to %v", v.kind)
+		}
+		return boolValue(!v.b), nil
+	default:
+		n, ok := v.numeric()
+		if !ok {
+			return nullValue, fmt.Errorf("cannot negate %v", v.kind)
+		}
+		if n.kind == KindInt {
+			return intValue(-n.i), nil
+		}
+		return floatValue(-n.f), nil
+	}
+}
+
+func (e *unaryExpr) String() string {
+	if e.op == "NOT" {
+		return "NOT " + e.x.String()
+	}
+	return "-" + e.x.String()
+}
+
+// binaryExpr is a binary operator.
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e *binaryExpr) eval(c *evalCtx) (Value, error) {
+	l, err := e.l.eval(c)
+	if err != nil {
+		return nullValue, err
+	}
+	switch e.op {
+	case "AND", "OR":
+		// Three valued logic.
+		if l.kind != KindBool && !l.IsNull() {
+			return nullValue, fmt.Errorf("%s applied to %v", e.op, l.kind)
+		}
+		if l.kind == KindBool && l.b == (e.op == "OR") {
+			return l, nil
+		}
+		r, err := e.r.eval(c)
+		if err != nil {
+			return nullValue, err
+		}
+		if r.kind != KindBool && !r.IsNull() {
+			return nullValue, fmt.Errorf("%s applied to %v", e.op, r.kind)
+		}
+		if r.kind == KindBool && (r.b == (e.op == "OR") || !l.IsNull()) {
+			return r, nil
+		}
+		return nullValue, nil
+	}
+	r, err := e.r.eval(c)
+	if err != nil || l.IsNull() || r.IsNull() {
+		return nullValue, err
+	}
+	switch e.op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=":
+		cmp, ok := compare(l, r)
+		if !ok {
+			return nullValue, nil
+		}
+		switch e.op {
+		case "=":
+			return boolValue(cmp == 0), nil
+		case "!=", "<>":
+			return boolValue(cmp != 0), nil
+		case "<":
+			return boolValue(cmp < 0), nil
+		case "<=":
+			return boolValue(cmp <= 0), nil
+		case ">":
+			return boolValue(cmp > 0), nil
+		default:
+			return boolValue(cmp >= 0), nil
+		}
+	case "||":
+		ls, err := l.AppendText(nil)
+		if err != nil {
+			return nullValue, err
+		}
+		rs, err := r.AppendText(ls)
+		return stringValue(rs), err
+	}
+	return arith(e.op, l, r)
+}
+
+func (e *binaryExpr) String() string {
+	return "(" + e.l.String() + " " + e.op + " " + e.r.String() + ")"
+}
+
+// arith applies an arithmetic operator.
+// Integers stay integers, except on overflow.
+func arith(op string, l, r Value) (Value, error) {
+	l, lok := l.numeric()
+	r, rok := r.numeric()
+	if !lok || !rok {
+		return nullValue, fmt.Errorf("arithmetic %s on %v and %v", op, l.kind, r.kind)
+	}
+	if l.kind == KindInt && r.kind == KindInt {
+		a, b := l.i, r.i
+		switch op {
+		case "+":
+			if s := a + b; (s > a) == (b > 0) {
+				return intValue(s), nil
+			}
+		case "-":
+			if s := a - b; (s < a) == (b > 0) {
+				return intValue(s), nil
+			}
+		case "*":
+			if a == 0 || b == 0 {
+				return intValue(0), nil
+			}
+			if p := a * b; p/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64) {
+				return intValue(p), nil
+			}
+		case "/":
+			if b == 0 {
+				return nullValue, errors.New("division by zero")
+			}
+			if a%b == 0 && !(a == math.MinInt64 && b == -1) {
+				return intValue(a / b), nil
+			}
+		case "%":
+			if b == 0 {
+				return nullValue, errors.New("division by zero")
+			}
+			return intValue(a % b), nil
+		}
+	}
+	a, _ := l.Float()
+	b, _ := r.Float()
+	switch op {
+	case "+":
+		return floatValue(a + b), nil
+	case "-":
+		return floatValue(a - b), nil
+	case "*":
+		return floatValue(a * b), nil
+	case "/":
+		if b == 0 {
+			return nullValue, errors.New("division by zero")
+		}
+		return floatValue(a / b), nil
+	case "%":
+		if b == 0 {
+			return nullValue, errors.New("division by zero")
+		}
+		return floatValue(math.Mod(a, b)), nil
+	}
+	return nullValue, fmt.Errorf("unknown operator %s", op)
+}
+
+// isNullExpr is IS [NOT] NULL and IS [NOT] MISSING.
+type isNullExpr struct {
+	x       expr
+	not     bool
+	missing bool
+}
+
+func (e *isNullExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil {
+		return nullValue, err
+	}
+	res := v.IsNull()
+	if e.missing {
+		res = v.kind == KindMissing
+	}
+	return boolValue(res != e.not), nil
+}
+
+func (e *isNullExpr) String() string {
+	s := e.x.String() + " IS "
+	if e.not {
+		s += "NOT "
+	}
+	if e.missing {
+		return s + "MISSING"
+	}
+	return s + "NULL"
+}
+
+// likeExpr is [NOT] LIKE.
+type likeExpr struct {
+	x       expr
+	pattern string
+	escape  byte
+	not     bool
+}
+
+func (e *likeExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil || v.kind != KindString {
+		return nullValue, err
+	}
+	return boolValue(matchLike(v.s, e.pattern, e.escape) != e.not), nil
+}
+
+func (e *likeExpr) String() string {
+	s := e.x.String()
+	if e.not {
+		s += " NOT"
+	}
+	s += " LIKE '" + strings.Replace(e.pattern, "'", "''", -1) + "'"
+	if e.escape != 0 {
+		s += " ESCAPE '" + string(e.escape) + "'"
+	}
+	return s
+}
+
+// matchLike matches s against a LIKE pattern.
+// '%' matches any sequence and '_' matches a single character.
+func matchLike(s []byte, pattern string, escape byte) bool {
+	for len(pattern) > 0 {
+		c := pattern[0]
+		switch {
+		case escape != 0 && c == escape && len(pattern) > 1:
+			if len(s) == 0 || s[0] != pattern[1] {
+				return false
+			}
+			s, pattern = s[1:], pattern[2:]
+		case c == '%':
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchLike(s[i:], pattern, escape) {
+					return true
+				}
+			}
+			return false
+		case c == '_':
+			if len(s) == 0 {
+				return false
+			}
+			_, n := utf8.DecodeRune(s)
+			s, pattern = s[n:], pattern[1:]
+		default:
+			if len(s) == 0 || s[0] != c {
+				return false
+			}
+			s, pattern = s[1:], pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// betweenExpr is [NOT] BETWEEN lo AND hi.
+type betweenExpr struct {
+	x, lo, hi expr
+	not       bool
+}
+
+func (e *betweenExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil || v.IsNull() {
+		return nullValue, err
+	}
+	lo, err := e.lo.eval(c)
+	if err != nil {
+		return nullValue, err
+	}
+	hi, err := e.hi.eval(c)
+	if err != nil {
+		return nullValue, err
+	}
+	c1, ok1 := compare(v, lo)
+	c2, ok2 := compare(v, hi)
+	if !ok1 || !ok2 {
+		return nullValue, nil
+	}
+	return boolValue((c1 >= 0 && c2 <= 0) != e.not), nil
+}
+
+func (e *betweenExpr) String() string {
+	s := e.x.String()
+	if e.not {
+		s += " NOT"
+	}
+	return s + " BETWEEN " + e.lo.String() + " AND " + e.hi.String()
+}
+
+// inExpr is [NOT] IN (list).
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+func (e *inExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil || v.IsNull() {
+		return nullValue, err
+	}
+	for _, le := range e.list {
+		lv, err := le.eval(c)
+		if err != nil {
+			return nullValue, err
+		}
+		if cmp, ok := compare(v, lv); ok && cmp == 0 {
+			return boolValue(!e.not), nil
+		}
+	}
+	return boolValue(e.not), nil
+}
+
+func (e *inExpr) String() string {
+	s := e.x.String()
+	if e.not {
+		s += " NOT"
+	}
+	s += " IN ("
+	for i, le := range e.list {
+		if i > 0 {
+			s += ", "
+		}
+		s += le.String()
+	}
+	return s + ")"
+}
+
+// callExpr is a scalar function call.
+type callExpr struct {
+	name string
+	args []expr
+	fn   func(args []Value) (Value, error)
+
+	// lazy functions get unevaluated arguments.
+	lazy func(c *evalCtx, args []expr) (Value, error)
+}
+
+func (e *callExpr) eval(c *evalCtx) (Value, error) {
+	if e.lazy != nil {
+		return e.lazy(c, e.args)
+	}
+	start := len(c.vals)
+	defer func() { c.vals = c.vals[:start] }()
+	for _, a := range e.args {
+		v, err := a.eval(c)
+		if err != nil {
+			return nullValue, err
+		}
+		c.vals = append(c.vals, v)
+	}
+	return e.fn(c.vals[start:])
+}
+
+func (e *callExpr) String() string {
+	s := e.name + "("
+	for i, a := range e.args {
+		if i > 0 {
+			s += ", "
+		}
+		s += a.String()
+	}
+	return s + ")"
+}
+
+// castExpr is CAST(x AS type).
+type castExpr struct {
+	x   expr
+	typ string
+}
+
+func (e *castExpr) eval(c *evalCtx) (Value, error) {
+	v, err := e.x.eval(c)
+	if err != nil || v.IsNull() {
+		return v, err
+	}
+	switch e.typ {
+	case "INT":
+		switch v.kind {
+		case KindInt:
+			return v, nil
+		case KindFloat:
+			if math.IsNaN(v.f) || v.f >= math.MaxInt64 || v.f < math.MinInt64 {
+				return nullValue, fmt.Errorf("cannot cast %v to INT", v.f)
+			}
+			return intValue(int64(v.f)), nil
+		case KindBool:
+			if v.b {
+				return intValue(1), nil
+			}
+			return intValue(0), nil
+		case KindString:
+			n, ok := v.numeric()
+			if !ok {
+				return nullValue, fmt.Errorf("cannot cast %q to INT", v.s)
+			}
+			if n.kind == KindFloat {
+				return intValue(int64(n.f)), nil
+			}
+			return n, nil
+		}
+	case "FLOAT":
+		switch v.kind {
+		case KindInt:
+			return floatValue(float64(v.i)), nil
+		case KindFloat:
+			return v, nil
+		case KindBool:
+			if v.b {
+				return floatValue(1), nil
+			}
+			return floatValue(0), nil
+		case KindString:
+			n, ok := v.numeric()
+			if !ok {
+				return nullValue, fmt.Errorf("cannot cast %q to FLOAT", v.s)
+			}
+			f, _ := n.Float()
+			return floatValue(f), nil
+		}
+	case "STRING":
+		b, err := v.AppendText(nil)
+		return stringValue(b), err
+	case "BOOL":
+		switch v.kind {
+		case KindBool:
+			return v, nil
+		case KindInt:
+			return boolValue(v.i != 0), nil
+		case KindFloat:
+			return boolValue(v.f != 0), nil
+		case KindString:
+			b, err := strconv.ParseBool(string(bytes.TrimSpace(v.s)))
+			if err != nil {
+				return nullValue, fmt.Errorf("cannot cast %q to BOOL", v.s)
+			}
+			return boolValue(b), nil
+		}
+	}
+	return nullValue, fmt.Errorf("cannot cast %v to %s", v.kind, e.typ)
+}
+
+func (e *castExpr) String() string {
+	return "CAST(" + e.x.String() + " AS " + e.typ + ")"
+}
+
+// aggExpr is an aggregate function.
+type aggExpr struct {
+	fn  string
+	arg expr // nil for COUNT(*)
+	idx int  // index of the accumulator in the group
+}
+
+func (e *aggExpr) eval(c *evalCtx) (Value, error) {
+	if c.group == nil {
+		return nullValue, fmt.Errorf("aggregate %s used outside aggregation", e.fn)
+	}
+	return c.group.accs[e.idx].result(e.fn), nil
+}
+
+// accumulate adds the value of the current record to the accumulator.
+func (e *aggExpr) accumulate(c *evalCtx, a *accumulator) error {
+	if e.arg == nil {
+		a.count++
+		return nil
+	}
+	v, err := e.arg.eval(c)
+	if err != nil || v.IsNull() {
+		return err
+	}
+	return a.add(e.fn, v)
+}
+
+func (e *aggExpr) String() string {
+	if e.arg == nil {
+		return e.fn + "(*)"
+	}
+	return e.fn + "(" + e.arg.String() + ")"
+}
+
+// groupRefExpr returns a GROUP BY value of the current group.
+type groupRefExpr struct {
+	idx  int
+	expr expr
+}
+
+func (e *groupRefExpr) eval(c *evalCtx) (Value, error) {
+	if c.group == nil {
+		return e.expr.eval(c)
+	}
+	return c.group.key[e.idx], nil
+}
+
+func (e *groupRefExpr) String() string {
+	return e.expr.String()
+}
+
+// accumulator holds the state of an aggregate.
+type accumulator struct {
+	count    int64
+	isum     int64
+	fsum     float64
+	isFloat  bool
+	min, max Value
+}
+
+func (a *accumulator) add(fn string, v Value) error {
+	a.count++
+	switch fn {
+	case "SUM", "AVG":
+		n, ok := v.numeric()
+		if !ok {
+			return fmt.Errorf("%s of non-numeric value %v", fn, v.kind)
+		}
+		if !a.isFloat && n.kind == KindInt {
+			s := a.isum + n.i
+			if (s > a.isum) == (n.i > 0) {
+				a.isum = s
+				return nil
+			}
+		}
+		if !a.isFloat {
+			a.isFloat = true
+			a.fsum = float64(a.isum)
+		}
+		f, _ := n.Float()
+		a.fsum += f
+	case "MIN", "MAX":
+		// Numbers in strings are used as numbers, as for SUM and AVG.
+		if n, ok := v.numeric(); ok {
+			v = n
+		}
+		if a.count == 1 {
+			var err error
+			a.min, err = v.detach()
+			if err != nil {
+				return err
+			}
+			a.max = a.min
+			return nil
+		}
+		if cmp, ok := compare(v, a.min); ok && cmp < 0 {
+			var err error
+			if a.min, err = v.detach(); err != nil {
+				return err
+			}
+		}
+		if cmp, ok := compare(v, a.max); ok && cmp > 0 {
+			var err error
+			if a.max, err = v.detach(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *accumulator) result(fn string) Value {
+	switch fn {
+	case "COUNT":
+		return intValue(a.count)
+	case "SUM":
+		if a.count == 0 {
+			return nullValue
+		}
+		if a.isFloat {
+			return floatValue(a.fsum)
+		}
+		return intValue(a.isum)
+	case "AVG":
+		if a.count == 0 {
+			return nullValue
+		}
+		if a.isFloat {
+			return floatValue(a.fsum / float64(a.count))
+		}
+		return floatValue(float64(a.isum) / float64(a.count))
+	case "MIN":
+		if a.count == 0 {
+			return nullValue
+		}
+		return a.min
+	case "MAX":
+		if a.count == 0 {
+			return nullValue
+		}
+		return a.max
+	}
+	return nullValue
+}
@@ -0,0 +1,171 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// scalarFunc is a scalar function.
+type scalarFunc struct {
+	minArgs, maxArgs int
+	fn               func(args []Value) (Value, error)
+	lazy             func(c *evalCtx, args []expr) (Value, error)
+}
+
+var scalarFuncs = map[string]scalarFunc{
+	"LOWER":            {minArgs: 1, maxArgs: 1, fn: fnLower},
+	"UPPER":            {minArgs: 1, maxArgs: 1, fn: fnUpper},
+	"TRIM":             {minArgs: 1, maxArgs: 1, fn: fnTrim},
+	"CHAR_LENGTH":      {minArgs: 1, maxArgs: 1, fn: fnCharLength},
+	"CHARACTER_LENGTH": {minArgs: 1, maxArgs: 1, fn: fnCharLength},
+	"SUBSTRING":        {minArgs: 2, maxArgs: 3, fn: fnSubstring},
+	"COALESCE":         {minArgs: 1, maxArgs: -1, lazy: fnCoalesce},
+	"NULLIF":           {minArgs: 2, maxArgs: 2, fn: fnNullIf},
+}
+
+// aggregateFuncs are the supported aggregate functions.
+var aggregateFuncs = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+func stringArg(fn string, v Value) ([]byte, error) {
+	if v.kind != KindString {
+		return nil, fmt.Errorf("%s: expected string argument, got %v", fn, v.kind)
+	}
+	return v.s, nil
+}
+
+func fnLower(args []Value) (Value, error) {
+	if args[0].IsNull() {
+		return nullValue, nil
+	}
+	s, err := stringArg("LOWER", args[0])
+	if err != nil {
+		return nullValue, err
+	}
+	return stringValue(bytes.ToLower(s)), nil
+}
+
+func fnUpper(args []Value) (Value, error) {
+	if args[0].IsNull() {
+		return nullValue, nil
+	}
+	s, err := stringArg("UPPER", args[0])
+	if err != nil {
+		return nullValue, err
+	}
+	return stringValue(bytes.ToUpper(s)), nil
+}
+
+func fnTrim(args []Value) (Value, error) {
+	if args[0].IsNull() {
+		return nullValue, nil
+	}
+	s, err := stringArg("TRIM", args[0])
+	if err != nil {
+		return nullValue, err
+	}
+	return stringValue(bytes.Trim(s, " ")), nil
+}
+
+func fnCharLength(args []Value) (Value, error) {
+	if args[0].IsNull() {
+		return nullValue, nil
+	}
+	s, err := stringArg("CHAR_LENGTH", args[0])
+	if err != nil {
+		return nullValue, err
+	}
+	return intValue(int64(utf8.RuneCount(s))), nil
+}
+
+// fnSubstring returns a substring.
+// Positions are 1-based and counted in characters.
+func fnSubstring(args []Value) (Value, error) {
+	for _, a := range args {
+		if a.IsNull() {
+			return nullValue, nil
+		}
+	}
+	s, err := stringArg("SUBSTRING", args[0])
+	if err != nil {
+		return nullValue, err
+	}
+	startV, ok := args[1].numeric()
+	if !ok || startV.kind != KindInt {
+		return nullValue, fmt.Errorf("SUBSTRING: start must be an integer")
+	}
+	start := startV.i
+	end, hasEnd := int64(0), len(args) > 2
+	if hasEnd {
+		lenV, ok := args[2].numeric()
+		if !ok || lenV.kind != KindInt || lenV.i < 0 {
+			return nullValue, fmt.Errorf("SUBSTRING: length must be a non-negative integer")
+		}
+		end = start + lenV.i
+	}
+	if start < 1 {
+		start = 1
+	}
+	if hasEnd && end <= start {
+		return stringValue(s[:0]), nil
+	}
+	// Convert character positions to byte offsets.
+	var pos int64 = 1
+	from, to := len(s), len(s)
+	for i := range string(s) {
+		if pos == start {
+			from = i
+		}
+		if hasEnd && pos == end {
+			to = i
+			break
+		}
+		pos++
+	}
+	if from > to {
+		from = to
+	}
+	return stringValue(s[from:to]), nil
+}
+
+func fnCoalesce(c *evalCtx, args []expr) (Value, error) {
+	for _, a := range args {
+		v, err := a.eval(c)
+		if err != nil {
+			return nullValue, err
+		}
+		if !v.IsNull() {
+			return v, nil
+		}
+	}
+	return nullValue, nil
+}
+
+func fnNullIf(args []Value) (Value, error) {
+	if cmp, ok := compare(args[0], args[1]); ok && cmp == 0 {
+		return nullValue, nil
+	}
+	return args[0], nil
+}
@@ -0,0 +1,148 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenType uint8
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+type token struct {
+	typ tokenType
+	s   string
+	pos int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return "'" + t.s + "'"
+	case tokQuotedIdent:
+		return `"` + t.s + `"`
+	}
+	return t.s
+}
+
+// is returns whether the token is the keyword or symbol s.
+// Keywords are matched case-insensitively.
+func (t token) is(s string) bool {
+	switch t.typ {
+	case tokIdent:
+		return strings.EqualFold(t.s, s)
+	case tokSymbol:
+		return t.s == s
+	}
+	return false
+}
+
+// lex splits the query into tokens.
+func lex(q string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(q) && isIdentChar(q[i]) {
+				i++
+			}
+			toks = append(toks, token{typ: tokIdent, s: q[start:i], pos: start})
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+			start := i
+			for i < len(q) && (q[i] >= '0' && q[i] <= '9' || q[i] == '.') {
+				i++
+			}
+			if i < len(q) && (q[i] == 'e' || q[i] == 'E') {
+				i++
+				if i < len(q) && (q[i] == '+' || q[i] == '-') {
+					i++
+				}
+				for i < len(q) && q[i] >= '0' && q[i] <= '9' {
+					i++
+				}
+			}
+			toks = append(toks, token{typ: tokNumber, s: q[start:i], pos: start})
+		case c == '\'' || c == '"':
+			// Quotes are escaped by doubling them.
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(q) {
+					return nil, fmt.Errorf("unterminated quote at position %d", start)
+				}
+				if q[i] == c {
+					if i+1 < len(q) && q[i+1] == c {
+						sb.WriteByte(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(q[i])
+				i++
+			}
+			typ := tokString
+			if c == '"' {
+				typ = tokQuotedIdent
+			}
+			toks = append(toks, token{typ: typ, s: sb.String(), pos: start})
+		default:
+			sym := ""
+			if i+1 < len(q) {
+				switch q[i : i+2] {
+				case "<=", ">=", "<>", "!=", "||":
+					sym = q[i : i+2]
+				}
+			}
+			if sym == "" {
+				if !strings.ContainsRune("(),.*[]=<>+-/%", rune(c)) {
+					return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+				}
+				sym = q[i : i+1]
+			}
+			toks = append(toks, token{typ: tokSymbol, s: sym, pos: i})
+			i += len(sym)
+		}
+	}
+	toks = append(toks, token{typ: tokEOF, pos: len(q)})
+	return toks, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
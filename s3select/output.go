@@ -0,0 +1,113 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+)
+
+// RowWriter receives result rows.
+type RowWriter interface {
+	// WriteRow writes a single row.
+	// Names and values are only valid until WriteRow returns.
+	WriteRow(names []string, values []Value) error
+
+	// Flush is called when all rows have been written.
+	Flush() error
+}
+
+// ndjsonWriter writes rows as NDJSON.
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewNDJSONWriter returns a writer that writes each row as a JSON object on a separate line.
+// Missing values are omitted.
+func NewNDJSONWriter(w io.Writer) RowWriter {
+	return &ndjsonWriter{w: bufio.NewWriter(w)}
+}
+
+func (n *ndjsonWriter) WriteRow(names []string, values []Value) error {
+	b := append(n.buf[:0], '{')
+	first := true
+	for i, v := range values {
+		if v.kind == KindMissing {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendJSONString(b, []byte(names[i]))
+		b = append(b, ':')
+		var err error
+		if b, err = v.AppendJSON(b); err != nil {
+			return err
+		}
+	}
+	b = append(b, '}', '\n')
+	n.buf = b
+	_, err := n.w.Write(b)
+	return err
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// csvWriter writes rows as CSV.
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+	rec    []string
+	buf    []byte
+}
+
+// NewCSVWriter returns a writer that writes rows as CSV.
+// If header is set, the column names of the first row are written as a header.
+// Null and missing values are written as empty fields,
+// objects and arrays are written as JSON.
+func NewCSVWriter(w io.Writer, header bool) RowWriter {
+	return &csvWriter{w: csv.NewWriter(w), header: header}
+}
+
+func (c *csvWriter) WriteRow(names []string, values []Value) error {
+	if c.header {
+		c.header = false
+		if err := c.w.Write(names); err != nil {
+			return err
+		}
+	}
+	c.rec = c.rec[:0]
+	for _, v := range values {
+		var err error
+		c.buf, err = v.AppendText(c.buf[:0])
+		if err != nil {
+			return err
+		}
+		c.rec = append(c.rec, string(c.buf))
+	}
+	return c.w.Write(c.rec)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,569 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reserved words cannot be used as unquoted field names.
+var reserved = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true,
+	"LIMIT": true, "AS": true, "AND": true, "OR": true, "NOT": true,
+	"IS": true, "NULL": true, "MISSING": true, "TRUE": true, "FALSE": true,
+	"LIKE": true, "ESCAPE": true, "BETWEEN": true, "IN": true, "FOR": true,
+}
+
+// castTypes maps type names to the canonical type.
+var castTypes = map[string]string{
+	"INT": "INT", "INTEGER": "INT", "BIGINT": "INT",
+	"FLOAT": "FLOAT", "DOUBLE": "FLOAT", "DECIMAL": "FLOAT", "NUMERIC": "FLOAT", "REAL": "FLOAT",
+	"STRING": "STRING", "VARCHAR": "STRING", "CHAR": "STRING", "TEXT": "STRING",
+	"BOOL": "BOOL", "BOOLEAN": "BOOL",
+}
+
+type parser struct {
+	toks []token
+	pos  int
+
+	// allowAgg is set when aggregates are allowed.
+	allowAgg bool
+	// inAgg is the aggregate function being parsed, if any.
+	inAgg string
+	aggs  []*aggExpr
+	paths []*parsedPath
+}
+
+// parsedPath is a path before the alias has been resolved.
+type parsedPath struct {
+	*pathExpr
+	firstQuoted bool
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// unread steps back over t, which must be the last token returned by next.
+func (p *parser) unread(t token) {
+	if t.typ != tokEOF {
+		p.pos--
+	}
+}
+
+// accept consumes the next token if it is the keyword or symbol s.
+func (p *parser) accept(s string) bool {
+	if p.peek().is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %s", s)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	return fmt.Errorf("s3select: %s, got %v at position %d", fmt.Sprintf(format, args...), t, t.pos)
+}
+
+// parseQuery parses a complete query.
+func parseQuery(sql string) (*Query, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, fmt.Errorf("s3select: %w", err)
+	}
+	p := parser{toks: toks}
+	q := Query{sql: sql, limit: -1}
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+
+	// Projection
+	p.allowAgg = true
+	if p.peek().is("*") || p.peek().typ == tokIdent && p.toks[p.pos+1].is(".") && p.toks[p.pos+2].is("*") {
+		for !p.accept("*") {
+			p.next()
+		}
+		q.star = true
+	} else {
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			col := column{e: e}
+			if p.accept("AS") {
+				t := p.next()
+				if t.typ != tokIdent && t.typ != tokQuotedIdent && t.typ != tokString {
+					p.unread(t)
+					return nil, p.errorf("expected alias")
+				}
+				col.name = t.s
+			} else if t := p.peek(); t.typ == tokQuotedIdent || t.typ == tokIdent && !reserved[strings.ToUpper(t.s)] {
+				col.name = p.next().s
+			}
+			q.cols = append(q.cols, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	p.allowAgg = false
+
+	// Source
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	if !p.accept("S3Object") {
+		return nil, p.errorf("expected S3Object")
+	}
+	alias := ""
+	if p.accept("AS") {
+		t := p.next()
+		if t.typ != tokIdent {
+			p.unread(t)
+			return nil, p.errorf("expected alias")
+		}
+		alias = t.s
+	} else if t := p.peek(); t.typ == tokIdent && !reserved[strings.ToUpper(t.s)] {
+		alias = p.next().s
+	}
+
+	if p.accept("WHERE") {
+		if q.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("GROUP") {
+		if err := p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			q.groupBy = append(q.groupBy, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		t := p.next()
+		n, err := strconv.ParseInt(t.s, 10, 64)
+		if t.typ != tokNumber || err != nil || n < 0 {
+			p.unread(t)
+			return nil, p.errorf("expected non-negative integer limit")
+		}
+		q.limit = n
+	}
+	if p.peek().typ != tokEOF {
+		return nil, p.errorf("unexpected token")
+	}
+
+	// Remove alias from paths.
+	for _, path := range p.paths {
+		if len(path.steps) < 2 || path.firstQuoted {
+			continue
+		}
+		first := path.steps[0].key
+		if strings.EqualFold(first, "S3Object") || alias != "" && strings.EqualFold(first, alias) {
+			path.steps = path.steps[1:]
+		}
+	}
+	q.aggs = p.aggs
+	if err := q.compile(); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "OR", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "AND", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.accept("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.typ == tokSymbol {
+		switch t.s {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: t.s, l: l, r: r}, nil
+		}
+	}
+	if p.accept("IS") {
+		e := &isNullExpr{x: l, not: p.accept("NOT")}
+		switch {
+		case p.accept("NULL"):
+		case p.accept("MISSING"):
+			e.missing = true
+		default:
+			return nil, p.errorf("expected NULL or MISSING")
+		}
+		return e, nil
+	}
+	not := p.accept("NOT")
+	switch {
+	case p.accept("LIKE"):
+		t := p.next()
+		if t.typ != tokString {
+			p.unread(t)
+			return nil, p.errorf("expected LIKE pattern string")
+		}
+		e := &likeExpr{x: l, pattern: t.s, not: not}
+		if p.accept("ESCAPE") {
+			t := p.next()
+			if t.typ != tokString || len(t.s) != 1 {
+				p.unread(t)
+				return nil, p.errorf("expected single character escape")
+			}
+			e.escape = t.s[0]
+		}
+		return e, nil
+	case p.accept("BETWEEN"):
+		lo, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		hi, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{x: l, lo: lo, hi: hi, not: not}, nil
+	case p.accept("IN"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		e := &inExpr{x: l, not: not}
+		for {
+			v, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			e.list = append(e.list, v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if not {
+		return nil, p.errorf("expected LIKE, BETWEEN or IN after NOT")
+	}
+	return l, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	l, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is("+") && !t.is("-") && !t.is("||") {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: t.s, l: l, r: r}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.is("*") && !t.is("/") && !t.is("%") {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: t.s, l: l, r: r}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := x.(*literalExpr); ok {
+			// Fold negative constants.
+			return (&unaryExpr{op: "-", x: lit}).fold()
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+// fold evaluates a unary expression on a constant.
+func (e *unaryExpr) fold() (expr, error) {
+	v, err := e.eval(nil)
+	if err != nil {
+		return nil, fmt.Errorf("s3select: %w", err)
+	}
+	return &literalExpr{v: v}, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.typ {
+	case tokNumber:
+		if i, err := strconv.ParseInt(t.s, 10, 64); err == nil {
+			return &literalExpr{v: intValue(i)}, nil
+		}
+		f, err := strconv.ParseFloat(t.s, 64)
+		if err != nil {
+			p.unread(t)
+			return nil, p.errorf("invalid number")
+		}
+		return &literalExpr{v: floatValue(f)}, nil
+	case tokString:
+		return &literalExpr{v: stringValue([]byte(t.s))}, nil
+	case tokQuotedIdent:
+		return p.parsePath(t)
+	case tokSymbol:
+		if t.s == "(" {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case tokIdent:
+		upper := strings.ToUpper(t.s)
+		switch upper {
+		case "TRUE":
+			return &literalExpr{v: boolValue(true)}, nil
+		case "FALSE":
+			return &literalExpr{v: boolValue(false)}, nil
+		case "NULL":
+			return &literalExpr{v: nullValue}, nil
+		case "MISSING":
+			return &literalExpr{v: missingValue}, nil
+		}
+		if p.peek().is("(") {
+			p.next()
+			return p.parseCall(upper)
+		}
+		if reserved[upper] {
+			break
+		}
+		return p.parsePath(t)
+	}
+	p.unread(t)
+	return nil, p.errorf("unexpected token")
+}
+
+// parsePath parses a path starting with t.
+func (p *parser) parsePath(t token) (expr, error) {
+	path := &parsedPath{pathExpr: &pathExpr{}, firstQuoted: t.typ == tokQuotedIdent}
+	path.steps = append(path.steps, pathStep{key: t.s, index: -1})
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.typ != tokIdent && t.typ != tokQuotedIdent {
+				p.unread(t)
+				return nil, p.errorf("expected field name")
+			}
+			path.steps = append(path.steps, pathStep{key: t.s, index: -1})
+		case p.accept("["):
+			t := p.next()
+			n, err := strconv.Atoi(t.s)
+			if t.typ != tokNumber || err != nil || n < 0 {
+				p.unread(t)
+				return nil, p.errorf("expected array index")
+			}
+			path.steps = append(path.steps, pathStep{index: n})
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		default:
+			p.paths = append(p.paths, path)
+			return path.pathExpr, nil
+		}
+	}
+}
+
+// parseCall parses a function call. The opening parenthesis has been consumed.
+func (p *parser) parseCall(name string) (expr, error) {
+	switch name {
+	case "CAST":
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AS"); err != nil {
+			return nil, err
+		}
+		t := p.next()
+		typ, ok := castTypes[strings.ToUpper(t.s)]
+		if t.typ != tokIdent || !ok {
+			p.unread(t)
+			return nil, p.errorf("unknown CAST type")
+		}
+		return &castExpr{x: x, typ: typ}, p.expect(")")
+	}
+
+	if aggregateFuncs[name] {
+		if !p.allowAgg {
+			return nil, p.errorf("aggregate %s not allowed here", name)
+		}
+		if p.inAgg != "" {
+			// Report the position of the nested function name.
+			return nil, fmt.Errorf("s3select: nested aggregate %s inside %s at position %d", name, p.inAgg, p.toks[p.pos-2].pos)
+		}
+		agg := &aggExpr{fn: name, idx: len(p.aggs)}
+		if name == "COUNT" && p.accept("*") {
+			p.aggs = append(p.aggs, agg)
+			return agg, p.expect(")")
+		}
+		p.inAgg = name
+		arg, err := p.parseExpr()
+		p.inAgg = ""
+		if err != nil {
+			return nil, err
+		}
+		agg.arg = arg
+		p.aggs = append(p.aggs, agg)
+		return agg, p.expect(")")
+	}
+
+	f, ok := scalarFuncs[name]
+	if !ok {
+		p.pos -= 2
+		return nil, p.errorf("unknown function")
+	}
+	e := &callExpr{name: name, fn: f.fn, lazy: f.lazy}
+	if !p.accept(")") {
+		for {
+			a, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			e.args = append(e.args, a)
+			if name == "SUBSTRING" && len(e.args) == 1 && p.accept("FROM") {
+				// SUBSTRING(x FROM start [FOR length])
+				a, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				e.args = append(e.args, a)
+				if p.accept("FOR") {
+					if a, err = p.parseExpr(); err != nil {
+						return nil, err
+					}
+					e.args = append(e.args, a)
+				}
+				break
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(e.args) < f.minArgs || f.maxArgs >= 0 && len(e.args) > f.maxArgs {
+		return nil, fmt.Errorf("s3select: wrong number of arguments to %s: %d", name, len(e.args))
+	}
+	return e, nil
+}
@@ -0,0 +1,387 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package s3select evaluates a subset of S3 Select SQL directly
+// against records parsed by simdjson.
+//
+// The supported grammar is:
+//
+//	SELECT * | expr [[AS] alias], ...
+//	FROM S3Object [[AS] alias]
+//	[WHERE expr]
+//	[GROUP BY expr, ...]
+//	[LIMIT n]
+//
+// Expressions support paths (s.a.b, s."quoted key", s.arr[2]), literals,
+// arithmetic (+ - * / %), string concatenation (||), comparisons,
+// AND/OR/NOT, IS [NOT] NULL, IS [NOT] MISSING, [NOT] LIKE, [NOT] BETWEEN and [NOT] IN.
+//
+// Functions: CAST(x AS INT|FLOAT|STRING|BOOL), LOWER, UPPER, TRIM,
+// CHAR_LENGTH, SUBSTRING(x, start[, length]) or SUBSTRING(x FROM start [FOR length]),
+// COALESCE and NULLIF.
+//
+// Aggregates: COUNT(*), COUNT(x), SUM, AVG, MIN and MAX.
+// Strings containing numbers are aggregated as numbers.
+//
+// Field names are case sensitive, keywords and function names are not.
+// Integer division that is not exact returns a float.
+package s3select
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Query is a compiled query.
+// A Query is immutable and can be used by several evaluators concurrently.
+type Query struct {
+	sql     string
+	star    bool
+	cols    []column
+	where   expr
+	groupBy []expr
+	limit   int64
+	aggs    []*aggExpr
+
+	aggregate bool
+}
+
+type column struct {
+	name string
+	e    expr
+}
+
+// Compile compiles a query.
+func Compile(sql string) (*Query, error) {
+	return parseQuery(sql)
+}
+
+// String returns the original query.
+func (q *Query) String() string {
+	return q.sql
+}
+
+// Columns returns the names of the output columns.
+// For SELECT * nil is returned, since columns depend on the records.
+func (q *Query) Columns() []string {
+	if q.star {
+		return nil
+	}
+	names := make([]string, len(q.cols))
+	for i, c := range q.cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+// compile will resolve column names and validate aggregation.
+func (q *Query) compile() error {
+	q.aggregate = len(q.aggs) > 0 || len(q.groupBy) > 0
+	for i := range q.cols {
+		c := &q.cols[i]
+		if c.name != "" {
+			continue
+		}
+		if p, ok := c.e.(*pathExpr); ok && p.name() != "" {
+			c.name = p.name()
+		} else {
+			c.name = fmt.Sprintf("_%d", i+1)
+		}
+	}
+	if !q.aggregate {
+		return nil
+	}
+	if q.star {
+		return errors.New("s3select: SELECT * cannot be used with aggregation")
+	}
+	groups := make(map[string]int, len(q.groupBy))
+	for i, g := range q.groupBy {
+		groups[g.String()] = i
+	}
+	for i := range q.cols {
+		c := &q.cols[i]
+		var err error
+		c.e, err = walkExpr(c.e, func(e expr) (expr, error) {
+			if idx, ok := groups[e.String()]; ok {
+				return &groupRefExpr{idx: idx, expr: e}, nil
+			}
+			switch e := e.(type) {
+			case *aggExpr:
+				// Arguments are evaluated per record.
+				return e, nil
+			case *pathExpr:
+				return nil, fmt.Errorf("s3select: %s must appear in GROUP BY or be used in an aggregate", e)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// group contains the aggregation state of a group.
+type group struct {
+	key  []Value
+	accs []accumulator
+}
+
+// Evaluator evaluates a query against records.
+// An Evaluator cannot be used concurrently.
+type Evaluator struct {
+	q    *Query
+	w    RowWriter
+	ctx  evalCtx
+	rows int64
+
+	names  []string
+	vals   []Value
+	keyBuf []byte
+
+	single *group
+	groups map[string]*group
+	order  []*group
+
+	// interned keys for SELECT *, at most maxStarKeys.
+	keys map[string]string
+}
+
+// maxStarKeys is the maximum number of keys interned for SELECT *.
+// Other keys are allocated for every row.
+const maxStarKeys = 1024
+
+// NewEvaluator returns an evaluator that writes results to w.
+func (q *Query) NewEvaluator(w RowWriter) *Evaluator {
+	e := &Evaluator{q: q, w: w}
+	if !q.star {
+		e.names = q.Columns()
+	} else {
+		e.keys = make(map[string]string)
+	}
+	if len(q.groupBy) > 0 {
+		e.groups = make(map[string]*group)
+	}
+	return e
+}
+
+var errDone = errors.New("limit reached")
+
+// Done returns true when the LIMIT has been reached and further records are ignored.
+func (e *Evaluator) Done() bool {
+	return !e.q.aggregate && e.q.limit >= 0 && e.rows >= e.q.limit
+}
+
+// Eval evaluates the query against a single record.
+// The Iter should be a root element as returned by ParsedJson.ForEach.
+// Unless the query uses aggregation, matching rows are written immediately.
+func (e *Evaluator) Eval(root simdjson.Iter) error {
+	if e.Done() {
+		return nil
+	}
+	c := &e.ctx
+	c.root = root
+	c.group = nil
+	if e.q.where != nil {
+		v, err := e.q.where.eval(c)
+		if err != nil {
+			return err
+		}
+		if v.kind != KindBool || !v.b {
+			return nil
+		}
+	}
+	if e.q.aggregate {
+		return e.accumulate()
+	}
+	if e.q.star {
+		return e.writeStar()
+	}
+	return e.writeRow()
+}
+
+// EvalParsed evaluates the query against all records in pj.
+func (e *Evaluator) EvalParsed(pj *simdjson.ParsedJson) error {
+	err := pj.ForEach(func(i simdjson.Iter) error {
+		if e.Done() {
+			return errDone
+		}
+		return e.Eval(i)
+	})
+	if err == errDone {
+		return nil
+	}
+	return err
+}
+
+// EvalStream evaluates the query against all records received from a stream,
+// for example from simdjson.ParseNDStream.
+// Parsed blocks are sent to reuse, if it is non-nil and has room.
+// If the limit is reached or an error occurs, the remaining stream is drained.
+// The first stream error is returned, except io.EOF.
+func (e *Evaluator) EvalStream(in <-chan simdjson.Stream, reuse chan<- *simdjson.ParsedJson) error {
+	var err error
+	for block := range in {
+		if block.Error != nil {
+			if err == nil && !errors.Is(block.Error, io.EOF) {
+				err = block.Error
+			}
+		} else if err == nil && !e.Done() {
+			err = e.EvalParsed(block.Value)
+		}
+		if reuse != nil && block.Value != nil {
+			select {
+			case reuse <- block.Value:
+			default:
+			}
+		}
+	}
+	return err
+}
+
+// Close writes aggregated results and flushes the writer.
+func (e *Evaluator) Close() error {
+	if e.q.aggregate {
+		if len(e.q.groupBy) == 0 && e.single == nil {
+			// Aggregates without input still return a row.
+			e.single = e.newGroup(nil)
+			e.order = append(e.order, e.single)
+		}
+		for _, g := range e.order {
+			if e.q.limit >= 0 && e.rows >= e.q.limit {
+				break
+			}
+			e.ctx.group = g
+			if err := e.writeRow(); err != nil {
+				return err
+			}
+		}
+		e.ctx.group = nil
+	}
+	return e.w.Flush()
+}
+
+func (e *Evaluator) newGroup(key []Value) *group {
+	return &group{key: key, accs: make([]accumulator, len(e.q.aggs))}
+}
+
+// accumulate adds the current record to its group.
+func (e *Evaluator) accumulate() error {
+	c := &e.ctx
+	g := e.single
+	if len(e.q.groupBy) == 0 {
+		if g == nil {
+			g = e.newGroup(nil)
+			e.single = g
+			e.order = append(e.order, g)
+		}
+	} else {
+		e.vals = e.vals[:0]
+		e.keyBuf = e.keyBuf[:0]
+		for _, ge := range e.q.groupBy {
+			v, err := ge.eval(c)
+			if err != nil {
+				return err
+			}
+			e.vals = append(e.vals, v)
+			if e.keyBuf, err = v.appendKey(e.keyBuf); err != nil {
+				return err
+			}
+		}
+		g = e.groups[string(e.keyBuf)]
+		if g == nil {
+			key := make([]Value, len(e.vals))
+			for i, v := range e.vals {
+				var err error
+				if key[i], err = v.detach(); err != nil {
+					return err
+				}
+			}
+			g = e.newGroup(key)
+			e.groups[string(e.keyBuf)] = g
+			e.order = append(e.order, g)
+		}
+	}
+	for i, a := range e.q.aggs {
+		if err := a.accumulate(c, &g.accs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRow evaluates all columns and writes the row.
+func (e *Evaluator) writeRow() error {
+	e.vals = e.vals[:0]
+	for _, col := range e.q.cols {
+		v, err := col.e.eval(&e.ctx)
+		if err != nil {
+			return err
+		}
+		e.vals = append(e.vals, v)
+	}
+	e.rows++
+	return e.w.WriteRow(e.names, e.vals)
+}
+
+// writeStar writes all top level values of the record.
+func (e *Evaluator) writeStar() error {
+	e.names = e.names[:0]
+	e.vals = e.vals[:0]
+	root := e.ctx.root
+	switch root.Type() {
+	case simdjson.TypeObject:
+		obj, err := root.Object(&e.ctx.obj)
+		if err != nil {
+			return err
+		}
+		var elem simdjson.Iter
+		for {
+			name, t, err := obj.NextElementBytes(&elem)
+			if err != nil {
+				return err
+			}
+			if t == simdjson.TypeNone {
+				break
+			}
+			key, ok := e.keys[string(name)]
+			if !ok {
+				key = string(name)
+				if len(e.keys) < maxStarKeys {
+					e.keys[key] = key
+				}
+			}
+			v, err := valueFromIter(&elem)
+			if err != nil {
+				return err
+			}
+			e.names = append(e.names, key)
+			e.vals = append(e.vals, v)
+		}
+	default:
+		v, err := valueFromIter(&root)
+		if err != nil {
+			return err
+		}
+		e.names = append(e.names, "_1")
+		e.vals = append(e.vals, v)
+	}
+	e.rows++
+	return e.w.WriteRow(e.names, e.vals)
+}
@@ -0,0 +1,301 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+const testRecords = `{"a":"x","b":5,"c":{"d":"Hello"},"arr":[1,2,3]}
+{"a":"y","b":20,"c":{"d":"World"},"arr":[4]}
+{"a":"x","b":15,"c":{"d":null},"n":1.5}
+{"a":"x","b":30,"c":{"d":"  pad  "}}
+{"a":"y","b":"12"}
+`
+
+func runQuery(t *testing.T, sql string, csvOut bool) string {
+	t.Helper()
+	q, err := Compile(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pj, err := simdjson.ParseND([]byte(testRecords), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	if csvOut {
+		w = NewCSVWriter(&buf, true)
+	}
+	e := q.NewEvaluator(w)
+	if err := e.EvalParsed(pj); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestQuery(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{
+			sql:  `SELECT s.a, COUNT(*) FROM S3Object s WHERE s.b > 10 GROUP BY s.a`,
+			want: `{"a":"y","_2":2}` + "\n" + `{"a":"x","_2":2}` + "\n",
+		},
+		{
+			sql:  `SELECT a AS name, b * 2 AS double FROM S3Object WHERE b < 20 LIMIT 1`,
+			want: `{"name":"x","double":10}` + "\n",
+		},
+		{
+			// Missing values are also NULL.
+			sql:  `SELECT s.c.d FROM S3Object s WHERE s.c.d IS NULL`,
+			want: `{"d":null}` + "\n" + `{}` + "\n",
+		},
+		{
+			sql:  `SELECT LOWER(s.c.d) AS l, UPPER(s.a) AS u, SUBSTRING(s.c.d FROM 2 FOR 3) AS sub FROM S3Object s WHERE s.c.d LIKE 'H%'`,
+			want: `{"l":"hello","u":"X","sub":"ell"}` + "\n",
+		},
+		{
+			sql:  `SELECT TRIM(s.c.d) AS t, CHAR_LENGTH(s.c.d) AS n FROM S3Object s WHERE s.b = 30`,
+			want: `{"t":"pad","n":7}` + "\n",
+		},
+		{
+			sql:  `SELECT COALESCE(s.n, s.c.d, 'none') AS v FROM S3Object s WHERE s.a = 'x'`,
+			want: `{"v":"Hello"}` + "\n" + `{"v":1.5}` + "\n" + `{"v":"  pad  "}` + "\n",
+		},
+		{
+			sql:  `SELECT CAST(s.b AS INT) + 1 AS b FROM S3Object s WHERE s.a = 'y'`,
+			want: `{"b":21}` + "\n" + `{"b":13}` + "\n",
+		},
+		{
+			sql:  `SELECT s.arr[1] AS second FROM S3Object s WHERE s.arr IS NOT MISSING`,
+			want: `{"second":2}` + "\n" + `{}` + "\n",
+		},
+		{
+			sql:  `SELECT s.b FROM S3Object s WHERE s.b BETWEEN 10 AND 20 AND s.a IN ('x', 'z')`,
+			want: `{"b":15}` + "\n",
+		},
+		{
+			sql:  `SELECT COUNT(*), SUM(s.b), MIN(s.b), MAX(s.b), AVG(s.b) FROM S3Object s WHERE s.a = 'x'`,
+			want: `{"_1":3,"_2":50,"_3":5,"_4":30,"_5":16.666666666666668}` + "\n",
+		},
+		{
+			// Strings containing numbers are aggregated as numbers.
+			sql:  `SELECT SUM(s.b), MIN(s.b), MAX(s.b) FROM S3Object s WHERE s.b < 13`,
+			want: `{"_1":17,"_2":5,"_3":12}` + "\n",
+		},
+		{
+			sql:  `SELECT COUNT(*) AS n FROM S3Object WHERE a = 'none'`,
+			want: `{"n":0}` + "\n",
+		},
+		{
+			sql:  `SELECT * FROM S3Object s WHERE s.b = 20`,
+			want: `{"a":"y","b":20,"c":{"d":"World"},"arr":[4]}` + "\n",
+		},
+		{
+			sql:  `SELECT s.a FROM S3Object s LIMIT 0`,
+			want: ``,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			got := runQuery(t, test.sql, false)
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQueryCSV(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	got := runQuery(t, `SELECT s.a, s.c.d, s.arr FROM S3Object s LIMIT 3`, true)
+	want := "a,d,arr\nx,Hello,\"[1,2,3]\"\ny,World,[4]\nx,,\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: `SELECT`, want: "got end of query"},
+		{sql: `SELECT a FROM table`, want: "S3Object"},
+		{sql: `SELECT a, COUNT(*) FROM S3Object`, want: "GROUP BY"},
+		{sql: `SELECT * FROM S3Object GROUP BY a`, want: "aggregation"},
+		{sql: `SELECT a FROM S3Object WHERE COUNT(*) > 1`, want: "aggregate"},
+		{sql: `SELECT SUM(COUNT(*)) FROM S3Object`, want: "aggregate"},
+		{sql: `SELECT NOSUCH(a) FROM S3Object`, want: "NOSUCH"},
+		{sql: `SELECT 'abc FROM S3Object`, want: "unterminated"},
+		{sql: `SELECT a FROM S3Object LIMIT -1`, want: "limit"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.sql)
+		if err == nil {
+			t.Errorf("%s: expected error", test.sql)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q does not contain %q", test.sql, err, test.want)
+		}
+	}
+}
+
+func TestCompileNestedAggregate(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{sql: `SELECT SUM(COUNT(*)) FROM S3Object`, want: "s3select: nested aggregate COUNT inside SUM at position 11"},
+		{sql: `SELECT MAX(1 + min(a)) FROM S3Object`, want: "s3select: nested aggregate MIN inside MAX at position 15"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.sql)
+		if err == nil {
+			t.Errorf("%s: expected error", test.sql)
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("%s: got error %q, want %q", test.sql, err, test.want)
+		}
+	}
+}
+
+func TestEvalStream(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	q, err := Compile(`SELECT s.b FROM S3Object s LIMIT 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pj, err := simdjson.ParseND([]byte(testRecords), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errParse := errors.New("parse error")
+	tests := []struct {
+		name    string
+		errs    []error
+		want    string
+		wantErr error
+	}{
+		{name: "eof", errs: []error{fmt.Errorf("reading: %w", io.EOF)}, want: `{"b":5}` + "\n"},
+		{name: "error", errs: []error{errParse, io.EOF}, want: `{"b":5}` + "\n", wantErr: errParse},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Values must be returned after the limit and after errors.
+			in := make(chan simdjson.Stream, 10)
+			in <- simdjson.Stream{Value: pj.Clone(nil)}
+			in <- simdjson.Stream{Value: pj.Clone(nil)}
+			in <- simdjson.Stream{Error: test.errs[0]}
+			in <- simdjson.Stream{Value: pj.Clone(nil)}
+			for _, err := range test.errs[1:] {
+				in <- simdjson.Stream{Error: err}
+			}
+			close(in)
+			reuse := make(chan *simdjson.ParsedJson, 10)
+			var buf bytes.Buffer
+			e := q.NewEvaluator(NewNDJSONWriter(&buf))
+			if err := e.EvalStream(in, reuse); err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if len(reuse) != 3 {
+				t.Errorf("got %d values returned, want 3", len(reuse))
+			}
+		})
+	}
+
+	// The stream must be drained when the limit is reached.
+	var sb strings.Builder
+	for i := 0; i < 500000; i++ {
+		fmt.Fprintf(&sb, `{"b":%d,"s":"%s"}`+"\n", i, strings.Repeat("x", i%64))
+	}
+	res := make(chan simdjson.Stream)
+	simdjson.ParseNDStream(strings.NewReader(sb.String()), res, make(chan *simdjson.ParsedJson, 10))
+	var buf bytes.Buffer
+	e := q.NewEvaluator(NewNDJSONWriter(&buf))
+	if err := e.EvalStream(res, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != `{"b":0}`+"\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSelectStarKeys(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	q, err := Compile(`SELECT * FROM S3Object`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in strings.Builder
+	for i := 0; i < maxStarKeys+10; i++ {
+		fmt.Fprintf(&in, `{"k%d":%d}`+"\n", i, i)
+	}
+	fmt.Fprintf(&in, `{"k%d":0}`+"\n", maxStarKeys+5)
+	pj, err := simdjson.ParseND([]byte(in.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	e := q.NewEvaluator(NewNDJSONWriter(&buf))
+	if err := e.EvalParsed(pj); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.keys) != maxStarKeys {
+		t.Errorf("got %d interned keys, want %d", len(e.keys), maxStarKeys)
+	}
+	// The output is the same as the input.
+	if buf.String() != in.String() {
+		t.Error("output mismatch")
+	}
+}
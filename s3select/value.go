@@ -0,0 +1,349 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package s3select
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/minio/simdjson-go"
+)
+
+// Kind is the type of a Value.
+type Kind uint8
+
+const (
+	// KindMissing is a value that was not found in the record.
+	KindMissing Kind = iota
+	KindNull
+	KindBool
+	KindInt
+	KindFloat
+	KindString
+	KindObject
+	KindArray
+)
+
+// String returns the kind as a string.
+func (k Kind) String() string {
+	switch k {
+	case KindMissing:
+		return "missing"
+	case KindNull:
+		return "null"
+	case KindBool:
+		return "bool"
+	case KindInt:
+		return "int"
+	case KindFloat:
+		return "float"
+	case KindString:
+		return "string"
+	case KindObject:
+		return "object"
+	case KindArray:
+		return "array"
+	}
+	return "unknown"
+}
+
+// Value is the result of evaluating an expression.
+// Values may reference the tape of the record being evaluated,
+// so they are only valid until the next record is evaluated.
+type Value struct {
+	kind Kind
+	b    bool
+	i    int64
+	f    float64
+	s    []byte
+
+	// Objects and arrays either reference the tape or contain marshalled JSON.
+	iter simdjson.Iter
+	raw  []byte
+}
+
+var (
+	missingValue = Value{kind: KindMissing}
+	nullValue    = Value{kind: KindNull}
+)
+
+func boolValue(b bool) Value {
+	return Value{kind: KindBool, b: b}
+}
+
+func intValue(i int64) Value {
+	return Value{kind: KindInt, i: i}
+}
+
+func floatValue(f float64) Value {
+	return Value{kind: KindFloat, f: f}
+}
+
+func stringValue(s []byte) Value {
+	return Value{kind: KindString, s: s}
+}
+
+// Kind returns the kind of the value.
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+// IsNull returns whether the value is null or missing.
+func (v Value) IsNull() bool {
+	return v.kind <= KindNull
+}
+
+// Bool returns the value as a bool, if it is a bool.
+func (v Value) Bool() (bool, bool) {
+	return v.b, v.kind == KindBool
+}
+
+// Int returns the value as an int, if it is an int.
+func (v Value) Int() (int64, bool) {
+	return v.i, v.kind == KindInt
+}
+
+// Float returns the value as a float, if it is numeric.
+func (v Value) Float() (float64, bool) {
+	switch v.kind {
+	case KindInt:
+		return float64(v.i), true
+	case KindFloat:
+		return v.f, true
+	}
+	return 0, false
+}
+
+// StringBytes returns the value of a string.
+func (v Value) StringBytes() ([]byte, bool) {
+	return v.s, v.kind == KindString
+}
+
+// valueFromIter returns the value of the current element of i.
+func valueFromIter(i *simdjson.Iter) (Value, error) {
+	switch i.Type() {
+	case simdjson.TypeNull:
+		return nullValue, nil
+	case simdjson.TypeBool:
+		b, err := i.Bool()
+		return boolValue(b), err
+	case simdjson.TypeInt:
+		v, err := i.Int()
+		return intValue(v), err
+	case simdjson.TypeUint:
+		v, err := i.Uint()
+		if v > math.MaxInt64 {
+			return floatValue(float64(v)), err
+		}
+		return intValue(int64(v)), err
+	case simdjson.TypeFloat:
+		v, err := i.Float()
+		return floatValue(v), err
+	case simdjson.TypeString:
+		v, err := i.StringBytes()
+		return stringValue(v), err
+	case simdjson.TypeObject:
+		return Value{kind: KindObject, iter: *i}, nil
+	case simdjson.TypeArray:
+		return Value{kind: KindArray, iter: *i}, nil
+	}
+	return missingValue, nil
+}
+
+// detach returns a copy of the value that does not reference the tape.
+func (v Value) detach() (Value, error) {
+	switch v.kind {
+	case KindString:
+		v.s = append([]byte{}, v.s...)
+	case KindObject, KindArray:
+		if v.raw == nil {
+			var err error
+			v.raw, err = v.iter.MarshalJSON()
+			if err != nil {
+				return v, err
+			}
+			v.iter = simdjson.Iter{}
+		}
+	}
+	return v, nil
+}
+
+// AppendJSON appends the value as JSON.
+// Missing values are appended as null.
+func (v Value) AppendJSON(dst []byte) ([]byte, error) {
+	switch v.kind {
+	case KindBool:
+		return strconv.AppendBool(dst, v.b), nil
+	case KindInt:
+		return strconv.AppendInt(dst, v.i, 10), nil
+	case KindFloat:
+		if math.IsNaN(v.f) || math.IsInf(v.f, 0) {
+			return append(dst, "null"...), nil
+		}
+		return strconv.AppendFloat(dst, v.f, 'g', -1, 64), nil
+	case KindString:
+		return appendJSONString(dst, v.s), nil
+	case KindObject, KindArray:
+		if v.raw != nil {
+			return append(dst, v.raw...), nil
+		}
+		return v.iter.MarshalJSONBuffer(dst)
+	}
+	return append(dst, "null"...), nil
+}
+
+// AppendText appends the value as text.
+// Strings are appended without quotes, null and missing values are empty
+// and objects and arrays are appended as JSON.
+func (v Value) AppendText(dst []byte) ([]byte, error) {
+	switch v.kind {
+	case KindMissing, KindNull:
+		return dst, nil
+	case KindString:
+		return append(dst, v.s...), nil
+	}
+	return v.AppendJSON(dst)
+}
+
+// appendKey appends a representation of the value usable as a map key.
+func (v Value) appendKey(dst []byte) ([]byte, error) {
+	if f, ok := v.Float(); ok {
+		// Numbers compare equal regardless of representation.
+		dst = append(dst, byte(KindFloat))
+		return strconv.AppendFloat(dst, f, 'g', -1, 64), nil
+	}
+	dst = append(dst, byte(v.kind))
+	switch v.kind {
+	case KindString:
+		dst = strconv.AppendInt(dst, int64(len(v.s)), 10)
+		dst = append(dst, ':')
+		return append(dst, v.s...), nil
+	case KindBool:
+		return strconv.AppendBool(dst, v.b), nil
+	case KindObject, KindArray:
+		js, err := v.AppendJSON(nil)
+		if err != nil {
+			return dst, err
+		}
+		dst = strconv.AppendInt(dst, int64(len(js)), 10)
+		dst = append(dst, ':')
+		return append(dst, js...), nil
+	}
+	return dst, nil
+}
+
+// numeric returns v as a number.
+// Strings are converted if they contain a valid number.
+func (v Value) numeric() (Value, bool) {
+	switch v.kind {
+	case KindInt, KindFloat:
+		return v, true
+	case KindString:
+		s := string(bytes.TrimSpace(v.s))
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return intValue(i), true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return floatValue(f), true
+		}
+	}
+	return v, false
+}
+
+// compare a and b.
+// If the values cannot be compared ok is false.
+func compare(a, b Value) (cmp int, ok bool) {
+	if a.kind == KindString && b.kind == KindString {
+		return bytes.Compare(a.s, b.s), true
+	}
+	if a.kind == KindBool && b.kind == KindBool {
+		switch {
+		case a.b == b.b:
+			return 0, true
+		case b.b:
+			return -1, true
+		}
+		return 1, true
+	}
+	a, aok := a.numeric()
+	b, bok := b.numeric()
+	if !aok || !bok {
+		return 0, false
+	}
+	if a.kind == KindInt && b.kind == KindInt {
+		switch {
+		case a.i < b.i:
+			return -1, true
+		case a.i > b.i:
+			return 1, true
+		}
+		return 0, true
+	}
+	af, _ := a.Float()
+	bf, _ := b.Float()
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	case af == bf:
+		return 0, true
+	}
+	// NaN
+	return 0, false
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends s as a quoted JSON string.
+func appendJSONString(dst, s []byte) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			dst = append(dst, c)
+			i++
+			continue
+		}
+		if c < utf8.RuneSelf {
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, `�`...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
@@ -45,12 +45,27 @@ func newInternalParsedJson(reuse *ParsedJson, opts []ParserOption) (*internalPar
 		pj = reuse.internal
 		pj.ParsedJson = *reuse
 		pj.ParsedJson.internal = nil
+		// Keep the settings, but not the indexes of the previous tape.
+		if m := pj.meta; m != nil {
+			pj.meta = nil
+			if m.nonFinite != NonFiniteError {
+				pj.meta = &tapeMeta{nonFinite: m.nonFinite}
+			}
+		}
 		reuse = &ParsedJson{}
 	}
 	if pj == nil {
 		pj = &internalParsedJson{}
 	}
 	pj.copyStrings = true
+	pj.compact = false
+	pj.floatPrecision = false
+	pj.recordIndex = false
+	pj.internMaxLen = 0
+	pj.hintTape, pj.hintStrings = 0, 0
+	if pj.sizes == nil {
+		pj.sizes = &sizeHints{}
+	}
 	for _, opt := range opts {
 		if err := opt(pj); err != nil {
 			return nil, err
@@ -86,7 +101,9 @@ func ParseND(b []byte, reuse *ParsedJson, opts ...ParserOption) (*ParsedJson, er
 	if err != nil {
 		return nil, err
 	}
-	return &pj.ParsedJson, nil
+	parsed := &pj.ParsedJson
+	parsed.internal = pj
+	return parsed, nil
 }
 
 // A Stream is used to stream back results.
@@ -106,9 +123,13 @@ type Stream struct {
 // A stream is finished when a non-nil Error is returned.
 // If the stream was parsed until the end the Error value will be io.EOF
 // The channel will be closed after an error has been returned.
+//
 // An optional channel for returning consumed results can be provided.
 // There is no guarantee that elements will be consumed, so always use
 // non-blocking writes to the reuse channel.
+// Input is parsed by a fixed number of workers, each keeping its own
+// internal parser state for the duration of the stream.
+// Workers take values from reuse before allocating new ones, but never wait for them.
 func ParseNDStream(r io.Reader, res chan<- Stream, reuse <-chan *ParsedJson) {
 	if !SupportedCPU() {
 		go func() {
@@ -127,6 +148,7 @@ func ParseNDStream(r io.Reader, res chan<- Stream, reuse <-chan *ParsedJson) {
 	}}
 	conc := (runtime.GOMAXPROCS(0) + 1) / 2
 	queue := make(chan chan Stream, conc)
+	jobs := make(chan streamJob, conc)
 	go func() {
 		// Forward finished items in order.
 		defer close(res)
@@ -146,8 +168,14 @@ func ParseNDStream(r io.Reader, res chan<- Stream, reuse <-chan *ParsedJson) {
 			}
 		}
 	}()
+	// Sizes are learned from all blocks of the stream.
+	sizes := &sizeHints{}
+	for i := 0; i < conc; i++ {
+		go streamWorker(jobs, reuse, &tmpPool, tmpSize+1024, sizes)
+	}
 	go func() {
 		defer close(queue)
+		defer close(jobs)
 		for {
 			tmp := tmpPool.Get().([]byte)
 			tmp = tmp[:tmpSize]
@@ -170,35 +198,9 @@ func ParseNDStream(r io.Reader, res chan<- Stream, reuse <-chan *ParsedJson) {
 			}
 
 			if len(tmp) > 0 {
-				result := make(chan Stream, 0)
+				result := make(chan Stream, 1)
 				queue <- result
-				go func() {
-					var pj internalParsedJson
-					pj.copyStrings = true
-					select {
-					case v := <-reuse:
-						if cap(v.Message) >= tmpSize+1024 {
-							tmpPool.Put(v.Message)
-							v.Message = nil
-						}
-						pj.ParsedJson = *v
-
-					default:
-					}
-					parseErr := pj.parseMessage(tmp, true)
-					if parseErr != nil {
-						result <- Stream{
-							Value: nil,
-							Error: fmt.Errorf("parsing input: %w", parseErr),
-						}
-						return
-					}
-					parsed := pj.ParsedJson
-					result <- Stream{
-						Value: &parsed,
-						Error: nil,
-					}
-				}()
+				jobs <- streamJob{input: tmp, result: result}
 			} else {
 				tmpPool.Put(tmp)
 			}
@@ -211,6 +213,62 @@ func ParseNDStream(r io.Reader, res chan<- Stream, reuse <-chan *ParsedJson) {
 	}()
 }
 
+// streamJob is a block of input for a stream worker.
+// The result is sent on the result channel.
+type streamJob struct {
+	input  []byte
+	result chan<- Stream
+}
+
+// streamWorker parses jobs until the jobs channel is closed.
+// The internal parser state is kept between jobs.
+// Output values are taken from reuse when available and allocated otherwise.
+// Messages of reused values with a capacity of at least poolSize are added to tmpPool.
+func streamWorker(jobs <-chan streamJob, reuse <-chan *ParsedJson, tmpPool *sync.Pool, poolSize int, sizes *sizeHints) {
+	pj := internalParsedJson{copyStrings: true, sizes: sizes}
+	var spare *ParsedJson // value that was not sent
+
+	// get returns an output value.
+	get := func() *ParsedJson {
+		if spare != nil {
+			v := spare
+			spare = nil
+			return v
+		}
+		select {
+		case v := <-reuse:
+			if v != nil {
+				if cap(v.Message) >= poolSize {
+					tmpPool.Put(v.Message[:0])
+				}
+				return v
+			}
+		default:
+		}
+		return &ParsedJson{}
+	}
+
+	for job := range jobs {
+		v := get()
+		pj.ParsedJson = ParsedJson{Tape: v.Tape, Strings: v.Strings}
+		if err := pj.parseMessage(job.input, true); err != nil {
+			spare = v
+			job.result <- Stream{
+				Value: nil,
+				Error: fmt.Errorf("parsing input: %w", err),
+			}
+			continue
+		}
+		*v = pj.ParsedJson
+		// The output buffers now belong to the consumer.
+		pj.ParsedJson = ParsedJson{}
+		job.result <- Stream{
+			Value: v,
+			Error: nil,
+		}
+	}
+}
+
 func queueError(queue chan chan Stream, err error) {
 	result := make(chan Stream, 0)
 	queue <- result
@@ -0,0 +1,202 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjsontest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+// UpdateEnv is the environment variable that makes the golden file
+// assertions write files instead of comparing them, when set to a true value like 1.
+const UpdateEnv = "SIMDJSONTEST_UPDATE"
+
+// update returns whether golden files should be rewritten instead of compared.
+func update() bool {
+	v, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	return v
+}
+
+// AssertGolden compares got to the content of the golden file.
+// When the SIMDJSONTEST_UPDATE environment variable is set to 1 the file is written instead.
+// Returns whether the content matched.
+func AssertGolden(t testing.TB, file string, got []byte) bool {
+	t.Helper()
+	if update() {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run with SIMDJSONTEST_UPDATE=1 to create it)", err)
+		return false
+	}
+	if bytes.Equal(got, want) {
+		return true
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("%s: line %d differs:\n\tgot:  %s\n\twant: %s", file, i+1, g, w)
+			break
+		}
+	}
+	return false
+}
+
+// AssertGoldenJSON compares the indented JSON of i to the golden file.
+// If i contains several root elements each is written separately.
+func AssertGoldenJSON(t testing.TB, file string, i simdjson.Iter) bool {
+	t.Helper()
+	b, err := i.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for dec.More() {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Indent(&buf, v, "", "  "); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteByte('\n')
+	}
+	return AssertGolden(t, file, buf.Bytes())
+}
+
+// AssertGoldenTape compares the tape of pj, as printed by TapeString, to the golden file.
+func AssertGoldenTape(t testing.TB, file string, pj *simdjson.ParsedJson) bool {
+	t.Helper()
+	s, err := TapeString(pj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return AssertGolden(t, file, []byte(s))
+}
+
+// TapeString returns the tape with one entry per line.
+// Each line has the tape offset, the tag and the value.
+// Objects, arrays and roots show the offset they point to.
+func TapeString(pj *simdjson.ParsedJson) (string, error) {
+	var sb strings.Builder
+	tape := pj.Tape
+	depth := 0
+	for off := 0; off < len(tape); off++ {
+		v := tape[off]
+		tag := simdjson.Tag(v >> simdjson.JSONTAGOFFSET)
+		payload := v & simdjson.JSONVALUEMASK
+		switch tag {
+		case simdjson.TagObjectEnd, simdjson.TagArrayEnd:
+			depth--
+		case simdjson.TagRoot:
+			if int(payload) < off {
+				depth--
+			}
+		}
+		if depth < 0 {
+			return sb.String(), fmt.Errorf("unbalanced %v at offset %d", tag, off)
+		}
+		fmt.Fprintf(&sb, "%4d: %s%c", off, strings.Repeat("  ", depth), byte(tag))
+		switch tag {
+		case simdjson.TagObjectStart, simdjson.TagArrayStart, simdjson.TagObjectEnd, simdjson.TagArrayEnd:
+			fmt.Fprintf(&sb, " -> %d", payload)
+		case simdjson.TagRoot:
+			fmt.Fprintf(&sb, " -> %d", payload)
+			if int(payload) > off {
+				depth++
+			}
+		case simdjson.TagStringInline:
+			n := int(payload>>48) & 0xff
+			if n > 6 {
+				return sb.String(), fmt.Errorf("inline string too long at offset %d", off)
+			}
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], payload)
+			sb.WriteString(" " + strconv.Quote(string(b[:n])))
+		case simdjson.TagIntegerInline:
+			sb.WriteString(" " + strconv.FormatInt(int64(payload<<8)>>8, 10))
+		case simdjson.TagString, simdjson.TagInteger, simdjson.TagUint, simdjson.TagFloat:
+			if off+1 >= len(tape) {
+				return sb.String(), fmt.Errorf("value beyond tape at offset %d", off)
+			}
+			off++
+			switch tag {
+			case simdjson.TagString:
+				s, err := tapeString(pj, payload, tape[off])
+				if err != nil {
+					return sb.String(), err
+				}
+				sb.WriteString(" " + strconv.Quote(s))
+			case simdjson.TagInteger:
+				sb.WriteString(" " + strconv.FormatInt(int64(tape[off]), 10))
+			case simdjson.TagUint:
+				sb.WriteString(" " + strconv.FormatUint(tape[off], 10))
+			case simdjson.TagFloat:
+				sb.WriteString(" " + strconv.FormatFloat(math.Float64frombits(tape[off]), 'g', -1, 64))
+			}
+		}
+		switch tag {
+		case simdjson.TagObjectStart, simdjson.TagArrayStart:
+			depth++
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// tapeString returns the string at the offset and length stored on the tape.
+func tapeString(pj *simdjson.ParsedJson, offset, length uint64) (string, error) {
+	src := pj.Message
+	if offset&simdjson.STRINGBUFBIT != 0 {
+		if pj.Strings == nil {
+			return "", errors.New("string buffer missing")
+		}
+		src = pj.Strings.B
+		offset &= simdjson.STRINGBUFMASK
+	}
+	if offset+length > uint64(len(src)) {
+		return "", fmt.Errorf("string offset %d outside buffer (%d)", offset+length, len(src))
+	}
+	return string(src[offset : offset+length]), nil
+}
@@ -0,0 +1,226 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package simdjsontest provides helpers for testing code that uses simdjson-go.
+package simdjsontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+// MustParse parses a JSON document and fails the test on errors.
+func MustParse(t testing.TB, s string, opts ...simdjson.ParserOption) *simdjson.ParsedJson {
+	t.Helper()
+	pj, err := simdjson.Parse([]byte(s), nil, opts...)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", s, err)
+	}
+	return pj
+}
+
+// MustParseND parses newline delimited JSON and fails the test on errors.
+func MustParseND(t testing.TB, s string, opts ...simdjson.ParserOption) *simdjson.ParsedJson {
+	t.Helper()
+	pj, err := simdjson.ParseND([]byte(s), nil, opts...)
+	if err != nil {
+		t.Fatalf("parsing ndjson: %v", err)
+	}
+	return pj
+}
+
+// AssertJSONEqual checks that got is semantically equal to the JSON in want.
+// Object keys are compared regardless of order and numbers are compared by value,
+// so 1 and 1.0 are equal.
+// If they differ the test is marked as failed with the path of each difference.
+// For iterators from ParsedJson.Iter the first root element is compared.
+// Returns whether the values are equal.
+func AssertJSONEqual(t testing.TB, got simdjson.Iter, want string) bool {
+	t.Helper()
+	// Wrap in an array, so scalar values can be parsed.
+	pj, err := simdjson.Parse([]byte("["+want+"]"), nil)
+	if err != nil {
+		t.Fatalf("parsing want %q: %v", want, err)
+		return false
+	}
+	w, err := value(pj.Iter())
+	if err != nil {
+		t.Fatalf("parsing want %q: %v", want, err)
+		return false
+	}
+	return assertEqual(t, got, w.([]interface{})[0])
+}
+
+// AssertIterEqual checks that got is semantically equal to want, like AssertJSONEqual.
+func AssertIterEqual(t testing.TB, got, want simdjson.Iter) bool {
+	t.Helper()
+	w, err := value(want)
+	if err != nil {
+		t.Fatalf("want: %v", err)
+		return false
+	}
+	return assertEqual(t, got, w)
+}
+
+func assertEqual(t testing.TB, got simdjson.Iter, want interface{}) bool {
+	t.Helper()
+	g, err := value(got)
+	if err != nil {
+		t.Errorf("got: %v", err)
+		return false
+	}
+	diffs := Diff(g, want)
+	if len(diffs) == 0 {
+		return true
+	}
+	t.Errorf("JSON values differ:\n\t%s", strings.Join(diffs, "\n\t"))
+	return false
+}
+
+// value returns the content of the iterator as returned by Iter.Interface.
+func value(i simdjson.Iter) (interface{}, error) {
+	if i.Type() == simdjson.TypeNone {
+		i.AdvanceInto()
+	}
+	if i.Type() == simdjson.TypeRoot {
+		_, r, err := i.Root(nil)
+		if err != nil {
+			return nil, err
+		}
+		i = *r
+	}
+	return i.Interface()
+}
+
+// Diff returns the differences between two values as returned by Iter.Interface.
+// Each difference is described as "path: got x, want y".
+func Diff(got, want interface{}) []string {
+	return diff(nil, nil, got, want)
+}
+
+func diff(dst []string, p simdjson.Path, got, want interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(g)+len(w))
+		for k := range g {
+			keys = append(keys, k)
+		}
+		for k := range w {
+			if _, ok := g[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			kp := append(p, simdjson.PathKey(k))
+			gv, gok := g[k]
+			wv, wok := w[k]
+			switch {
+			case !gok:
+				dst = append(dst, fmt.Sprintf("%s: missing, want %s", pathString(kp), format(wv)))
+			case !wok:
+				dst = append(dst, fmt.Sprintf("%s: got %s, want no value", pathString(kp), format(gv)))
+			default:
+				dst = diff(dst, kp, gv, wv)
+			}
+		}
+		return dst
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(g) || i < len(w); i++ {
+			ip := append(p, simdjson.PathIndex(i))
+			switch {
+			case i >= len(g):
+				dst = append(dst, fmt.Sprintf("%s: missing, want %s", pathString(ip), format(w[i])))
+			case i >= len(w):
+				dst = append(dst, fmt.Sprintf("%s: got %s, want no value", pathString(ip), format(g[i])))
+			default:
+				dst = diff(dst, ip, g[i], w[i])
+			}
+		}
+		return dst
+	case int64, uint64, float64:
+		if numberEqual(got, want) {
+			return dst
+		}
+	default:
+		if got == want {
+			return dst
+		}
+	}
+	return append(dst, fmt.Sprintf("%s: got %s, want %s", pathString(p), format(got), format(want)))
+}
+
+// numberEqual compares numbers by value.
+func numberEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return a == b
+		case uint64:
+			return a >= 0 && uint64(a) == b
+		case float64:
+			return b == math.Trunc(b) && b >= -(1<<63) && b < 1<<63 && int64(b) == a
+		}
+	case uint64:
+		switch b := b.(type) {
+		case int64:
+			return b >= 0 && uint64(b) == a
+		case uint64:
+			return a == b
+		case float64:
+			return b == math.Trunc(b) && b >= 0 && b < 1<<64 && uint64(b) == a
+		}
+	case float64:
+		switch b.(type) {
+		case int64, uint64:
+			return numberEqual(b, a)
+		case float64:
+			return a == b
+		}
+	}
+	return false
+}
+
+func pathString(p simdjson.Path) string {
+	if len(p) == 0 {
+		return "(root)"
+	}
+	return p.String()
+}
+
+// format returns v as JSON.
+func format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
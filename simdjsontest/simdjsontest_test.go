@@ -0,0 +1,119 @@
+/*
+ * MinIO Cloud Storage, (C) 2020 MinIO, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simdjsontest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/minio/simdjson-go"
+)
+
+// recorder records failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertJSONEqual(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	pj := MustParse(t, `{"a":1,"b":[1.5,"x",{"c":null}],"d":true,"u":18446744073709551615}`)
+	if !AssertJSONEqual(t, pj.Iter(), `{"u":18446744073709551615,"d":true,"b":[1.5,"x",{"c":null}],"a":1.0}`) {
+		t.Error("expected equal")
+	}
+
+	var e simdjson.Element
+	i := pj.Iter()
+	if _, err := i.FindElement(&e, "b"); err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{TB: t}
+	if AssertJSONEqual(r, e.Iter, `[1.5,"y",{"c":0,"e":1},2]`) {
+		t.Error("expected difference")
+	}
+	want := []string{"JSON values differ:\n" +
+		"\t[1]: got \"x\", want \"y\"\n" +
+		"\t[2].c: got null, want 0\n" +
+		"\t[2].e: missing, want 1\n" +
+		"\t[3]: missing, want 2"}
+	if !reflect.DeepEqual(r.errors, want) {
+		t.Errorf("got %q, want %q", r.errors, want)
+	}
+
+	// Scalars and records.
+	nd := MustParseND(t, "{\"a\":2}\n{\"a\":3}\n")
+	n := 0
+	err := nd.ForEach(func(i simdjson.Iter) error {
+		n++
+		AssertJSONEqual(t, i, fmt.Sprintf(`{"a":%d}`, n+1))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.FindElement(&e, "a"); err != nil {
+		t.Fatal(err)
+	}
+	AssertJSONEqual(t, e.Iter, `1`)
+	AssertIterEqual(t, pj.Iter(), pj.Iter())
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		got, want interface{}
+		equal     bool
+	}{
+		{got: int64(1), want: float64(1), equal: true},
+		{got: uint64(1 << 63), want: float64(1 << 63), equal: true},
+		{got: int64(-1), want: uint64(1<<64 - 1)},
+		{got: int64(1<<53 + 1), want: float64(1 << 53)},
+		{got: "1", want: int64(1)},
+		{got: []interface{}{}, want: map[string]interface{}{}},
+		{got: nil, want: nil, equal: true},
+	}
+	for _, test := range tests {
+		if got := Diff(test.got, test.want); (len(got) == 0) != test.equal {
+			t.Errorf("%v %v: got %q", test.got, test.want, got)
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.SkipNow()
+	}
+	pj := MustParseND(t, "{\"a\":[1,-2,1.5,\"s\\n\"],\"b\":{\"c\":true,\"d\":null}}\n[false]\n")
+	AssertGoldenTape(t, "testdata/tape.golden", pj)
+	AssertGoldenJSON(t, "testdata/json.golden", pj.Iter())
+
+	if update() {
+		return
+	}
+	r := &recorder{TB: t}
+	if AssertGolden(r, "testdata/json.golden", []byte("{}\n")) || len(r.errors) != 1 {
+		t.Errorf("expected golden mismatch, got %q", r.errors)
+	}
+}
@@ -69,7 +69,7 @@ func peekSize(pj *internalParsedJson) uint64 {
 	return uint64(pj.indexesChan.indexes[pj.indexesChan.index])
 }
 
-func parseString(pj *ParsedJson, idx uint64, maxStringSize uint64, needCopy bool) bool {
+func parseString(pj *internalParsedJson, idx uint64, maxStringSize uint64, needCopy bool) bool {
 	size := uint64(0)
 	buf := pj.Message[idx:]
 	// Make sure that we have at least one full YMM word available after maxStringSize into the buffer
@@ -87,6 +87,10 @@ func parseString(pj *ParsedJson, idx uint64, maxStringSize uint64, needCopy bool
 	if !parseStringSimdValidateOnly(buf, &maxStringSize, &size, &needCopy) {
 		return false
 	}
+	if pj.compact && size <= maxInlineString && !needCopy {
+		pj.Tape = append(pj.Tape, inlineStringEntry(pj.Message[idx+1:idx+1+size]))
+		return true
+	}
 	if !needCopy {
 		pj.write_tape(idx+1, '"')
 	} else {
@@ -104,19 +108,35 @@ func parseString(pj *ParsedJson, idx uint64, maxStringSize uint64, needCopy bool
 		}
 		start := len(strs)
 		_ = parseStringSimd(buf, &pj.Strings.B) // We can safely ignore the result since we validate above
-		pj.write_tape(uint64(STRINGBUFBIT+start), '"')
 		size = uint64(len(pj.Strings.B) - start)
+		if pj.compact && size <= maxInlineString {
+			pj.Tape = append(pj.Tape, inlineStringEntry(pj.Strings.B[start:]))
+			pj.Strings.B = pj.Strings.B[:start]
+			return true
+		}
+		if pj.internMaxLen > 0 && size <= uint64(pj.internMaxLen) {
+			if off, found := pj.internString(start, int(size)); found {
+				// Drop the copy we just added.
+				pj.Strings.B = pj.Strings.B[:start]
+				start = off
+			}
+		}
+		pj.write_tape(uint64(STRINGBUFBIT+start), '"')
 	}
 	// put length onto the tape
 	pj.Tape = append(pj.Tape, size)
 	return true
 }
 
-func addNumber(buf []byte, pj *ParsedJson) bool {
-	tag, val := parseNumber(buf)
+func addNumber(buf []byte, pj *internalParsedJson) bool {
+	tag, val := parseNumberFlags(buf, pj.floatPrecision)
 	if tag == 0 {
 		return false
 	}
+	if pj.compact && tag == uint64(TagInteger)<<JSONTAGOFFSET && fitsInlineInt(int64(val)) {
+		pj.Tape = append(pj.Tape, inlineIntEntry(int64(val)))
+		return true
+	}
 	pj.writeTapeTagValFlags(tag, val)
 	return true
 }
@@ -157,6 +177,11 @@ func isValidNullAtom(buf []byte) bool {
 	return false
 }
 
+// unifiedMachine builds the tape from the structural indexes.
+// Dispatch is done with gotos on the current character.
+// A table-driven machine, dispatching on (state, character class) and consuming
+// index blocks as slices, was measured 6.8-9.7% slower on BenchmarkStage2
+// and no faster on BenchmarkParse*, so the gotos are kept.
 func (pj *internalParsedJson) unifiedMachine() (ok, done bool) {
 	buf := pj.Message
 	const addOneForRoot = 1
@@ -167,6 +192,11 @@ func (pj *internalParsedJson) unifiedMachine() (ok, done bool) {
 	////////////////////////////// START STATE /////////////////////////////
 	pj.containingScopeOffset = append(pj.containingScopeOffset, (pj.get_current_loc()<<retAddressShift)|retAddressStartConst)
 
+	// The offsets are handed over to the index of the result, so always start a new slice.
+	pj.rootOffs = nil
+	if pj.recordIndex {
+		pj.rootOffs = append(pj.rootOffs, int(pj.get_current_loc()))
+	}
 	pj.write_tape(0, 'r') // r for root, 0 is going to get overwritten
 	// the root is used, if nothing else, to capture the size of the tape
 
@@ -215,6 +245,9 @@ startContinue:
 
 		// And open a new root
 		pj.containingScopeOffset = append(pj.containingScopeOffset, (pj.get_current_loc()<<retAddressShift)|retAddressStartConst)
+		if pj.recordIndex {
+			pj.rootOffs = append(pj.rootOffs, int(pj.get_current_loc()))
+		}
 		pj.write_tape(0, 'r') // r for root, 0 is going to get overwritten
 
 		goto continueRoot
@@ -228,7 +261,7 @@ object_begin:
 	}
 	switch buf[idx] {
 	case '"':
-		if !parseString(&pj.ParsedJson, idx, peekSize(pj), pj.copyStrings) {
+		if !parseString(pj, idx, peekSize(pj), pj.copyStrings) {
 			goto fail
 		}
 		goto object_key_state
@@ -250,7 +283,7 @@ object_key_state:
 	}
 	switch buf[idx] {
 	case '"':
-		if !parseString(&pj.ParsedJson, idx, peekSize(pj), pj.copyStrings) {
+		if !parseString(pj, idx, peekSize(pj), pj.copyStrings) {
 			goto fail
 		}
 
@@ -273,7 +306,7 @@ object_key_state:
 		pj.write_tape(0, 'n')
 
 	case '-':
-		if !addNumber(buf[idx:], &pj.ParsedJson) {
+		if !addNumber(buf[idx:], pj) {
 			goto fail
 		}
 
@@ -291,7 +324,7 @@ object_key_state:
 
 	default:
 		if buf[idx] >= '0' && buf[idx] <= '9' {
-			if !addNumber(buf[idx:], &pj.ParsedJson) {
+			if !addNumber(buf[idx:], pj) {
 				goto fail
 			}
 			break
@@ -311,7 +344,7 @@ objectContinue:
 		if buf[idx] != '"' {
 			goto fail
 		}
-		if !parseString(&pj.ParsedJson, idx, peekSize(pj), pj.copyStrings) {
+		if !parseString(pj, idx, peekSize(pj), pj.copyStrings) {
 			goto fail
 		}
 		goto object_key_state
@@ -357,7 +390,7 @@ mainArraySwitch:
 	// on paths that can accept a close square brace (post-, and at start)
 	switch buf[idx] {
 	case '"':
-		if !parseString(&pj.ParsedJson, idx, peekSize(pj), pj.copyStrings) {
+		if !parseString(pj, idx, peekSize(pj), pj.copyStrings) {
 			goto fail
 		}
 	case 't':
@@ -380,7 +413,7 @@ mainArraySwitch:
 		/* goto array_continue */
 
 	case '-':
-		if !addNumber(buf[idx:], &pj.ParsedJson) {
+		if !addNumber(buf[idx:], pj) {
 			goto fail
 		}
 
@@ -398,7 +431,7 @@ mainArraySwitch:
 
 	default:
 		if buf[idx] >= '0' && buf[idx] <= '9' {
-			if !addNumber(buf[idx:], &pj.ParsedJson) {
+			if !addNumber(buf[idx:], pj) {
 				goto fail
 			}
 			break
@@ -438,6 +471,13 @@ succeed:
 	pj.annotate_previousloc(offset>>retAddressShift, pj.get_current_loc()+addOneForRoot)
 	pj.write_tape(offset>>retAddressShift, 'r') // r is root
 
+	if pj.recordIndex {
+		pj.setRecordIndex(pj.rootOffs)
+		pj.rootOffs = nil
+	}
+	if pj.internTable != nil {
+		pj.updateMeta(func(m *tapeMeta) { m.interned = newInternIndex(pj.internTable, pj.Strings) })
+	}
 	pj.isvalid = true
 	return true, done
 
@@ -20,6 +20,7 @@
 package simdjson
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -192,6 +193,45 @@ func TestStage2BuildTape(t *testing.T) {
 	}
 }
 
+func TestStage2Invalid(t *testing.T) {
+	if !SupportedCPU() {
+		t.SkipNow()
+	}
+	for _, input := range []string{
+		`{"a":1]`,
+		`[1,]`,
+		`[1 2]`,
+		`[}`,
+		`{"a" 1}`,
+		`{,}`,
+		`{"a":1,}`,
+		`{"a":1,"b"}`,
+		`{1:2}`,
+		`[tru]`,
+		`{"a":1}{"b":2}`,
+		`{"a":[1}`,
+	} {
+		pj := internalParsedJson{}
+		if err := pj.parseMessage([]byte(input), false); err == nil {
+			t.Errorf("%s: want error", input)
+		}
+	}
+
+	// Newlines separate roots.
+	pj := internalParsedJson{}
+	if err := pj.parseMessage([]byte("{\"a\":1}\n\n\n[2]\n{}"), true); err != nil {
+		t.Fatal(err)
+	}
+	i := pj.Iter()
+	roots := 0
+	for i.Advance() == TypeRoot {
+		roots++
+	}
+	if roots != 3 {
+		t.Errorf("want 3 roots, got %d", roots)
+	}
+}
+
 func TestIsValidTrueAtom(t *testing.T) {
 
 	testCases := []struct {
@@ -260,3 +300,54 @@ func TestIsValidNullAtom(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkStage2(b *testing.B) {
+	if !SupportedCPU() {
+		b.SkipNow()
+	}
+	for _, name := range []string{"twitter", "citm_catalog", "github_events"} {
+		b.Run(name, func(b *testing.B) {
+			msg := bytes.TrimSpace(loadCompressed(b, name))
+			pj := internalParsedJson{}
+			pj.Message = msg
+			pj.copyStrings = true
+			pj.initialize(len(msg))
+			pj.buffersOffset = ^uint64(0)
+
+			// Collect structural indexes once.
+			// Buffers are reused by stage 1, so they must be copied while it runs.
+			pj.indexChans = make(chan indexChan, indexSlots-2)
+			stage1 := make(chan bool)
+			go func() {
+				stage1 <- pj.findStructuralIndices()
+			}()
+			var blocks []indexChan
+			for ic := range pj.indexChans {
+				if ic.index == -1 {
+					break
+				}
+				indexes := *ic.indexes
+				ic.indexes = &indexes
+				blocks = append(blocks, ic)
+			}
+			if !<-stage1 {
+				b.Fatal("stage 1 failed")
+			}
+			pj.indexChans = make(chan indexChan, len(blocks)+1)
+
+			b.SetBytes(int64(len(msg)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, ic := range blocks {
+					pj.indexChans <- ic
+				}
+				pj.indexChans <- indexChan{index: -1}
+				pj.initialize(len(msg))
+				if ok, _ := pj.unifiedMachine(); !ok {
+					b.Fatal("stage 2 failed")
+				}
+			}
+		})
+	}
+}